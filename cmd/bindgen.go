@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kkkunny/Sim/src/bindgen"
+	stlos "github.com/kkkunny/stl/os"
+	"github.com/kkkunny/stl/util"
+	"github.com/spf13/cobra"
+)
+
+func BindgenCmd() *cobra.Command {
+	var conf bindgen.Config
+	cmd := &cobra.Command{
+		Use:   "bindgen",
+		Short: "generate sim bindings from a c header file",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.ExactArgs(1)(cmd, args); err != nil {
+				return err
+			}
+			header := stlos.Path(args[0])
+			if !header.IsFile() {
+				return errors.New("expect a c header file path")
+			}
+			conf.Header = header
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := util.MustValue(bindgen.Generate(conf))
+			fmt.Println(path)
+			return nil
+		},
+	}
+	// output path
+	cmd.Flags().StringVarP((*string)(&conf.Output), "output", "o", "", "output package directory")
+	// lib
+	cmd.Flags().StringSliceVarP(&conf.Libs, "lib", "l", nil, "linkage extern library")
+	// include
+	cmd.Flags().StringSliceVarP(&conf.Includes, "include", "I", nil, "include path")
+	// define
+	cmd.Flags().StringSliceVarP(&conf.Defines, "define", "D", nil, "predefined macro")
+	// raw
+	cmd.Flags().BoolVar(&conf.Raw, "raw", false, "parse the header without preprocessing")
+	return cmd
+}
@@ -16,6 +16,8 @@ type buildConfig struct {
 	Linkages     []stlos.Path // 链接
 	Libraries    []string     // 链接库
 	LibraryPaths []string     // 链接库地址
+	Checks       bool         // 是否插入运行时检查
+	OptLevel     uint         // 优化等级
 }
 
 func BuildCmd() *cobra.Command {
@@ -50,6 +52,10 @@ func BuildCmd() *cobra.Command {
 	// lib
 	cmd.Flags().StringSliceVarP(&conf.Libraries, "lib", "l", nil, "linkage extern library")
 	cmd.Flags().StringSliceVarP(&conf.LibraryPaths, "lib_path", "L", nil, "library path")
+	// runtime checks
+	cmd.Flags().BoolVar(&conf.Checks, "checks", false, "insert runtime checks for null, bounds, overflow and division")
+	// optimization level
+	cmd.Flags().UintVarP(&conf.OptLevel, "opt", "O", 0, "optimization level (0-3)")
 	return cmd
 }
 
@@ -60,6 +66,9 @@ func build(conf buildConfig) error {
 	default:
 		return fmt.Errorf("unknwon output file type")
 	}
+	if conf.OptLevel > 3 {
+		return fmt.Errorf("unknown optimization level `%d`", conf.OptLevel)
+	}
 
 	// 输出地址
 	if conf.Output == "" {
@@ -108,14 +117,25 @@ func build(conf buildConfig) error {
 	}
 	defer os.Remove(asmPath.String())
 
+	// 汇编文件交给汇编器，其余文件（C源文件、目标文件等）交给链接器
+	var asms, objects []stlos.Path
+	for _, l := range conf.Linkages {
+		switch l.GetExtension() {
+		case "s", "S", "asm":
+			asms = append(asms, l)
+		default:
+			objects = append(objects, l)
+		}
+	}
+
 	// 链接
 	var objectPath stlos.Path
 	if conf.End == "obj" {
 		objectPath = conf.Output
-		_, err = outputObject(asmPath, conf.Output, conf.Linkages)
+		_, err = outputObject(asmPath, conf.Output, asms)
 		return err
 	} else {
-		objectPath, err = outputObject(asmPath, "", conf.Linkages)
+		objectPath, err = outputObject(asmPath, "", asms)
 		if err != nil {
 			return err
 		}
@@ -124,11 +144,11 @@ func build(conf buildConfig) error {
 
 	// 动态库
 	if conf.End == "lib" {
-		_, err = outputSharedFile(objectPath, conf.Output, conf.Libraries, conf.LibraryPaths)
+		_, err = outputSharedFile(objectPath, conf.Output, objects, conf.Libraries, conf.LibraryPaths)
 		return err
 	}
 
 	// 可执行文件
-	_, err = outputExecutableFile(objectPath, conf.Output, conf.Libraries, conf.LibraryPaths)
+	_, err = outputExecutableFile(objectPath, conf.Output, objects, conf.Libraries, conf.LibraryPaths)
 	return err
 }
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/kkkunny/Sim/src/compiler/mangle"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+func DemangleCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "demangle [symbol...]",
+		Short: "demangle sim symbols, or all symbols in stdin if no symbol is given",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				for _, a := range args {
+					s, _ := mangle.Demangle(a)
+					fmt.Println(s)
+				}
+				return nil
+			}
+			reader := bufio.NewReader(os.Stdin)
+			writer := bufio.NewWriter(os.Stdout)
+			defer writer.Flush()
+			for {
+				line, err := reader.ReadString('\n')
+				if _, werr := writer.WriteString(mangle.DemangleText(line)); werr != nil {
+					return werr
+				}
+				if err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+		},
+	}
+}
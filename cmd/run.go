@@ -7,15 +7,17 @@ import (
 	"github.com/spf13/cobra"
 	"os"
 	"os/exec"
+	"syscall"
 )
 
 func RunCmd() *cobra.Command {
 	var conf buildConfig
 	cmd := &cobra.Command{
-		Use:   "run",
+		Use:   "run <file> [args...]",
 		Short: "compiler and then run a sim source file",
 		Args: func(cmd *cobra.Command, args []string) error {
-			if err := cobra.ExactArgs(1)(cmd, args); err != nil {
+			// 源文件之后的参数都传给程序
+			if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
 				return err
 			}
 			conf.End = "exe"
@@ -35,6 +37,12 @@ func RunCmd() *cobra.Command {
 			return nil
 		},
 	}
+	// 源文件之后的参数不作为sim的选项解析
+	cmd.Flags().SetInterspersed(false)
+	// runtime checks
+	cmd.Flags().BoolVar(&conf.Checks, "checks", false, "insert runtime checks for null, bounds, overflow and division")
+	// optimization level
+	cmd.Flags().UintVarP(&conf.OptLevel, "opt", "O", 0, "optimization level (0-3)")
 	return cmd
 }
 
@@ -58,10 +66,18 @@ func run(conf buildConfig, args []string) error {
 	if err != nil {
 		if exit, ok := err.(*exec.ExitError); ok {
 			_ = os.Remove(binary.String())
-			os.Exit(exit.ExitCode())
+			os.Exit(exitCode(exit))
 		} else {
 			return err
 		}
 	}
 	return nil
 }
+
+// 进程的退出码，被信号终止时为128+信号值（与shell一致），报错终止时为101
+func exitCode(exit *exec.ExitError) int {
+	if status, ok := exit.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exit.ExitCode()
+}
@@ -48,6 +48,14 @@ func RandomString(n uint8) string {
 	return buf.String()
 }
 
+// 优化等级对应的代码生成等级
+var codegenLevels = [...]llvm.CodeGenOptLevel{
+	llvm.CodeGenLevelNone,
+	llvm.CodeGenLevelLess,
+	llvm.CodeGenLevelDefault,
+	llvm.CodeGenLevelAggressive,
+}
+
 // 输出llvm
 func outputLLVM(config *buildConfig, from stlos.Path) (llvm.Module, llvm.TargetMachine, error) {
 	var ast *parse.Package
@@ -64,7 +72,10 @@ func outputLLVM(config *buildConfig, from stlos.Path) (llvm.Module, llvm.TargetM
 	if err != nil {
 		return llvm.Module{}, llvm.TargetMachine{}, err
 	}
-	module := codegen.NewCodeGenerator().Codegen(*mean)
+	for _, w := range mean.Warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	module := codegen.NewCodeGenerator(config.Checks).Codegen(*mean)
 
 	if err = llvm.InitializeNativeTarget(); err != nil {
 		return llvm.Module{}, llvm.TargetMachine{}, err
@@ -72,14 +83,27 @@ func outputLLVM(config *buildConfig, from stlos.Path) (llvm.Module, llvm.TargetM
 	if err = llvm.InitializeNativeAsmPrinter(); err != nil {
 		return llvm.Module{}, llvm.TargetMachine{}, err
 	}
+	// 内联汇编需要汇编解析器
+	llvm.InitializeAllAsmParsers()
 	module.SetTarget(llvm.DefaultTargetTriple())
 	target, err := llvm.GetTargetFromTriple(module.Target())
 	if err != nil {
 		return llvm.Module{}, llvm.TargetMachine{}, err
 	}
-	tm := target.CreateTargetMachine(module.Target(), "generic", "", llvm.CodeGenLevelNone, llvm.RelocPIC, llvm.CodeModelDefault)
+	tm := target.CreateTargetMachine(module.Target(), "generic", "", codegenLevels[config.OptLevel], llvm.RelocPIC, llvm.CodeModelDefault)
 	module.SetDataLayout(tm.CreateTargetData().String())
 
+	// 优化
+	if config.OptLevel > 0 {
+		pmb := llvm.NewPassManagerBuilder()
+		defer pmb.Dispose()
+		pmb.SetOptLevel(llvm.OptLevel(config.OptLevel))
+		pm := llvm.NewPassManager()
+		defer pm.Dispose()
+		pmb.Populate(pm)
+		pm.Run(module)
+	}
+
 	for l := range mean.Links {
 		config.Linkages = append(config.Linkages, l)
 	}
@@ -130,7 +154,7 @@ func outputObject(from, to stlos.Path, links []stlos.Path) (stlos.Path, error) {
 }
 
 // 输出动态库文件
-func outputSharedFile(from, to stlos.Path, libraries, libraryPaths []string) (stlos.Path, error) {
+func outputSharedFile(from, to stlos.Path, objects []stlos.Path, libraries, libraryPaths []string) (stlos.Path, error) {
 	if to == "" {
 		for {
 			to = stlos.Path(os.TempDir()).Join("lib" + stlos.Path(RandomString(6)) + ".so")
@@ -145,6 +169,9 @@ func outputSharedFile(from, to stlos.Path, libraries, libraryPaths []string) (st
 		return "", errors.New("can not found a linker")
 	}
 	linker.Args = append(linker.Args, "-shared", "-fPIC", "-o", to.String(), from.String())
+	for _, o := range objects {
+		linker.Args = append(linker.Args, o.String())
+	}
 	for _, l := range libraries {
 		linker.Args = append(linker.Args, fmt.Sprintf("-l%s", l))
 	}
@@ -155,7 +182,7 @@ func outputSharedFile(from, to stlos.Path, libraries, libraryPaths []string) (st
 }
 
 // 输出可执行文件
-func outputExecutableFile(from, to stlos.Path, libraries, libraryPaths []string) (stlos.Path, error) {
+func outputExecutableFile(from, to stlos.Path, objects []stlos.Path, libraries, libraryPaths []string) (stlos.Path, error) {
 	if to == "" {
 		for {
 			to = stlos.Path(os.TempDir()).Join(stlos.Path(RandomString(6)))
@@ -170,6 +197,9 @@ func outputExecutableFile(from, to stlos.Path, libraries, libraryPaths []string)
 		return "", errors.New("can not found a linker")
 	}
 	linker.Args = append(linker.Args, "-fPIC", "-o", to.String(), from.String())
+	for _, o := range objects {
+		linker.Args = append(linker.Args, o.String())
+	}
 	for _, l := range libraries {
 		linker.Args = append(linker.Args, fmt.Sprintf("-l%s", l))
 	}
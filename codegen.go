@@ -22,7 +22,7 @@ func main() {
 		ast = util.MustValue(parse.ParseFile(stlos.Path(os.Args[1])))
 	}
 	mean := util.MustValue(analyse.AnalyseMain(ast))
-	module := codegen.NewCodeGenerator().Codegen(*mean)
+	module := codegen.NewCodeGenerator(false).Codegen(*mean)
 	util.Must(llvm.VerifyModule(module, llvm.ReturnStatusAction))
 	fmt.Println(module)
 }
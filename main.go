@@ -16,7 +16,7 @@ var rootCmd = &cobra.Command{
 }
 
 func main() {
-	rootCmd.AddCommand(cmd.BuildCmd(), cmd.RunCmd())
+	rootCmd.AddCommand(cmd.BuildCmd(), cmd.RunCmd(), cmd.BindgenCmd(), cmd.DemangleCmd())
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
@@ -0,0 +1,88 @@
+package bindgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	stlos "github.com/kkkunny/stl/os"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Config 绑定生成配置
+type Config struct {
+	Header   stlos.Path // 头文件
+	Output   stlos.Path // 输出包目录
+	Libs     []string   // 链接库
+	Includes []string   // 头文件搜索路径
+	Defines  []string   // 预定义宏
+	Raw      bool       // 不调用预处理器，直接分析头文件
+}
+
+// Generate 从C头文件生成Sim绑定包，返回生成的文件路径
+func Generate(conf Config) (stlos.Path, error) {
+	header, err := conf.Header.GetAbsolute()
+	if err != nil {
+		return "", err
+	}
+	var src []byte
+	if conf.Raw {
+		src, err = os.ReadFile(header.String())
+	} else {
+		src, err = preprocess(header, conf.Includes, conf.Defines)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	toks, macros := tokenize(header.String(), string(src))
+	p := newParser(toks)
+	p.parse()
+	p.evalMacros(macros)
+
+	output := conf.Output
+	if output == "" {
+		base := header.GetBase().String()
+		output = stlos.Path(strings.TrimSuffix(base, filepath.Ext(base)))
+	}
+	if err = os.MkdirAll(output.String(), 0755); err != nil {
+		return "", err
+	}
+	file := output.Join(output.GetBase().WithExtension("sim"))
+	code := newGenerator(p, header.String(), conf.Libs).generate(header.GetBase().String())
+	return file, os.WriteFile(file.String(), []byte(code), 0644)
+}
+
+// 调用C预处理器，保留宏定义和行标记
+func preprocess(header stlos.Path, includes, defines []string) ([]byte, error) {
+	var cc string
+	for _, c := range []string{"clang", "gcc", "cc"} {
+		if p, err := exec.LookPath(c); err == nil {
+			cc = p
+			break
+		}
+	}
+	if cc == "" {
+		return nil, errors.New("can not found a c preprocessor")
+	}
+
+	args := []string{"-E", "-dD", "-x", "c"}
+	for _, i := range includes {
+		args = append(args, "-I"+i)
+	}
+	for _, d := range defines {
+		args = append(args, "-D"+d)
+	}
+	args = append(args, header.String())
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(cc, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s\n%s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
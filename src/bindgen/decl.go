@@ -0,0 +1,159 @@
+package bindgen
+
+// CType C类型
+type CType interface {
+	ctype()
+}
+
+// Basic 基础类型（规范化后的C类型名，如 `unsigned long`）
+type Basic struct {
+	Name string
+}
+
+func (self Basic) ctype() {}
+
+// Pointer 指针类型
+type Pointer struct {
+	Elem CType
+}
+
+func (self Pointer) ctype() {}
+
+// Array 数组类型
+type Array struct {
+	Size int64 // 小于0为柔性数组
+	Elem CType
+}
+
+func (self Array) ctype() {}
+
+// FuncType 函数类型
+type FuncType struct {
+	Ret      CType
+	Params   []*Param
+	Variadic bool
+}
+
+func (self FuncType) ctype() {}
+
+// Param 参数
+type Param struct {
+	Name string // 可能为空
+	Type CType
+}
+
+// Named 类型定义引用
+type Named struct {
+	Name string
+}
+
+func (self Named) ctype() {}
+
+// Record 结构体或联合体
+type Record struct {
+	Tag         string // 可能为空
+	Union       bool
+	Defined     bool
+	Fields      []*Field
+	File        string
+	Unsupported string // 不支持的原因
+
+	name string // 生成的名字
+}
+
+func (self Record) ctype() {}
+
+func (self Record) decl() {}
+
+func (self Record) file() string {
+	return self.File
+}
+
+// Field 成员
+type Field struct {
+	Name     string // 匿名成员为空
+	Type     CType
+	BitWidth int64 // 小于0不是位域
+}
+
+// Enum 枚举
+type Enum struct {
+	Tag     string // 可能为空
+	Consts  []*EnumConst
+	Defined bool
+	File    string
+
+	name string // 生成的名字
+}
+
+func (self Enum) ctype() {}
+
+func (self Enum) decl() {}
+
+func (self Enum) file() string {
+	return self.File
+}
+
+// EnumConst 枚举常量
+type EnumConst struct {
+	Name  string
+	Value int64
+}
+
+// Decl 声明
+type Decl interface {
+	decl()
+	file() string
+}
+
+// Function 函数声明
+type Function struct {
+	Name string
+	Type *FuncType
+	File string
+}
+
+func (self Function) decl() {}
+
+func (self Function) file() string {
+	return self.File
+}
+
+// Variable 全局变量声明
+type Variable struct {
+	Name string
+	Type CType
+	File string
+}
+
+func (self Variable) decl() {}
+
+func (self Variable) file() string {
+	return self.File
+}
+
+// Typedef 类型定义
+type Typedef struct {
+	Name string
+	Type CType
+	File string
+}
+
+func (self Typedef) decl() {}
+
+func (self Typedef) file() string {
+	return self.File
+}
+
+// Macro 整数常量宏
+type Macro struct {
+	Name  string
+	Value int64
+	File  string
+}
+
+func (self Macro) decl() {}
+
+func (self Macro) file() string {
+	return self.File
+}
@@ -0,0 +1,289 @@
+package bindgen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 常量表达式求值器
+type evaluator struct {
+	toks        []token
+	pos         int
+	lookup      func(string) (int64, bool)
+	isTypeStart func(token) bool
+}
+
+// 对整数常量表达式求值
+func evalConstExpr(toks []token, lookup func(string) (int64, bool), isTypeStart func(token) bool) (v int64, err error) {
+	if len(toks) == 0 {
+		return 0, errors.New("expect a constant expression")
+	}
+	e := &evaluator{
+		toks:        toks,
+		lookup:      lookup,
+		isTypeStart: isTypeStart,
+	}
+	defer func() {
+		if ea := recover(); ea != nil {
+			if ee, ok := ea.(error); ok {
+				err = ee
+				return
+			}
+			panic(ea)
+		}
+	}()
+	v = e.parseTernary()
+	if e.pos != len(e.toks) {
+		return 0, fmt.Errorf("unexpected `%s`", e.toks[e.pos].Source)
+	}
+	return v, nil
+}
+
+func (self *evaluator) peek() string {
+	if self.pos >= len(self.toks) {
+		return ""
+	}
+	return self.toks[self.pos].Source
+}
+
+func (self *evaluator) next() token {
+	if self.pos >= len(self.toks) {
+		panic(errors.New("unexpected end of expression"))
+	}
+	self.pos++
+	return self.toks[self.pos-1]
+}
+
+func (self *evaluator) expect(s string) {
+	if tok := self.next(); tok.Source != s {
+		panic(fmt.Errorf("expect `%s`", s))
+	}
+}
+
+// 二元运算符优先级
+func binaryPriority(op string) int {
+	switch op {
+	case "*", "/", "%":
+		return 10
+	case "+", "-":
+		return 9
+	case "<<", ">>":
+		return 8
+	case "<", "<=", ">", ">=":
+		return 7
+	case "==", "!=":
+		return 6
+	case "&":
+		return 5
+	case "^":
+		return 4
+	case "|":
+		return 3
+	case "&&":
+		return 2
+	case "||":
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (self *evaluator) parseTernary() int64 {
+	cond := self.parseBinary(1)
+	if self.peek() != "?" {
+		return cond
+	}
+	self.next()
+	t := self.parseTernary()
+	self.expect(":")
+	f := self.parseTernary()
+	if cond != 0 {
+		return t
+	}
+	return f
+}
+
+func (self *evaluator) parseBinary(prior int) int64 {
+	left := self.parseUnary()
+	for {
+		op := self.peek()
+		p := binaryPriority(op)
+		if p == 0 || p < prior {
+			return left
+		}
+		self.next()
+		right := self.parseBinary(p + 1)
+		left = applyBinary(op, left, right)
+	}
+}
+
+func applyBinary(op string, l, r int64) int64 {
+	b := func(c bool) int64 {
+		if c {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "*":
+		return l * r
+	case "/", "%":
+		if r == 0 {
+			panic(errors.New("division by zero"))
+		}
+		if op == "/" {
+			return l / r
+		}
+		return l % r
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "<<":
+		return l << uint64(r)
+	case ">>":
+		return l >> uint64(r)
+	case "<":
+		return b(l < r)
+	case "<=":
+		return b(l <= r)
+	case ">":
+		return b(l > r)
+	case ">=":
+		return b(l >= r)
+	case "==":
+		return b(l == r)
+	case "!=":
+		return b(l != r)
+	case "&":
+		return l & r
+	case "^":
+		return l ^ r
+	case "|":
+		return l | r
+	case "&&":
+		return b(l != 0 && r != 0)
+	case "||":
+		return b(l != 0 || r != 0)
+	default:
+		panic(fmt.Errorf("unknown operator `%s`", op))
+	}
+}
+
+func (self *evaluator) parseUnary() int64 {
+	switch self.peek() {
+	case "-":
+		self.next()
+		return -self.parseUnary()
+	case "+":
+		self.next()
+		return self.parseUnary()
+	case "~":
+		self.next()
+		return ^self.parseUnary()
+	case "!":
+		self.next()
+		if self.parseUnary() == 0 {
+			return 1
+		}
+		return 0
+	case "(":
+		// 类型转换
+		if self.pos+1 < len(self.toks) && self.isTypeStart(self.toks[self.pos+1]) {
+			self.next()
+			var words []string
+			for self.peek() != ")" {
+				words = append(words, self.next().Source)
+			}
+			self.next()
+			v := self.parseUnary()
+			return truncateTo(strings.Join(words, " "), v)
+		}
+		self.next()
+		v := self.parseTernary()
+		self.expect(")")
+		return v
+	default:
+		return self.parsePrimary()
+	}
+}
+
+// 按类型截断（只处理基础类型关键字）
+func truncateTo(typ string, v int64) int64 {
+	for _, w := range strings.Fields(typ) {
+		switch w {
+		case "signed", "unsigned", "char", "short", "int", "long", "const", "volatile", "*":
+		default:
+			return v
+		}
+	}
+	unsigned := strings.Contains(typ, "unsigned")
+	switch {
+	case strings.Contains(typ, "*"), strings.Contains(typ, "long"):
+		return v
+	case strings.Contains(typ, "char"):
+		if unsigned {
+			return int64(uint8(v))
+		}
+		return int64(int8(v))
+	case strings.Contains(typ, "short"):
+		if unsigned {
+			return int64(uint16(v))
+		}
+		return int64(int16(v))
+	case strings.Contains(typ, "int") || unsigned:
+		if unsigned {
+			return int64(uint32(v))
+		}
+		return int64(int32(v))
+	default:
+		return v
+	}
+}
+
+func (self *evaluator) parsePrimary() int64 {
+	tok := self.next()
+	switch tok.Kind {
+	case tokNumber:
+		return parseCInt(tok.Source)
+	case tokChar:
+		s, err := strconv.Unquote(tok.Source)
+		if err != nil || len([]rune(s)) != 1 {
+			panic(fmt.Errorf("unsupported char literal %s", tok.Source))
+		}
+		return int64([]rune(s)[0])
+	case tokIdent:
+		if tok.Source == "sizeof" || tok.Source == "_Alignof" || tok.Source == "__alignof__" {
+			panic(fmt.Errorf("unsupported `%s`", tok.Source))
+		}
+		if v, ok := self.lookup(tok.Source); ok {
+			return v
+		}
+		panic(fmt.Errorf("unknown identifier `%s`", tok.Source))
+	default:
+		panic(fmt.Errorf("unexpected `%s`", tok.Source))
+	}
+}
+
+// 解析C整数字面量
+func parseCInt(s string) int64 {
+	lit := strings.TrimRight(strings.ToLower(s), "ul")
+	var v uint64
+	var err error
+	switch {
+	case strings.HasPrefix(lit, "0x"):
+		v, err = strconv.ParseUint(lit[2:], 16, 64)
+	case strings.HasPrefix(lit, "0b"):
+		v, err = strconv.ParseUint(lit[2:], 2, 64)
+	case len(lit) > 1 && lit[0] == '0':
+		v, err = strconv.ParseUint(lit[1:], 8, 64)
+	default:
+		v, err = strconv.ParseUint(lit, 10, 64)
+	}
+	if err != nil {
+		panic(fmt.Errorf("invalid integer literal `%s`", s))
+	}
+	return int64(v)
+}
@@ -0,0 +1,556 @@
+package bindgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// 基础类型映射
+var basicTypes = map[string]string{
+	"char":               "c::char",
+	"signed char":        "i8",
+	"unsigned char":      "c::unsigned_char",
+	"short":              "c::short",
+	"unsigned short":     "c::unsigned_short",
+	"int":                "c::int",
+	"unsigned int":       "c::unsigned_int",
+	"long":               "c::long",
+	"unsigned long":      "c::unsigned_long",
+	"long long":          "i64",
+	"unsigned long long": "u64",
+	"__int128":           "i128",
+	"unsigned __int128":  "u128",
+	"float":              "c::float",
+	"double":             "c::double",
+	"_Bool":              "bool",
+}
+
+// 已在std.c中定义或可直接映射的类型定义
+var builtinTypes = map[string]string{
+	"size_t":         "c::size_t",
+	"FILE":           "c::FILE",
+	"fpos_t":         "c::fpos_t",
+	"wchar_t":        "c::wchar_t",
+	"wint_t":         "c::wint_t",
+	"div_t":          "c::div_t",
+	"ldiv_t":         "c::ldiv_t",
+	"time_t":         "c::time_t",
+	"clock_t":        "c::clock_t",
+	"jmp_buf":        "c::jmp_buf",
+	"int8_t":         "i8",
+	"int16_t":        "i16",
+	"int32_t":        "i32",
+	"int64_t":        "i64",
+	"uint8_t":        "u8",
+	"uint16_t":       "u16",
+	"uint32_t":       "u32",
+	"uint64_t":       "u64",
+	"intptr_t":       "isize",
+	"uintptr_t":      "usize",
+	"ssize_t":        "isize",
+	"ptrdiff_t":      "isize",
+	"intmax_t":       "i64",
+	"uintmax_t":      "u64",
+	"__int128_t":     "i128",
+	"__uint128_t":    "u128",
+	"va_list":        "c::va_list",
+	"__gnuc_va_list": "c::va_list",
+}
+
+// Sim关键字和基础类型名
+var simReserved = map[string]bool{
+	"func": true, "return": true, "true": true, "false": true, "struct": true, "if": true, "else": true,
+	"for": true, "break": true, "continue": true, "as": true, "type": true, "null": true, "defer": true,
+	"import": true, "pub": true, "let": true, "union": true, "asm": true,
+	"none": true, "i8": true, "i16": true, "i32": true, "i64": true, "i128": true, "isize": true, "u8": true, "u16": true,
+	"u32": true, "u64": true, "u128": true, "usize": true, "f32": true, "f64": true, "bool": true,
+}
+
+// 声明生成状态
+type genState struct {
+	done bool
+	text string
+	err  error
+}
+
+// 代码生成器
+type generator struct {
+	p      *parser
+	target string
+	libs   []string
+
+	typedefs     map[string]*Typedef // C类型定义名 -> 声明
+	funcTypedefs map[string]bool     // 函数类型的类型定义
+	merged       map[*Typedef]bool   // 合并进结构体/枚举的类型定义
+	states       map[Decl]*genState
+	opaques      []*Record // 只声明未定义的结构体
+}
+
+func newGenerator(p *parser, target string, libs []string) *generator {
+	return &generator{
+		p:            p,
+		target:       target,
+		libs:         libs,
+		typedefs:     make(map[string]*Typedef),
+		funcTypedefs: make(map[string]bool),
+		merged:       make(map[*Typedef]bool),
+		states:       make(map[Decl]*genState),
+	}
+}
+
+// 转换为合法的Sim标识符
+func simName(name string) string {
+	if simReserved[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// 命名
+func (self *generator) assignNames() {
+	typeNames := make(map[string]bool)
+	for _, d := range self.p.decls {
+		td, ok := d.(*Typedef)
+		if !ok {
+			continue
+		}
+		if _, ok := self.typedefs[td.Name]; !ok {
+			self.typedefs[td.Name] = td
+		}
+		typeNames[td.Name] = true
+		if _, ok := td.Type.(*FuncType); ok {
+			self.funcTypedefs[td.Name] = true
+		}
+		// 匿名结构体/枚举使用类型定义的名字
+		switch t := td.Type.(type) {
+		case *Record:
+			if t.Tag == "" && t.name == "" {
+				t.name = simName(td.Name)
+				self.merged[td] = true
+			} else if t.Tag == td.Name {
+				self.merged[td] = true
+			}
+		case *Enum:
+			if t.Tag == "" && t.name == "" {
+				t.name = simName(td.Name)
+				self.merged[td] = true
+			} else if t.Tag == td.Name {
+				self.merged[td] = true
+			}
+		}
+	}
+	for _, r := range self.p.records {
+		if r.name != "" {
+			continue
+		}
+		r.name = simName(r.Tag)
+		if td, ok := self.typedefs[r.Tag]; ok && td.Type != CType(r) {
+			r.name = "struct_" + r.Tag
+			if r.Union {
+				r.name = "union_" + r.Tag
+			}
+		}
+	}
+	for _, e := range self.p.enums {
+		if e.name != "" {
+			continue
+		}
+		e.name = simName(e.Tag)
+		if td, ok := self.typedefs[e.Tag]; ok && td.Type != CType(e) {
+			e.name = "enum_" + e.Tag
+		}
+	}
+}
+
+// 生成声明（带记忆），返回错误表示不支持
+func (self *generator) require(d Decl) error {
+	if st, ok := self.states[d]; ok {
+		if !st.done {
+			// 正在生成（通过指针的循环引用）
+			return nil
+		}
+		return st.err
+	}
+	st := &genState{}
+	self.states[d] = st
+	st.text, st.err = self.genDecl(d)
+	st.done = true
+	return st.err
+}
+
+// 声明
+func (self *generator) genDecl(d Decl) (string, error) {
+	switch decl := d.(type) {
+	case *Typedef:
+		if self.merged[decl] {
+			if t, ok := decl.Type.(*Record); ok {
+				return "", self.require(t)
+			} else if t, ok := decl.Type.(*Enum); ok {
+				return "", self.require(t)
+			}
+		}
+		t, err := self.genType(decl.Type, "")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("pub type %s %s\n", simName(decl.Name), t), nil
+	case *Record:
+		if !decl.Defined {
+			self.opaques = append(self.opaques, decl)
+			return fmt.Sprintf("pub type %s struct{}\n", decl.name), nil
+		}
+		body, err := self.genRecordBody(decl, "")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("pub type %s %s\n", decl.name, body), nil
+	case *Enum:
+		var buf strings.Builder
+		typ := "c::int"
+		if decl.name != "" {
+			typ = decl.name
+			buf.WriteString(fmt.Sprintf("pub type %s %s\n", decl.name, enumBaseType(decl)))
+		}
+		for _, c := range decl.Consts {
+			buf.WriteString(fmt.Sprintf("pub let %s: %s = %d\n", simName(c.Name), typ, c.Value))
+		}
+		return buf.String(), nil
+	case *Macro:
+		var typ string
+		switch {
+		case decl.Value >= math.MinInt32 && decl.Value <= math.MaxInt32:
+			typ = "c::int"
+		default:
+			typ = "c::long"
+		}
+		return fmt.Sprintf("pub let %s: %s = %d\n", simName(decl.Name), typ, decl.Value), nil
+	case *Variable:
+		if simReserved[decl.Name] {
+			return "", fmt.Errorf("`%s` is a keyword", decl.Name)
+		}
+		t, err := self.genType(decl.Type, "")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("@extern(%s)\npub let %s: %s\n", decl.Name, decl.Name, t), nil
+	case *Function:
+		if simReserved[decl.Name] {
+			return "", fmt.Errorf("`%s` is a keyword", decl.Name)
+		}
+		return self.genFunction(decl)
+	default:
+		panic("unknown decl")
+	}
+}
+
+// 枚举底层类型
+func enumBaseType(e *Enum) string {
+	for _, c := range e.Consts {
+		if c.Value > math.MaxInt32 {
+			return "c::unsigned_int"
+		}
+	}
+	return "c::int"
+}
+
+// 函数
+func (self *generator) genFunction(f *Function) (string, error) {
+	var buf strings.Builder
+	params, err := self.genParams(f.Type, true)
+	if err != nil {
+		return "", err
+	}
+	ret, err := self.genType(f.Type.Ret, "")
+	if err != nil {
+		return "", err
+	}
+	buf.WriteString(fmt.Sprintf("@extern(%s)\n", f.Name))
+	for _, lib := range self.libs {
+		buf.WriteString(fmt.Sprintf("@link(lib=\"%s\")\n", lib))
+	}
+	buf.WriteString(fmt.Sprintf("pub func %s(%s)%s\n", f.Name, params, ret))
+	return buf.String(), nil
+}
+
+// 参数列表
+func (self *generator) genParams(f *FuncType, named bool) (string, error) {
+	names := make(map[string]bool)
+	params := make([]string, 0, len(f.Params)+1)
+	for i, p := range f.Params {
+		t, err := self.genType(p.Type, "")
+		if err != nil {
+			return "", err
+		}
+		if !named {
+			params = append(params, t)
+			continue
+		}
+		name := simName(p.Name)
+		if name == "" || names[name] {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		names[name] = true
+		params = append(params, fmt.Sprintf("%s: %s", name, t))
+	}
+	if f.Variadic {
+		params = append(params, "...")
+	}
+	return strings.Join(params, ", "), nil
+}
+
+// 结构体
+func (self *generator) genRecordBody(r *Record, indent string) (string, error) {
+	var buf strings.Builder
+	if r.Union {
+		buf.WriteString("union{\n")
+	} else {
+		buf.WriteString("struct{\n")
+	}
+	var anon int
+	for _, f := range r.Fields {
+		if f.BitWidth == 0 {
+			return "", errors.New("zero-width bitfield is not supported")
+		}
+		t, err := self.genType(f.Type, indent+"    ")
+		if err != nil {
+			return "", err
+		}
+		name := simName(f.Name)
+		if name == "" {
+			name = fmt.Sprintf("anon%d", anon)
+			anon++
+		}
+		if f.BitWidth > 0 {
+			if t == "bool" {
+				return "", errors.New("bool bitfield is not supported")
+			}
+			buf.WriteString(fmt.Sprintf("%s    pub %s: %s: %d\n", indent, name, t, f.BitWidth))
+		} else {
+			buf.WriteString(fmt.Sprintf("%s    pub %s: %s\n", indent, name, t))
+		}
+	}
+	buf.WriteString(indent + "}")
+	return buf.String(), nil
+}
+
+// 类型
+func (self *generator) genType(t CType, indent string) (string, error) {
+	switch typ := t.(type) {
+	case *Basic:
+		if typ.Name == "void" {
+			return "", nil
+		}
+		if s, ok := basicTypes[typ.Name]; ok {
+			return s, nil
+		}
+		return "", fmt.Errorf("type `%s` is not supported", typ.Name)
+	case *Named:
+		if s, ok := builtinTypes[typ.Name]; ok {
+			return s, nil
+		}
+		td, ok := self.typedefs[typ.Name]
+		if !ok {
+			return "", fmt.Errorf("unknown type `%s`", typ.Name)
+		}
+		if err := self.require(td); err != nil {
+			return "", err
+		}
+		if self.merged[td] {
+			switch dst := td.Type.(type) {
+			case *Record:
+				return dst.name, nil
+			case *Enum:
+				return dst.name, nil
+			}
+		}
+		return simName(typ.Name), nil
+	case *Record:
+		if typ.name == "" {
+			// 匿名结构体
+			return self.genRecordBody(typ, indent)
+		}
+		if err := self.require(typ); err != nil {
+			return "", err
+		}
+		return typ.name, nil
+	case *Enum:
+		if typ.name == "" {
+			return "c::int", nil
+		}
+		if err := self.require(typ); err != nil {
+			return "", err
+		}
+		return typ.name, nil
+	case *Array:
+		elem, err := self.genType(typ.Elem, indent)
+		if err != nil {
+			return "", err
+		}
+		size := typ.Size
+		if size < 0 {
+			size = 0
+		}
+		return fmt.Sprintf("[%d]%s", size, elem), nil
+	case *FuncType:
+		params, err := self.genParams(typ, false)
+		if err != nil {
+			return "", err
+		}
+		ret, err := self.genType(typ.Ret, indent)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("func(%s)%s", params, ret), nil
+	case *Pointer:
+		switch elem := typ.Elem.(type) {
+		case *Basic:
+			if elem.Name == "void" {
+				return "c::voidptr", nil
+			}
+		case *FuncType:
+			// Sim的函数类型本身就是指针
+			return self.genType(elem, indent)
+		case *Named:
+			if self.funcTypedefs[elem.Name] {
+				return self.genType(elem, indent)
+			}
+		}
+		elem, err := self.genType(typ.Elem, indent)
+		if err != nil {
+			// 指向不支持类型的指针退化为void*
+			return "c::voidptr", nil
+		}
+		return "*" + elem, nil
+	default:
+		panic("unknown type")
+	}
+}
+
+// 生成
+func (self *generator) generate(header string) string {
+	self.assignNames()
+
+	// 目标头文件中的声明
+	var roots []Decl
+	values := make(map[string]bool)
+	for _, d := range self.p.decls {
+		if d.file() != self.target {
+			continue
+		}
+		switch decl := d.(type) {
+		case *Function:
+			if values[decl.Name] {
+				continue
+			}
+			values[decl.Name] = true
+		case *Variable:
+			if values[decl.Name] {
+				continue
+			}
+			values[decl.Name] = true
+		case *Enum:
+			for _, c := range decl.Consts {
+				values[c.Name] = true
+			}
+		case *Typedef:
+			if _, ok := builtinTypes[decl.Name]; ok || self.typedefs[decl.Name] != decl {
+				continue
+			}
+		}
+		roots = append(roots, d)
+	}
+	for _, m := range self.p.macros {
+		if m.File != self.target || values[m.Name] {
+			continue
+		}
+		values[m.Name] = true
+		roots = append(roots, m)
+	}
+
+	var unsupported []string
+	for _, d := range roots {
+		if err := self.require(d); err != nil {
+			unsupported = append(unsupported, fmt.Sprintf("%s: %s", declName(d), err))
+		}
+	}
+
+	// 按类别和源码顺序输出
+	order := make(map[Decl]int)
+	for i, d := range self.p.decls {
+		order[d] = i
+	}
+	for i, d := range self.p.macros {
+		order[d] = len(self.p.decls) + i
+	}
+	for i, r := range self.opaques {
+		order[r] = -len(self.opaques) + i
+	}
+	var types, consts, vars, funcs []Decl
+	for d, st := range self.states {
+		if st.err != nil || st.text == "" {
+			continue
+		}
+		switch d.(type) {
+		case *Typedef, *Record:
+			types = append(types, d)
+		case *Enum:
+			if d.(*Enum).name != "" {
+				types = append(types, d)
+			} else {
+				consts = append(consts, d)
+			}
+		case *Macro:
+			consts = append(consts, d)
+		case *Variable:
+			vars = append(vars, d)
+		case *Function:
+			funcs = append(funcs, d)
+		}
+	}
+
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("// 由 sim bindgen 从 %s 生成，请勿手动修改\n\n", header))
+	buf.WriteString("import std.c\n")
+	for _, group := range [][]Decl{types, consts, vars, funcs} {
+		sort.Slice(group, func(i, j int) bool {
+			return order[group[i]] < order[group[j]]
+		})
+		for _, d := range group {
+			buf.WriteByte('\n')
+			buf.WriteString(self.states[d].text)
+		}
+	}
+	if len(unsupported) > 0 {
+		buf.WriteString("\n// 以下声明暂不支持：\n")
+		for _, s := range unsupported {
+			buf.WriteString("// " + s + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// 声明名
+func declName(d Decl) string {
+	switch decl := d.(type) {
+	case *Typedef:
+		return decl.Name
+	case *Record:
+		if decl.Union {
+			return "union " + decl.Tag
+		}
+		return "struct " + decl.Tag
+	case *Enum:
+		return "enum " + decl.Tag
+	case *Macro:
+		return decl.Name
+	case *Variable:
+		return decl.Name
+	case *Function:
+		return decl.Name
+	default:
+		panic("unknown decl")
+	}
+}
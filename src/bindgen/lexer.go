@@ -0,0 +1,259 @@
+package bindgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// token类型
+type tokenKind uint8
+
+const (
+	tokEOF    tokenKind = iota // 结束符
+	tokIdent                   // 标识符
+	tokNumber                  // 数字
+	tokString                  // 字符串
+	tokChar                    // 字符
+	tokPunct                   // 符号
+)
+
+// token
+type token struct {
+	Kind   tokenKind
+	Source string
+	File   string // 来源文件
+	Line   uint   // 来源行数
+}
+
+func (self token) String() string {
+	return fmt.Sprintf("%s:%d: `%s`", self.File, self.Line, self.Source)
+}
+
+// 宏定义
+type macroDef struct {
+	Name string
+	Body string
+	File string
+	Line uint
+}
+
+// 多字符符号，长的在前
+var puncts = []string{
+	"...", "<<=", ">>=",
+	"->", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "##",
+}
+
+// 词法分析器
+// 同时支持原始头文件和带行标记（# 1 "file"）的预处理输出
+type lexer struct {
+	src    string
+	pos    int
+	file   string
+	line   uint
+	bol    bool // 是否在行首
+	macros []macroDef
+}
+
+func newLexer(file, src string) *lexer {
+	return &lexer{
+		src:  src,
+		file: file,
+		line: 1,
+		bol:  true,
+	}
+}
+
+// 词法分析所有token
+func tokenize(file, src string) ([]token, []macroDef) {
+	l := newLexer(file, src)
+	var toks []token
+	for {
+		tok := l.scan()
+		toks = append(toks, tok)
+		if tok.Kind == tokEOF {
+			break
+		}
+	}
+	return toks, l.macros
+}
+
+func (self *lexer) peekByte(n int) byte {
+	if self.pos+n >= len(self.src) {
+		return 0
+	}
+	return self.src[self.pos+n]
+}
+
+// 跳过空白和注释
+func (self *lexer) skipSpace() {
+	for self.pos < len(self.src) {
+		c := self.src[self.pos]
+		switch {
+		case c == '\n':
+			self.line++
+			self.bol = true
+			self.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			self.pos++
+		case c == '\\' && self.peekByte(1) == '\n':
+			self.line++
+			self.pos += 2
+		case c == '/' && self.peekByte(1) == '/':
+			for self.pos < len(self.src) && self.src[self.pos] != '\n' {
+				self.pos++
+			}
+		case c == '/' && self.peekByte(1) == '*':
+			self.pos += 2
+			for self.pos < len(self.src) && !(self.src[self.pos] == '*' && self.peekByte(1) == '/') {
+				if self.src[self.pos] == '\n' {
+					self.line++
+				}
+				self.pos++
+			}
+			self.pos += 2
+		case c == '#' && self.bol:
+			self.scanDirective()
+		default:
+			return
+		}
+	}
+}
+
+// 预处理指令（整行）
+func (self *lexer) scanDirective() {
+	line := self.line
+	var buf strings.Builder
+	self.pos++
+	for self.pos < len(self.src) && self.src[self.pos] != '\n' {
+		c := self.src[self.pos]
+		if c == '\\' && self.peekByte(1) == '\n' {
+			buf.WriteByte(' ')
+			self.pos += 2
+			self.line++
+			continue
+		} else if c == '/' && self.peekByte(1) == '*' {
+			self.pos += 2
+			for self.pos < len(self.src) && !(self.src[self.pos] == '*' && self.peekByte(1) == '/') {
+				if self.src[self.pos] == '\n' {
+					self.line++
+				}
+				self.pos++
+			}
+			self.pos += 2
+			buf.WriteByte(' ')
+			continue
+		} else if c == '/' && self.peekByte(1) == '/' {
+			for self.pos < len(self.src) && self.src[self.pos] != '\n' {
+				self.pos++
+			}
+			break
+		}
+		buf.WriteByte(c)
+		self.pos++
+	}
+	directive := strings.TrimSpace(buf.String())
+
+	// 行标记：# 12 "file" flags / #line 12 "file"
+	fields := strings.Fields(directive)
+	if len(fields) > 0 && fields[0] == "line" {
+		fields = fields[1:]
+	}
+	if len(fields) > 0 {
+		if n, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			// 行标记描述的是下一行
+			self.line = uint(n) - 1
+			if len(fields) > 1 {
+				if file, err := strconv.Unquote(fields[1]); err == nil {
+					self.file = file
+				}
+			}
+			return
+		}
+	}
+
+	if !strings.HasPrefix(directive, "define") {
+		return
+	}
+	rest := strings.TrimLeft(directive[len("define"):], " \t")
+	end := 0
+	for end < len(rest) && isIdentByte(rest[end], end != 0) {
+		end++
+	}
+	if end == 0 || (end < len(rest) && rest[end] == '(') {
+		// 函数宏不处理
+		return
+	}
+	self.macros = append(self.macros, macroDef{
+		Name: rest[:end],
+		Body: strings.TrimSpace(rest[end:]),
+		File: self.file,
+		Line: line,
+	})
+}
+
+func isIdentByte(c byte, notFirst bool) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (notFirst && c >= '0' && c <= '9')
+}
+
+// 扫描
+func (self *lexer) scan() token {
+	self.skipSpace()
+	self.bol = false
+	tok := token{File: self.file, Line: self.line}
+	if self.pos >= len(self.src) {
+		tok.Kind = tokEOF
+		return tok
+	}
+
+	begin := self.pos
+	c := self.src[self.pos]
+	switch {
+	case isIdentByte(c, false):
+		for self.pos < len(self.src) && isIdentByte(self.src[self.pos], true) {
+			self.pos++
+		}
+		tok.Kind = tokIdent
+	case c >= '0' && c <= '9' || (c == '.' && self.peekByte(1) >= '0' && self.peekByte(1) <= '9'):
+		for self.pos < len(self.src) {
+			c := self.src[self.pos]
+			if isIdentByte(c, true) || c == '.' {
+				self.pos++
+			} else if (c == '+' || c == '-') && strings.ContainsRune("eEpP", rune(self.src[self.pos-1])) && !strings.HasPrefix(self.src[begin:], "0x") {
+				self.pos++
+			} else {
+				break
+			}
+		}
+		tok.Kind = tokNumber
+	case c == '"' || c == '\'':
+		self.pos++
+		for self.pos < len(self.src) && self.src[self.pos] != c && self.src[self.pos] != '\n' {
+			if self.src[self.pos] == '\\' {
+				self.pos++
+			}
+			self.pos++
+		}
+		self.pos++
+		tok.Kind = tokString
+		if c == '\'' {
+			tok.Kind = tokChar
+		}
+	default:
+		tok.Kind = tokPunct
+		for _, p := range puncts {
+			if strings.HasPrefix(self.src[self.pos:], p) {
+				self.pos += len(p)
+				tok.Source = p
+				return tok
+			}
+		}
+		self.pos++
+	}
+	if self.pos > len(self.src) {
+		self.pos = len(self.src)
+	}
+	tok.Source = self.src[begin:self.pos]
+	return tok
+}
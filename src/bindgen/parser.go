@@ -0,0 +1,682 @@
+package bindgen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 语法错误
+type parseError struct {
+	Tok token
+	Msg string
+}
+
+func (self parseError) Error() string {
+	return fmt.Sprintf("%s: %s", self.Tok, self.Msg)
+}
+
+// 声明说明符
+type specifiers struct {
+	Typedef bool
+	Extern  bool
+	Static  bool
+	Base    CType
+}
+
+// C声明语法分析器
+type parser struct {
+	toks []token
+	pos  int
+
+	typedefs map[string]CType   // 已知类型定义
+	records  map[string]*Record // 结构体/联合体标签
+	enums    map[string]*Enum   // 枚举标签
+	consts   map[string]int64   // 枚举常量
+	decls    []Decl
+	macros   []*Macro
+}
+
+func newParser(toks []token) *parser {
+	return &parser{
+		toks:     toks,
+		typedefs: make(map[string]CType),
+		records:  make(map[string]*Record),
+		enums:    make(map[string]*Enum),
+		consts:   make(map[string]int64),
+	}
+}
+
+func (self *parser) peek() token {
+	return self.toks[self.pos]
+}
+
+func (self *parser) peekN(n int) token {
+	if self.pos+n >= len(self.toks) {
+		return self.toks[len(self.toks)-1]
+	}
+	return self.toks[self.pos+n]
+}
+
+func (self *parser) next() token {
+	tok := self.toks[self.pos]
+	if tok.Kind != tokEOF {
+		self.pos++
+	}
+	return tok
+}
+
+func (self *parser) is(s string) bool {
+	tok := self.peek()
+	return (tok.Kind == tokPunct || tok.Kind == tokIdent) && tok.Source == s
+}
+
+func (self *parser) skipIs(s string) bool {
+	if self.is(s) {
+		self.next()
+		return true
+	}
+	return false
+}
+
+func (self *parser) expect(s string) token {
+	if !self.is(s) {
+		self.throwErrorf("expect `%s`", s)
+	}
+	return self.next()
+}
+
+func (self *parser) throwErrorf(f string, a ...any) {
+	panic(&parseError{
+		Tok: self.peek(),
+		Msg: fmt.Sprintf(f, a...),
+	})
+}
+
+// 跳过成对的括号（当前token为左括号）
+func (self *parser) skipBalanced() {
+	open := self.next().Source
+	close := map[string]string{"(": ")", "[": "]", "{": "}"}[open]
+	depth := 1
+	for depth > 0 {
+		tok := self.next()
+		switch {
+		case tok.Kind == tokEOF:
+			return
+		case tok.Kind == tokPunct && tok.Source == open:
+			depth++
+		case tok.Kind == tokPunct && tok.Source == close:
+			depth--
+		}
+	}
+}
+
+// 跳过到声明结尾
+func (self *parser) skipDecl() {
+	for {
+		tok := self.peek()
+		switch {
+		case tok.Kind == tokEOF:
+			return
+		case tok.Kind == tokPunct && tok.Source == ";":
+			self.next()
+			return
+		case tok.Kind == tokPunct && (tok.Source == "(" || tok.Source == "["):
+			self.skipBalanced()
+		case tok.Kind == tokPunct && tok.Source == "{":
+			self.skipBalanced()
+			if !self.is(";") && !self.is(",") && self.peek().Kind != tokIdent && !self.is("*") {
+				// 函数体
+				return
+			}
+		default:
+			self.next()
+		}
+	}
+}
+
+// 跳过GNU扩展（__attribute__ / __asm__ / __declspec）
+func (self *parser) skipExtensions() bool {
+	var skipped bool
+	for {
+		switch self.peek().Source {
+		case "__attribute__", "__attribute", "__declspec", "__asm__", "__asm", "asm":
+			self.next()
+			if self.is("(") {
+				self.skipBalanced()
+			}
+			skipped = true
+		case "__extension__", "__restrict", "__restrict__", "restrict", "const", "__const", "volatile", "__volatile__", "_Nullable", "_Nonnull", "__inline", "__inline__", "inline", "_Noreturn", "__wur":
+			self.next()
+			skipped = true
+		default:
+			return skipped
+		}
+	}
+}
+
+// Parse 语法分析
+func (self *parser) parse() {
+	for self.peek().Kind != tokEOF {
+		if self.skipIs(";") || self.skipIs("}") {
+			continue
+		}
+		// extern "C" {
+		if self.is("extern") && self.peekN(1).Kind == tokString {
+			self.next()
+			self.next()
+			self.skipIs("{")
+			continue
+		}
+		self.parseExternalDecl()
+	}
+}
+
+// 外部声明，出错时跳过该声明
+func (self *parser) parseExternalDecl() {
+	begin := self.pos
+	defer func() {
+		if ea := recover(); ea != nil {
+			if _, ok := ea.(*parseError); !ok {
+				panic(ea)
+			}
+			if self.pos == begin {
+				self.next()
+			}
+			self.skipDecl()
+		}
+	}()
+
+	if self.is("_Static_assert") || self.is("static_assert") {
+		self.skipDecl()
+		return
+	}
+
+	file := self.peek().File
+	spec := self.parseSpecifiers()
+	if self.skipIs(";") {
+		return
+	}
+	for {
+		name, wrap := self.parseDeclarator()
+		self.skipExtensions()
+		typ := wrap(spec.Base)
+		if name == "" {
+			self.throwErrorf("expect a name")
+		}
+
+		switch {
+		case spec.Typedef:
+			self.typedefs[name] = typ
+			self.decls = append(self.decls, &Typedef{Name: name, Type: typ, File: file})
+		case isFuncType(typ):
+			if self.is("{") {
+				// 函数定义（通常是static inline），跳过
+				self.skipBalanced()
+				return
+			}
+			if !spec.Static {
+				self.decls = append(self.decls, &Function{Name: name, Type: typ.(*FuncType), File: file})
+			}
+		default:
+			if self.skipIs("=") {
+				for !self.is(",") && !self.is(";") && self.peek().Kind != tokEOF {
+					if self.is("(") || self.is("{") || self.is("[") {
+						self.skipBalanced()
+					} else {
+						self.next()
+					}
+				}
+			}
+			if !spec.Static {
+				self.decls = append(self.decls, &Variable{Name: name, Type: typ, File: file})
+			}
+		}
+
+		if !self.skipIs(",") {
+			break
+		}
+	}
+	self.expect(";")
+}
+
+func isFuncType(t CType) bool {
+	_, ok := t.(*FuncType)
+	return ok
+}
+
+// 是否是类型的开始
+func (self *parser) isTypeStart(tok token) bool {
+	if tok.Kind != tokIdent {
+		return false
+	}
+	switch tok.Source {
+	case "void", "char", "short", "int", "long", "float", "double", "signed", "unsigned", "__signed__", "_Bool",
+		"struct", "union", "enum", "const", "volatile", "__const", "__extension__", "_Complex", "__int128", "__typeof__", "typeof",
+		"_Float16", "_Float32", "_Float64", "_Float128", "_Float32x", "_Float64x", "__float128", "__builtin_va_list":
+		return true
+	}
+	_, ok := self.typedefs[tok.Source]
+	return ok || builtinTypes[tok.Source] != ""
+}
+
+// 声明说明符
+func (self *parser) parseSpecifiers() specifiers {
+	var spec specifiers
+	var words []string
+	for {
+		if self.skipExtensions() {
+			continue
+		}
+		tok := self.peek()
+		if tok.Kind != tokIdent {
+			break
+		}
+		switch tok.Source {
+		case "typedef":
+			spec.Typedef = true
+		case "extern":
+			spec.Extern = true
+		case "static":
+			spec.Static = true
+		case "register", "auto", "_Thread_local", "__thread":
+		case "void", "char", "short", "int", "long", "float", "double", "signed", "unsigned", "__signed__", "_Bool", "_Complex", "__int128",
+			"_Float16", "_Float32", "_Float64", "_Float128", "_Float32x", "_Float64x", "__float128":
+			if spec.Base != nil {
+				self.throwErrorf("unexpected type specifier")
+			}
+			words = append(words, tok.Source)
+		case "__builtin_va_list":
+			spec.Base = &Basic{Name: tok.Source}
+		case "struct", "union":
+			self.next()
+			spec.Base = self.parseRecord(tok.Source == "union", tok.File)
+			continue
+		case "enum":
+			self.next()
+			spec.Base = self.parseEnum(tok.File)
+			continue
+		case "__typeof__", "typeof", "__typeof":
+			self.throwErrorf("unsupported typeof")
+		default:
+			if spec.Base != nil || len(words) > 0 {
+				goto end
+			}
+			spec.Base = &Named{Name: tok.Source}
+		}
+		self.next()
+	}
+end:
+	if len(words) > 0 {
+		spec.Base = &Basic{Name: canonicalBasic(words)}
+	}
+	if spec.Base == nil {
+		self.throwErrorf("expect a type")
+	}
+	return spec
+}
+
+// 规范化基础类型名
+func canonicalBasic(words []string) string {
+	var signed, unsigned, char, short, int_, complex bool
+	var long int
+	var other string
+	for _, w := range words {
+		switch w {
+		case "signed", "__signed__":
+			signed = true
+		case "unsigned":
+			unsigned = true
+		case "char":
+			char = true
+		case "short":
+			short = true
+		case "int":
+			int_ = true
+		case "long":
+			long++
+		case "_Complex":
+			complex = true
+		default:
+			other = w
+		}
+	}
+	var name string
+	switch {
+	case other == "double" && long > 0:
+		name = "long double"
+	case other != "":
+		name = other
+	case char:
+		name = "char"
+		if signed {
+			name = "signed char"
+		}
+	case short:
+		name = "short"
+	case long == 1:
+		name = "long"
+	case long >= 2:
+		name = "long long"
+	default:
+		_ = int_
+		name = "int"
+	}
+	if unsigned {
+		name = "unsigned " + name
+	}
+	if complex {
+		name = "_Complex " + name
+	}
+	return name
+}
+
+// 结构体或联合体
+func (self *parser) parseRecord(union bool, file string) CType {
+	self.skipExtensions()
+	var tag string
+	if self.peek().Kind == tokIdent {
+		tag = self.next().Source
+	}
+	self.skipExtensions()
+
+	var record *Record
+	if tag != "" {
+		record = self.records[tag]
+	}
+	if record == nil || (self.is("{") && record.Defined) {
+		record = &Record{Tag: tag, Union: union, File: file}
+		if tag != "" {
+			self.records[tag] = record
+		}
+	}
+	if !self.skipIs("{") {
+		if tag == "" {
+			self.throwErrorf("expect a tag")
+		}
+		return record
+	}
+
+	record.Defined = true
+	record.File = file
+	record.Union = union
+	if tag != "" {
+		self.decls = append(self.decls, record)
+	}
+	for !self.skipIs("}") {
+		if self.peek().Kind == tokEOF {
+			self.throwErrorf("expect `}`")
+		}
+		if self.skipIs(";") {
+			continue
+		}
+		if self.is("_Static_assert") {
+			self.skipDecl()
+			continue
+		}
+		spec := self.parseSpecifiers()
+		if self.skipIs(";") {
+			// 匿名成员
+			record.Fields = append(record.Fields, &Field{Type: spec.Base, BitWidth: -1})
+			continue
+		}
+		for {
+			field := &Field{BitWidth: -1}
+			if self.is(":") {
+				field.Type = spec.Base
+			} else {
+				name, wrap := self.parseDeclarator()
+				field.Name, field.Type = name, wrap(spec.Base)
+			}
+			if self.skipIs(":") {
+				field.BitWidth = self.parseConstExpr(",", ";")
+			}
+			self.skipExtensions()
+			record.Fields = append(record.Fields, field)
+			if !self.skipIs(",") {
+				break
+			}
+		}
+		self.expect(";")
+	}
+	self.skipExtensions()
+	return record
+}
+
+// 枚举
+func (self *parser) parseEnum(file string) CType {
+	self.skipExtensions()
+	var tag string
+	if self.peek().Kind == tokIdent {
+		tag = self.next().Source
+	}
+	self.skipExtensions()
+
+	enum := self.enums[tag]
+	if enum == nil || tag == "" {
+		enum = &Enum{Tag: tag, File: file}
+		if tag != "" {
+			self.enums[tag] = enum
+		}
+	}
+	if !self.skipIs("{") {
+		if tag == "" {
+			self.throwErrorf("expect a tag")
+		}
+		return enum
+	}
+
+	enum.Defined = true
+	enum.File = file
+	self.decls = append(self.decls, enum)
+	var value int64
+	for !self.skipIs("}") {
+		if self.peek().Kind != tokIdent {
+			self.throwErrorf("expect a enumerator")
+		}
+		name := self.next().Source
+		self.skipExtensions()
+		if self.skipIs("=") {
+			value = self.parseConstExpr(",", "}")
+		}
+		enum.Consts = append(enum.Consts, &EnumConst{Name: name, Value: value})
+		self.consts[name] = value
+		value++
+		if !self.skipIs(",") {
+			self.expect("}")
+			break
+		}
+	}
+	self.skipExtensions()
+	return enum
+}
+
+// 常量表达式（到指定符号为止，不包含在括号内的）
+func (self *parser) parseConstExpr(ends ...string) int64 {
+	var toks []token
+	depth := 0
+	for {
+		tok := self.peek()
+		if tok.Kind == tokEOF {
+			break
+		}
+		if depth == 0 && tok.Kind == tokPunct {
+			var stop bool
+			for _, e := range ends {
+				if tok.Source == e {
+					stop = true
+				}
+			}
+			if stop || tok.Source == ")" || tok.Source == "]" {
+				break
+			}
+		}
+		switch tok.Source {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		}
+		toks = append(toks, self.next())
+	}
+	v, err := evalConstExpr(toks, func(name string) (int64, bool) {
+		v, ok := self.consts[name]
+		return v, ok
+	}, self.isTypeStart)
+	if err != nil {
+		self.throwErrorf("%s", err)
+	}
+	return v
+}
+
+// 声明符
+// 返回名字和从基础类型构造完整类型的函数
+func (self *parser) parseDeclarator() (string, func(CType) CType) {
+	var ptrs int
+	for {
+		if self.skipIs("*") {
+			ptrs++
+		} else if !self.skipExtensions() {
+			break
+		}
+	}
+
+	var name string
+	inner := func(t CType) CType { return t }
+	if self.is("(") && self.isGrouping() {
+		self.next()
+		name, inner = self.parseDeclarator()
+		self.expect(")")
+	} else if self.peek().Kind == tokIdent && !self.isTypeStart(self.peek()) {
+		name = self.next().Source
+	}
+
+	var suffixes []func(CType) CType
+	for {
+		self.skipExtensions()
+		if self.skipIs("[") {
+			size := int64(-1)
+			for self.skipIs("static") || self.skipExtensions() {
+			}
+			if !self.is("]") {
+				size = self.parseConstExpr("]")
+			}
+			self.expect("]")
+			suffixes = append(suffixes, func(t CType) CType {
+				return &Array{Size: size, Elem: t}
+			})
+		} else if self.is("(") {
+			params, variadic := self.parseParams()
+			suffixes = append(suffixes, func(t CType) CType {
+				return &FuncType{Ret: t, Params: params, Variadic: variadic}
+			})
+		} else {
+			break
+		}
+	}
+
+	return name, func(t CType) CType {
+		for i := 0; i < ptrs; i++ {
+			t = &Pointer{Elem: t}
+		}
+		for i := len(suffixes) - 1; i >= 0; i-- {
+			t = suffixes[i](t)
+		}
+		return inner(t)
+	}
+}
+
+// 左括号是否是声明符分组（而不是参数列表）
+func (self *parser) isGrouping() bool {
+	tok := self.peekN(1)
+	switch {
+	case tok.Kind == tokPunct:
+		return tok.Source == "*" || tok.Source == "(" || tok.Source == "^"
+	case tok.Kind == tokIdent:
+		switch tok.Source {
+		case "__attribute__", "__attribute", "__declspec":
+			return true
+		}
+		return !self.isTypeStart(tok)
+	default:
+		return false
+	}
+}
+
+// 参数列表
+func (self *parser) parseParams() ([]*Param, bool) {
+	self.expect("(")
+	if self.skipIs(")") {
+		return nil, false
+	}
+	if self.is("void") && self.peekN(1).Source == ")" {
+		self.next()
+		self.next()
+		return nil, false
+	}
+	var params []*Param
+	var variadic bool
+	for {
+		if self.skipIs("...") {
+			variadic = true
+			break
+		}
+		spec := self.parseSpecifiers()
+		name, wrap := self.parseDeclarator()
+		typ := wrap(spec.Base)
+		// 数组和函数参数退化为指针
+		switch t := typ.(type) {
+		case *Array:
+			typ = &Pointer{Elem: t.Elem}
+		case *FuncType:
+			typ = &Pointer{Elem: t}
+		}
+		params = append(params, &Param{Name: name, Type: typ})
+		if !self.skipIs(",") {
+			break
+		}
+	}
+	self.expect(")")
+	return params, variadic
+}
+
+// 宏定义的值
+func (self *parser) evalMacros(defs []macroDef) {
+	bodies := make(map[string]string, len(defs))
+	for _, d := range defs {
+		bodies[d.Name] = d.Body
+	}
+	values := make(map[string]int64)
+	visiting := make(map[string]bool)
+
+	var lookup func(name string) (int64, bool)
+	lookup = func(name string) (int64, bool) {
+		if v, ok := values[name]; ok {
+			return v, true
+		}
+		if v, ok := self.consts[name]; ok {
+			return v, true
+		}
+		body, ok := bodies[name]
+		if !ok || visiting[name] {
+			return 0, false
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+		toks, _ := tokenize("", body)
+		v, err := evalConstExpr(toks[:len(toks)-1], lookup, self.isTypeStart)
+		if err != nil {
+			return 0, false
+		}
+		values[name] = v
+		return v, true
+	}
+
+	for _, d := range defs {
+		if d.Body == "" || strings.HasPrefix(d.Name, "__") {
+			continue
+		}
+		if v, ok := lookup(d.Name); ok {
+			self.macros = append(self.macros, &Macro{Name: d.Name, Value: v, File: d.File})
+		}
+	}
+}
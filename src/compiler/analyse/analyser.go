@@ -13,7 +13,11 @@ import (
 
 // AnalyseMain 作为主包进行语义分析
 func AnalyseMain(ast *parse.Package) (*ProgramContext, error) {
-	ctx := newProgramContext()
+	rootPath, err := utils.GetRootPath()
+	if err != nil {
+		return nil, err
+	}
+	ctx := newProgramContext(ast.Path, rootPath)
 	// 包
 	pkgCtx := newPackageContext(ctx, ast.Path)
 	ctx.importedPackageSet[ast.Path] = pkgCtx
@@ -41,7 +45,12 @@ func analyseNoMain(ctx *packageContext, ast *parse.Package) error {
 			for _, p := range importAst.Packages {
 				pkgPath = pkgPath.Join(stlos.Path(p.Source))
 			}
-			pkgPath = rootPath.Join(pkgPath)
+			// 优先查找标准库目录，找不到时再查找当前包目录，本地包不会遮蔽标准库
+			if stdPath := rootPath.Join(pkgPath); stdPath.IsExist() {
+				pkgPath = stdPath
+			} else {
+				pkgPath = ctx.path.Join(pkgPath)
+			}
 			if !pkgPath.IsExist() {
 				return utils.Errorf(importAst.Position(), "unknown package `%s`", pkgPath)
 			}
@@ -104,12 +113,13 @@ func analyseNoMain(ctx *packageContext, ast *parse.Package) error {
 
 // 包
 func analysePackage(ctx *packageContext, ast *parse.Package) utils.Error {
-	// 类型定义
-	for _, file := range ast.Files {
-		err := analysePackageTypeDef(ctx, file.Globals)
-		if err != nil {
-			return err
-		}
+	// 泛型类型定义
+	if err := analysePackageGenerics(ctx, ast); err != nil {
+		return err
+	}
+	// 类型定义，所有文件的类型定义先声明再解析，可以互相引用
+	if err := analysePackageTypeDef(ctx, ast); err != nil {
+		return err
 	}
 	// 变量声明
 	for _, file := range ast.Files {
@@ -125,26 +135,82 @@ func analysePackage(ctx *packageContext, ast *parse.Package) utils.Error {
 			return err
 		}
 	}
+	// 泛型类型实例的方法定义，分析过程中可能产生新的实例
+	for len(ctx.f.genericMethodDefs) > 0 {
+		def := ctx.f.genericMethodDefs[0]
+		ctx.f.genericMethodDefs = ctx.f.genericMethodDefs[1:]
+		if err := analyseMethodDef(def.First, def.Second); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// 包 泛型类型定义及其方法
+func analysePackageGenerics(ctx *packageContext, ast *parse.Package) utils.Error {
+	var errors []utils.Error
+	for _, file := range ast.Files {
+		for iter := file.Globals.Iterator(); iter.HasValue(); iter.Next() {
+			typedef, ok := iter.Value().(*parse.TypeDef)
+			if !ok || len(typedef.Params) == 0 {
+				continue
+			}
+			if _, ok := ctx.generics[typedef.Name.Source]; ok {
+				errors = append(errors, utils.Errorf(typedef.Name.Pos, "duplicate identifier"))
+				continue
+			}
+			ctx.generics[typedef.Name.Source] = types.NewPair(typedef.Public, newGenericTypedef(ctx, typedef))
+		}
+	}
+	for _, file := range ast.Files {
+		for iter := file.Globals.Iterator(); iter.HasValue(); iter.Next() {
+			method, ok := iter.Value().(*parse.Method)
+			if !ok || len(method.SelfParams) == 0 {
+				continue
+			}
+			g, ok := ctx.generics[method.Self.Source]
+			if !ok {
+				errors = append(errors, utils.Errorf(method.Self.Pos, "unknown generic type `%s`", method.Self.Source))
+			} else if len(method.SelfParams) != len(g.Second.ast.Params) {
+				errors = append(errors, utils.Errorf(method.Self.Pos, "expect %d type parameters but there is %d", len(g.Second.ast.Params), len(method.SelfParams)))
+			} else if method.Body == nil {
+				errors = append(errors, utils.Errorf(method.Name.Pos, "missing method body"))
+			} else {
+				g.Second.methods = append(g.Second.methods, method)
+			}
+		}
+	}
+	if len(errors) == 0 {
+		return nil
+	} else if len(errors) == 1 {
+		return errors[0]
+	} else {
+		return utils.NewMultiError(errors...)
+	}
+}
+
 // 包 类型定义
-func analysePackageTypeDef(ctx *packageContext, asts *list.SingleLinkedList[parse.Global]) utils.Error {
+func analysePackageTypeDef(ctx *packageContext, pkg *parse.Package) utils.Error {
 	var errors []utils.Error
 	typedefs := list.NewSingleLinkedList[*parse.TypeDef]()
 	// 定义
-	for iter := asts.Iterator(); iter.HasValue(); iter.Next() {
-		ast, ok := iter.Value().(*parse.TypeDef)
-		if !ok {
-			continue
-		}
-		if _, ok := ctx.typedefs[ast.Name.Source]; ok {
-			errors = append(errors, utils.Errorf(ast.Name.Pos, "duplicate identifier"))
-			continue
-		}
+	for _, file := range pkg.Files {
+		for iter := file.Globals.Iterator(); iter.HasValue(); iter.Next() {
+			ast, ok := iter.Value().(*parse.TypeDef)
+			if !ok || len(ast.Params) != 0 {
+				continue
+			}
+			if _, ok := ctx.typedefs[ast.Name.Source]; ok {
+				errors = append(errors, utils.Errorf(ast.Name.Pos, "duplicate identifier"))
+				continue
+			} else if _, ok := ctx.generics[ast.Name.Source]; ok {
+				errors = append(errors, utils.Errorf(ast.Name.Pos, "duplicate identifier"))
+				continue
+			}
 
-		ctx.typedefs[ast.Name.Source] = types.NewPair(ast.Public, NewTypedef(ctx.path, ast.Name.Source, nil))
-		typedefs.Add(ast)
+			ctx.typedefs[ast.Name.Source] = types.NewPair(ast.Public, NewTypedef(ctx.path, ast.Name.Source, nil))
+			typedefs.Add(ast)
+		}
 	}
 	if len(errors) == 1 {
 		return errors[0]
@@ -153,11 +219,15 @@ func analysePackageTypeDef(ctx *packageContext, asts *list.SingleLinkedList[pars
 	}
 	// 解析目标类型
 	for iter := typedefs.Iterator(); iter.HasValue(); iter.Next() {
+		td := ctx.typedefs[iter.Value().Name.Source].Second
 		dst, err := analyseType(ctx, iter.Value().Target)
+		if err == nil {
+			err = analyseTypeDefAttrs(td, dst, iter.Value().Attrs)
+		}
 		if err != nil {
 			errors = append(errors, err)
 		} else {
-			ctx.typedefs[iter.Value().Name.Source].Second.Dst = dst
+			td.Dst = dst
 		}
 	}
 	// 循环引用检测
@@ -188,6 +258,9 @@ func analysePackageVariableDecl(ctx *packageContext, asts *list.SingleLinkedList
 		case *parse.Function:
 			g, err = analyseFunctionDecl(ctx, global)
 		case *parse.Method:
+			if len(global.SelfParams) != 0 {
+				continue
+			}
 			g, err = analyseMethodDecl(ctx, global)
 		case *parse.GlobalValue:
 			g, err = analyseGlobalVariable(ctx, global)
@@ -222,6 +295,9 @@ func analysePackageVariableDef(ctx *packageContext, asts *list.SingleLinkedList[
 				errors = append(errors, err)
 			}
 		case *parse.Method:
+			if len(global.SelfParams) != 0 {
+				continue
+			}
 			if err := analyseMethodDef(ctx, global); err != nil {
 				errors = append(errors, err)
 			}
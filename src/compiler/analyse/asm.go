@@ -0,0 +1,168 @@
+package analyse
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/parse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+	"strings"
+)
+
+// Asm 内联汇编，模板中用%n引用第n个操作数（先输出后输入），%%为%，没有操作数时模板原样输出
+type Asm struct {
+	Template string
+	Outputs  []*AsmOperand
+	Inputs   []*AsmOperand
+	Clobbers []string
+	Intel    bool // 是否是intel语法，默认为at&t语法
+}
+
+func (self Asm) stmt() {}
+
+func (self Asm) GetType() Type {
+	return None
+}
+
+func (self Asm) GetMut() bool {
+	return false
+}
+
+func (self Asm) IsTemporary() bool {
+	return true
+}
+
+func (self Asm) IsConst() bool {
+	return false
+}
+
+// AsmOperand 内联汇编操作数
+type AsmOperand struct {
+	Constraint string // 约束，输出以=（只写）或者+（读写）开头
+	Value      Expr   // 输出和内存操作数为左值
+}
+
+// IsMemory 是否是内存操作数，传递的是地址
+func (self AsmOperand) IsMemory() bool {
+	return strings.TrimLeft(self.Constraint, "=+&") == "m"
+}
+
+// 内联汇编
+func analyseAsm(ctx *blockContext, ast *parse.Asm) (Expr, utils.Error) {
+	var errors []utils.Error
+	asm := &Asm{Template: ast.Template.Value}
+
+	for _, o := range ast.Outputs {
+		operand, err := analyseAsmOperand(ctx, o, true)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		asm.Outputs = append(asm.Outputs, operand)
+	}
+	for _, i := range ast.Inputs {
+		operand, err := analyseAsmOperand(ctx, i, false)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		asm.Inputs = append(asm.Inputs, operand)
+	}
+	for _, c := range ast.Clobbers {
+		if c.Value == "" || strings.ContainsAny(c.Value, "{}~,") {
+			errors = append(errors, utils.Errorf(c.Position(), "expect a register name, `cc` or `memory`"))
+			continue
+		}
+		asm.Clobbers = append(asm.Clobbers, c.Value)
+	}
+	dialect := ""
+	for _, opt := range ast.Options {
+		switch opt.Source {
+		case "att", "intel":
+			if dialect != "" {
+				errors = append(errors, utils.Errorf(opt.Pos, "duplicate assembly dialect"))
+			}
+			dialect = opt.Source
+			asm.Intel = opt.Source == "intel"
+		default:
+			errors = append(errors, utils.Errorf(opt.Pos, "expect one of `att`, `intel`"))
+		}
+	}
+	if count := len(ast.Outputs) + len(ast.Inputs); count != 0 {
+		if err := checkAsmTemplate(ast.Template, count); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	if len(errors) == 0 {
+		return asm, nil
+	} else if len(errors) == 1 {
+		return nil, errors[0]
+	} else {
+		return nil, utils.NewMultiError(errors...)
+	}
+}
+
+// 内联汇编操作数，只能是整数、浮点数、布尔值或者指针
+func analyseAsmOperand(ctx *blockContext, ast *parse.AsmOperand, output bool) (*AsmOperand, utils.Error) {
+	constraint := ast.Constraint.Value
+	isOutput := strings.HasPrefix(constraint, "=") || strings.HasPrefix(constraint, "+")
+	if output && !isOutput {
+		return nil, utils.Errorf(ast.Constraint.Position(), "output constraint must start with `=` or `+`")
+	} else if !output && isOutput {
+		return nil, utils.Errorf(ast.Constraint.Position(), "input constraint can not start with `=` or `+`")
+	} else if rest := strings.TrimLeft(constraint, "=+&"); rest == "" || strings.ContainsAny(rest, "=+*~,") {
+		return nil, utils.Errorf(ast.Constraint.Position(), "invalid constraint `%s`", constraint)
+	}
+
+	value, err := analyseExpr(ctx, nil, ast.Value)
+	if err != nil {
+		return nil, err
+	}
+	operand := &AsmOperand{Constraint: constraint, Value: value}
+	vt := value.GetType()
+	if !(IsNumberTypeAndSon(vt) || IsBoolTypeAndSon(vt) || IsPtrTypeAndSon(vt) || IsFuncTypeAndSon(vt)) {
+		return nil, utils.Errorf(ast.Value.Position(), "expect a integer, float, bool or pointer but there is `%s`", vt)
+	}
+	if output || operand.IsMemory() {
+		if value.IsTemporary() || !value.GetMut() {
+			return nil, utils.Errorf(ast.Value.Position(), "expect a mutable value")
+		} else if field, ok := value.(*GetField); ok && field.IsBitField() {
+			return nil, utils.Errorf(ast.Value.Position(), "can not take the address of a bit-field")
+		}
+	}
+	if (constraint == "i" || constraint == "n") && !value.IsConst() {
+		return nil, utils.Errorf(ast.Value.Position(), "expect a constant value")
+	}
+	return operand, nil
+}
+
+// 检查模板中引用的操作数，%后为可选的修饰字母和操作数下标
+func checkAsmTemplate(ast *parse.String, count int) utils.Error {
+	s := ast.Value
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(s) && s[i] == '%' {
+			continue
+		}
+		if i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+			i++
+		}
+		begin := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if begin == i {
+			return utils.Errorf(ast.Position(), "expect a operand index after `%%`, use `%%%%` for `%%`")
+		}
+		index := 0
+		for _, ch := range s[begin:i] {
+			index = index*10 + int(ch-'0')
+		}
+		if index >= count {
+			return utils.Errorf(ast.Position(), "operand index %d out of range, there are %d operands", index, count)
+		}
+		i--
+	}
+	return nil
+}
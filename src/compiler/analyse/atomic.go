@@ -0,0 +1,171 @@
+package analyse
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/parse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+)
+
+// AtomicOp 原子操作
+type AtomicOp uint8
+
+const (
+	AtomicLoad     AtomicOp = iota // atomic_load(ptr, order)
+	AtomicStore                    // atomic_store(ptr, value, order)
+	AtomicCas                      // atomic_cas(ptr, old, new, success[, failure])
+	AtomicFetchAdd                 // atomic_fetch_add(ptr, value, order)
+	AtomicFetchSub                 // atomic_fetch_sub(ptr, value, order)
+)
+
+// 内置函数名对应的原子操作
+var atomicOps = map[string]AtomicOp{
+	"atomic_load":      AtomicLoad,
+	"atomic_store":     AtomicStore,
+	"atomic_cas":       AtomicCas,
+	"atomic_fetch_add": AtomicFetchAdd,
+	"atomic_fetch_sub": AtomicFetchSub,
+}
+
+// AtomicOrdering 内存序，从弱到强
+type AtomicOrdering uint8
+
+const (
+	OrderingRelaxed AtomicOrdering = iota
+	OrderingAcquire
+	OrderingRelease
+	OrderingAcqRel
+	OrderingSeqCst
+)
+
+// 内存序参数为以下标识符
+var atomicOrderings = map[string]AtomicOrdering{
+	"relaxed": OrderingRelaxed,
+	"acquire": OrderingAcquire,
+	"release": OrderingRelease,
+	"acq_rel": OrderingAcqRel,
+	"seq_cst": OrderingSeqCst,
+}
+
+// Atomic 原子操作，Ptr指向整数（load、store和cas也可以是指针）
+type Atomic struct {
+	Op        AtomicOp
+	Ptr       Expr
+	Value     Expr // store、fetch_add和fetch_sub的值，cas的期待值
+	New       Expr // cas的新值
+	Order     AtomicOrdering
+	FailOrder AtomicOrdering // cas失败时的内存序
+}
+
+func (self Atomic) stmt() {}
+
+func (self Atomic) GetType() Type {
+	switch self.Op {
+	case AtomicStore:
+		return None
+	case AtomicCas:
+		return Bool
+	default:
+		return GetBaseType(self.Ptr.GetType()).(*TypePtr).Elem
+	}
+}
+
+func (self Atomic) GetMut() bool {
+	return false
+}
+
+func (self Atomic) IsTemporary() bool {
+	return true
+}
+
+func (self Atomic) IsConst() bool {
+	return false
+}
+
+// 原子操作内置函数，fetch_add和fetch_sub返回原来的值，cas返回是否成功
+func analyseAtomic(ctx *blockContext, ident *parse.Ident, paramAsts []parse.Expr) (Expr, utils.Error) {
+	op := atomicOps[ident.Name.Source]
+	argc := 3
+	switch op {
+	case AtomicLoad:
+		argc = 2
+	case AtomicCas:
+		if len(paramAsts) == 5 {
+			argc = 5
+		} else {
+			argc = 4
+		}
+	}
+	if len(paramAsts) != argc {
+		if op == AtomicCas {
+			return nil, utils.Errorf(ident.Position(), "expect 4 or 5 arguments")
+		}
+		return nil, utils.Errorf(ident.Position(), "expect %d arguments", argc)
+	}
+
+	ptr, err := analyseExpr(ctx, nil, paramAsts[0])
+	if err != nil {
+		return nil, err
+	}
+	pt, ok := GetBaseType(ptr.GetType()).(*TypePtr)
+	if !ok || !(IsIntTypeAndSon(pt.Elem) || (IsPtrTypeAndSon(pt.Elem) && op != AtomicFetchAdd && op != AtomicFetchSub)) {
+		return nil, utils.Errorf(paramAsts[0].Position(), "expect a pointer to integer but there is `%s`", ptr.GetType())
+	}
+	atomic := &Atomic{Op: op, Ptr: ptr}
+
+	// 值
+	if op != AtomicLoad {
+		if atomic.Value, err = expectExpr(ctx, pt.Elem, paramAsts[1]); err != nil {
+			return nil, err
+		}
+	}
+	if op == AtomicCas {
+		if atomic.New, err = expectExpr(ctx, pt.Elem, paramAsts[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	// 内存序
+	orderIndex := argc - 1
+	if op == AtomicCas {
+		orderIndex = 3
+	}
+	if atomic.Order, err = analyseAtomicOrdering(paramAsts[orderIndex]); err != nil {
+		return nil, err
+	}
+	switch {
+	case op == AtomicLoad && (atomic.Order == OrderingRelease || atomic.Order == OrderingAcqRel):
+		return nil, utils.Errorf(paramAsts[orderIndex].Position(), "atomic load can not be `release` or `acq_rel`")
+	case op == AtomicStore && (atomic.Order == OrderingAcquire || atomic.Order == OrderingAcqRel):
+		return nil, utils.Errorf(paramAsts[orderIndex].Position(), "atomic store can not be `acquire` or `acq_rel`")
+	}
+	if op == AtomicCas {
+		// 失败时没有写入，默认为成功时内存序中读取的部分
+		switch atomic.Order {
+		case OrderingRelease:
+			atomic.FailOrder = OrderingRelaxed
+		case OrderingAcqRel:
+			atomic.FailOrder = OrderingAcquire
+		default:
+			atomic.FailOrder = atomic.Order
+		}
+		if argc == 5 {
+			if atomic.FailOrder, err = analyseAtomicOrdering(paramAsts[4]); err != nil {
+				return nil, err
+			} else if atomic.FailOrder == OrderingRelease || atomic.FailOrder == OrderingAcqRel {
+				return nil, utils.Errorf(paramAsts[4].Position(), "failure ordering can not be `release` or `acq_rel`")
+			} else if atomic.FailOrder > atomic.Order || (atomic.FailOrder == OrderingAcquire && atomic.Order == OrderingRelease) {
+				return nil, utils.Errorf(paramAsts[4].Position(), "failure ordering can not be stronger than success ordering")
+			}
+		}
+	}
+	return atomic, nil
+}
+
+// 内存序参数
+func analyseAtomicOrdering(ast parse.Expr) (AtomicOrdering, utils.Error) {
+	if ident, ok := ast.(*parse.Ident); ok && ident.Pkg == nil {
+		if order, ok := atomicOrderings[ident.Name.Source]; ok {
+			return order, nil
+		}
+	}
+	return 0, utils.Errorf(ast.Position(), "expect a memory ordering (`relaxed`, `acquire`, `release`, `acq_rel` or `seq_cst`)")
+}
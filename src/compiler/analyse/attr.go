@@ -0,0 +1,439 @@
+package analyse
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/parse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+	stlos "github.com/kkkunny/stl/os"
+	"strings"
+)
+
+// 属性可以使用的位置
+type attrTarget uint8
+
+const (
+	attrOnFunc       attrTarget = 1 << iota // 函数定义
+	attrOnExternFunc                        // 外部函数声明
+	attrOnMethod                            // 方法
+	attrOnGlobal                            // 全局变量
+	attrOnType                              // 类型定义
+	attrOnField                             // 结构体字段
+
+	attrOnAnyFunc = attrOnFunc | attrOnExternFunc | attrOnMethod
+	attrOnAny     = attrOnAnyFunc | attrOnGlobal | attrOnType | attrOnField
+)
+
+func (self attrTarget) String() string {
+	switch self {
+	case attrOnFunc:
+		return "function"
+	case attrOnExternFunc:
+		return "extern function"
+	case attrOnMethod:
+		return "method"
+	case attrOnGlobal:
+		return "global variable"
+	case attrOnType:
+		return "type definition"
+	case attrOnField:
+		return "field"
+	default:
+		panic("unreachable")
+	}
+}
+
+// 属性参数种类
+type attrArgKind uint8
+
+const (
+	attrArgIdent  attrArgKind = iota // 标识符
+	attrArgString                    // 字符串
+	attrArgInt                       // 整数
+	attrArgBool                      // 布尔值
+)
+
+func (self attrArgKind) String() string {
+	switch self {
+	case attrArgIdent:
+		return "identifier"
+	case attrArgString:
+		return "string"
+	case attrArgInt:
+		return "integer"
+	case attrArgBool:
+		return "boolean"
+	default:
+		panic("unreachable")
+	}
+}
+
+// 属性描述
+type attrSpec struct {
+	Targets   attrTarget
+	Args      []attrArgKind          // 位置参数
+	Optional  int                    // 末尾可以省略的位置参数个数
+	Idents    []string               // 标识符参数的可选值，为空时不限
+	Keys      map[string]attrArgKind // 键值参数，可以重复出现
+	Repeat    bool                   // 是否可以重复使用
+	Conflicts []string               // 不能同时使用的属性
+}
+
+// 调用约定
+var callConvs = []string{"c", "fast", "cold"}
+
+// 线程局部存储模型，从通用到受限
+var tlsModels = []string{"general_dynamic", "local_dynamic", "initial_exec", "local_exec"}
+
+// 属性注册表，新增属性时在此登记，再在对应位置的属性分析中处理
+var attrSpecs = map[string]*attrSpec{
+	"@extern": {
+		Targets:   attrOnFunc | attrOnExternFunc | attrOnGlobal,
+		Args:      []attrArgKind{attrArgIdent},
+		Conflicts: []string{"@export"},
+	},
+	"@export": {
+		Targets:  attrOnFunc | attrOnGlobal,
+		Args:     []attrArgKind{attrArgIdent},
+		Optional: 1,
+	},
+	"@link": {
+		Targets: attrOnExternFunc | attrOnGlobal,
+		Keys:    map[string]attrArgKind{"asm": attrArgString, "c": attrArgString, "lib": attrArgString},
+		Repeat:  true,
+	},
+	"@noreturn": {Targets: attrOnAnyFunc},
+	"@inline": {
+		Targets:   attrOnFunc | attrOnMethod,
+		Args:      []attrArgKind{attrArgBool},
+		Optional:  1,
+		Conflicts: []string{"@cold"},
+	},
+	"@cold": {Targets: attrOnAnyFunc},
+	"@callconv": {
+		Targets: attrOnAnyFunc,
+		Args:    []attrArgKind{attrArgIdent},
+		Idents:  callConvs,
+	},
+	"@weak": {Targets: attrOnFunc | attrOnExternFunc | attrOnGlobal},
+	"@section": {
+		Targets: attrOnFunc | attrOnMethod | attrOnGlobal,
+		Args:    []attrArgKind{attrArgString},
+	},
+	"@thread_local": {
+		Targets:   attrOnGlobal,
+		Args:      []attrArgKind{attrArgIdent},
+		Optional:  1,
+		Idents:    tlsModels,
+		Conflicts: []string{"@section"},
+	},
+	"@drop":   {Targets: attrOnMethod},
+	"@packed": {Targets: attrOnType},
+	"@align": {
+		Targets: attrOnType,
+		Args:    []attrArgKind{attrArgInt},
+	},
+	"@deprecated": {
+		Targets:  attrOnAny,
+		Args:     []attrArgKind{attrArgString},
+		Optional: 1,
+	},
+}
+
+// 检查属性是否存在、能否用于该位置以及参数是否正确
+func checkAttrs(attrs []*parse.Attr, target attrTarget) utils.Error {
+	var errors []utils.Error
+	used := make(map[string]*parse.Attr, len(attrs))
+	for _, attr := range attrs {
+		name := attr.Name.Source
+		spec, ok := attrSpecs[name]
+		if !ok {
+			errors = append(errors, utils.Errorf(attr.Name.Pos, "unknown attribute `%s`", name))
+			continue
+		} else if spec.Targets&target == 0 {
+			errors = append(errors, utils.Errorf(attr.Name.Pos, "attribute `%s` can not be used on a %s", name, target))
+			continue
+		} else if _, ok := used[name]; ok && !spec.Repeat {
+			errors = append(errors, utils.Errorf(attr.Name.Pos, "duplicate attribute `%s`", name))
+			continue
+		}
+		used[name] = attr
+		errors = append(errors, checkAttrArgs(attr, spec)...)
+	}
+	for _, attr := range attrs {
+		spec, ok := attrSpecs[attr.Name.Source]
+		if !ok || used[attr.Name.Source] != attr {
+			continue
+		}
+		for _, c := range spec.Conflicts {
+			if _, ok := used[c]; ok {
+				errors = append(errors, utils.Errorf(attr.Name.Pos, "attribute `%s` can not be used with `%s`", attr.Name.Source, c))
+			}
+		}
+	}
+	if len(errors) == 0 {
+		return nil
+	} else if len(errors) == 1 {
+		return errors[0]
+	} else {
+		return utils.NewMultiError(errors...)
+	}
+}
+
+// 检查属性参数
+func checkAttrArgs(attr *parse.Attr, spec *attrSpec) []utils.Error {
+	var errors []utils.Error
+	var count int
+	for _, arg := range attr.Args {
+		var kind attrArgKind
+		if arg.Key != nil {
+			k, ok := spec.Keys[arg.Key.Source]
+			if !ok {
+				errors = append(errors, utils.Errorf(arg.Key.Pos, "unknown argument `%s`", arg.Key.Source))
+				continue
+			}
+			kind = k
+		} else {
+			if count >= len(spec.Args) {
+				errors = append(errors, utils.Errorf(arg.Position(), "too many arguments for attribute `%s`", attr.Name.Source))
+				continue
+			}
+			kind = spec.Args[count]
+			count++
+		}
+		if attrArgKindOf(arg.Value) != kind {
+			errors = append(errors, utils.Errorf(arg.Value.Position(), "expect a %s", kind))
+		} else if ident, ok := arg.Value.(*parse.Ident); ok && arg.Key == nil && len(spec.Idents) != 0 && !containString(spec.Idents, ident.Name.Source) {
+			errors = append(errors, utils.Errorf(arg.Value.Position(), "expect one of `%s`", strings.Join(spec.Idents, "`, `")))
+		}
+	}
+	if count < len(spec.Args)-spec.Optional {
+		errors = append(errors, utils.Errorf(attr.Pos, "attribute `%s` expect %d arguments", attr.Name.Source, len(spec.Args)-spec.Optional))
+	}
+	return errors
+}
+
+// 参数值的种类
+func attrArgKindOf(v parse.Expr) attrArgKind {
+	switch v.(type) {
+	case *parse.Ident:
+		return attrArgIdent
+	case *parse.String:
+		return attrArgString
+	case *parse.Int:
+		return attrArgInt
+	case *parse.Bool:
+		return attrArgBool
+	default:
+		panic("unreachable")
+	}
+}
+
+// 是否包含字符串
+func containString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 第i个位置参数，不存在时返回nil
+func attrArg(attr *parse.Attr, i int) parse.Expr {
+	for _, arg := range attr.Args {
+		if arg.Key != nil {
+			continue
+		} else if i == 0 {
+			return arg.Value
+		}
+		i--
+	}
+	return nil
+}
+
+// 弃用说明
+func attrDeprecated(attr *parse.Attr) *string {
+	var msg string
+	if v := attrArg(attr, 0); v != nil {
+		msg = v.(*parse.String).Value
+	}
+	return &msg
+}
+
+// 链接属性，记录需要一起链接的文件和库
+func analyseAttrLink(ctx *packageContext, attr *parse.Attr) []utils.Error {
+	var errors []utils.Error
+	for _, arg := range attr.Args {
+		v := arg.Value.(*parse.String)
+		switch arg.Key.Source {
+		case "asm", "c":
+			linkPath := stlos.Path(v.Value)
+			if !linkPath.IsAbsolute() {
+				linkPath = ctx.path.Join(linkPath)
+			}
+			if !linkPath.IsExist() {
+				errors = append(errors, utils.Errorf(v.Position(), "can not find path `%s`", linkPath))
+			} else if arg.Key.Source == "c" && linkPath.GetExtension() != "c" {
+				errors = append(errors, utils.Errorf(v.Position(), "expect a C source file but there is `%s`", linkPath))
+			}
+			ctx.f.Links[linkPath] = struct{}{}
+		case "lib":
+			ctx.f.Libs[v.Value] = struct{}{}
+		}
+	}
+	return errors
+}
+
+// 函数属性，name为函数名，返回@drop属性
+func analyseFuncAttrs(ctx *packageContext, f *Function, name string, attrs []*parse.Attr, target attrTarget) (*parse.Attr, utils.Error) {
+	if err := checkAttrs(attrs, target); err != nil {
+		return nil, err
+	}
+	var drop *parse.Attr
+	var errors []utils.Error
+	for _, attr := range attrs {
+		switch attr.Name.Source {
+		case "@extern":
+			f.ExternName = attrArg(attr, 0).(*parse.Ident).Name.Source
+		case "@export":
+			f.ExternName = name
+			if v := attrArg(attr, 0); v != nil {
+				f.ExternName = v.(*parse.Ident).Name.Source
+			}
+		case "@link":
+			errors = append(errors, analyseAttrLink(ctx, attr)...)
+		case "@noreturn":
+			f.NoReturn = true
+		case "@inline":
+			v := true
+			if arg := attrArg(attr, 0); arg != nil {
+				v = arg.(*parse.Bool).Value
+			}
+			f.Inline = &v
+		case "@cold":
+			f.Cold = true
+		case "@callconv":
+			if cc := attrArg(attr, 0).(*parse.Ident).Name.Source; cc != "c" {
+				f.CallConv = cc
+			}
+		case "@weak":
+			f.Weak = true
+		case "@section":
+			f.Section = attrArg(attr, 0).(*parse.String).Value
+		case "@drop":
+			drop = attr
+		case "@deprecated":
+			f.Deprecated = attrDeprecated(attr)
+		default:
+			panic("unreachable")
+		}
+	}
+	if len(errors) == 0 {
+		return drop, nil
+	} else if len(errors) == 1 {
+		return nil, errors[0]
+	} else {
+		return nil, utils.NewMultiError(errors...)
+	}
+}
+
+// 全局变量属性
+func analyseGlobalVariableAttrs(ctx *packageContext, v *GlobalVariable, name string, attrs []*parse.Attr) utils.Error {
+	if err := checkAttrs(attrs, attrOnGlobal); err != nil {
+		return err
+	}
+	var errors []utils.Error
+	for _, attr := range attrs {
+		switch attr.Name.Source {
+		case "@extern":
+			v.ExternName = attrArg(attr, 0).(*parse.Ident).Name.Source
+		case "@export":
+			v.ExternName = name
+			if arg := attrArg(attr, 0); arg != nil {
+				v.ExternName = arg.(*parse.Ident).Name.Source
+			}
+		case "@link":
+			errors = append(errors, analyseAttrLink(ctx, attr)...)
+		case "@weak":
+			v.Weak = true
+		case "@section":
+			v.Section = attrArg(attr, 0).(*parse.String).Value
+		case "@thread_local":
+			v.ThreadLocal = tlsModels[0]
+			if arg := attrArg(attr, 0); arg != nil {
+				v.ThreadLocal = arg.(*parse.Ident).Name.Source
+			}
+			// 局部模型要求变量定义在当前模块中
+			if v.Value == nil && (v.ThreadLocal == "local_dynamic" || v.ThreadLocal == "local_exec") {
+				errors = append(errors, utils.Errorf(attr.Position(), "thread local model `%s` can not be used on an extern declaration", v.ThreadLocal))
+			}
+		case "@deprecated":
+			v.Deprecated = attrDeprecated(attr)
+		default:
+			panic("unreachable")
+		}
+	}
+	if len(errors) == 0 {
+		return nil
+	} else if len(errors) == 1 {
+		return errors[0]
+	} else {
+		return utils.NewMultiError(errors...)
+	}
+}
+
+// 类型定义属性
+func analyseTypeDefAttrs(td *Typedef, dst Type, attrs []*parse.Attr) utils.Error {
+	if err := checkAttrs(attrs, attrOnType); err != nil {
+		return err
+	}
+	var errors []utils.Error
+	for _, attr := range attrs {
+		if attr.Name.Source == "@deprecated" {
+			td.Deprecated = attrDeprecated(attr)
+			continue
+		}
+		st, ok := dst.(*TypeStruct)
+		if !ok {
+			errors = append(errors, utils.Errorf(attr.Position(), "expect a struct or union type"))
+			continue
+		}
+		switch attr.Name.Source {
+		case "@packed":
+			st.Packed = true
+		case "@align":
+			if v := attrArg(attr, 0).(*parse.Int).Value; !v.IsUint64() || v.Uint64() == 0 || v.Uint64()&(v.Uint64()-1) != 0 {
+				errors = append(errors, utils.Errorf(attrArg(attr, 0).Position(), "alignment must be a power of 2"))
+			} else {
+				st.Align = uint(v.Uint64())
+			}
+		default:
+			panic("unreachable")
+		}
+	}
+	if len(errors) == 0 {
+		return nil
+	} else if len(errors) == 1 {
+		return errors[0]
+	} else {
+		return utils.NewMultiError(errors...)
+	}
+}
+
+// 字段属性
+func analyseFieldAttrs(st *TypeStruct, name string, attrs []*parse.Attr) utils.Error {
+	if err := checkAttrs(attrs, attrOnField); err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.Name.Source {
+		case "@deprecated":
+			if st.Deprecated == nil {
+				st.Deprecated = make(map[string]string)
+			}
+			st.Deprecated[name] = *attrDeprecated(attr)
+		default:
+			panic("unreachable")
+		}
+	}
+	return nil
+}
@@ -1,21 +1,46 @@
 package analyse
 
 import (
+	"fmt"
+	"github.com/kkkunny/Sim/src/compiler/lex"
+	"github.com/kkkunny/Sim/src/compiler/parse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
 	stlos "github.com/kkkunny/stl/os"
 	"github.com/kkkunny/stl/types"
+	"path/filepath"
+	"strings"
 )
 
 // CompilerContext 编译环境
 type CompilerContext struct {
-	Links map[stlos.Path]struct{}
-	Libs  map[string]struct{}
+	Links    map[stlos.Path]struct{}
+	Libs     map[string]struct{}
+	Warnings []utils.Error // 警告，不影响编译
+
+	warned map[utils.Position]struct{} // 已经警告过的位置
 }
 
 // 新建编译环境
 func newCompilerContext() *CompilerContext {
 	return &CompilerContext{
-		Links: make(map[stlos.Path]struct{}),
-		Libs:  make(map[string]struct{}),
+		Links:  make(map[stlos.Path]struct{}),
+		Libs:   make(map[string]struct{}),
+		warned: make(map[utils.Position]struct{}),
+	}
+}
+
+// 使用弃用的名字时产生警告，msg为空时没有弃用，同一位置只警告一次（泛型实例会重复分析）
+func (self *CompilerContext) warnDeprecated(pos utils.Position, name string, msg *string) {
+	if msg == nil {
+		return
+	} else if _, ok := self.warned[pos]; ok {
+		return
+	}
+	self.warned[pos] = struct{}{}
+	if *msg == "" {
+		self.Warnings = append(self.Warnings, utils.Errorf(pos, "warning: `%s` is deprecated", name))
+	} else {
+		self.Warnings = append(self.Warnings, utils.Errorf(pos, "warning: `%s` is deprecated: %s", name, *msg))
 	}
 }
 
@@ -24,13 +49,129 @@ type ProgramContext struct {
 	*CompilerContext
 	importedPackageSet map[stlos.Path]*packageContext
 	Globals            []Global
+	Main               *Function // 主包的main函数，没有时为空
+
+	genericMethodDefs []types.Pair[*packageContext, *parse.Method] // 待分析的泛型类型实例的方法定义
+
+	mainPath stlos.Path // 主包目录
+	rootPath stlos.Path // 语言根目录
 }
 
 // 新建程序环境
-func newProgramContext() *ProgramContext {
+func newProgramContext(mainPath, rootPath stlos.Path) *ProgramContext {
 	return &ProgramContext{
 		CompilerContext:    newCompilerContext(),
 		importedPackageSet: make(map[stlos.Path]*packageContext),
+		mainPath:           mainPath,
+		rootPath:           rootPath,
+	}
+}
+
+// 标准库字符串包路径
+func (self ProgramContext) stringPackagePath() stlos.Path {
+	return self.rootPath.Join("std").Join("container").Join("string")
+}
+
+// 标准库字符串包
+func (self ProgramContext) stringPackage() *packageContext {
+	return self.importedPackageSet[self.stringPackagePath()]
+}
+
+// 是否是标准库字符串类型（std.container.string.String）
+func (self ProgramContext) isStringType(t Type) bool {
+	td, ok := t.(*Typedef)
+	return ok && td.Name == "String" && td.Pkg == self.stringPackagePath()
+}
+
+// 获取标准库字符串包中的公开函数，包未导入时返回nil
+func (self ProgramContext) getStringFunc(name string) *Function {
+	pkg := self.stringPackage()
+	if pkg == nil {
+		return nil
+	}
+	if v := pkg.globals[name]; v.First {
+		if f, ok := v.Second.(*Function); ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// 标准库格式化包路径
+func (self ProgramContext) fmtPackagePath() stlos.Path {
+	return self.rootPath.Join("std").Join("fmt")
+}
+
+// 是否是格式化参数类型（std.fmt.Args）
+func (self ProgramContext) isFormatArgsType(t Type) bool {
+	td, ok := t.(*Typedef)
+	return ok && td.Name == "Args" && td.Pkg == self.fmtPackagePath()
+}
+
+// 获取标准库格式化包中的类型定义，包未导入时返回nil
+func (self ProgramContext) getFmtType(name string) *Typedef {
+	pkg := self.importedPackageSet[self.fmtPackagePath()]
+	if pkg == nil {
+		return nil
+	}
+	return pkg.typedefs[name].Second
+}
+
+// 标准库结果包路径
+func (self ProgramContext) resultPackagePath() stlos.Path {
+	return self.rootPath.Join("std").Join("result")
+}
+
+// 是否是标准库结果包中的泛型类型（Result[T, E]或Option[T]）的实例
+func (self ProgramContext) isResultType(t Type, generic string) bool {
+	td, ok := t.(*Typedef)
+	return ok && td.Generic == generic && td.Pkg == self.resultPackagePath()
+}
+
+// 获取包用于符号修饰的名字，主包为main，其子包为main.xxx，语言根目录下的包为相对根目录的路径
+func (self ProgramContext) mangleName(path stlos.Path) string {
+	if path == self.mainPath {
+		return "main"
+	}
+	var base, name string
+	if rel, ok := relPath(self.mainPath, path); ok {
+		base, name = self.mainPath.String(), "main."+rel
+	}
+	if rel, ok := relPath(self.rootPath, path); ok && len(self.rootPath.String()) >= len(base) {
+		name = rel
+	}
+	if name == "" {
+		name = path.GetBase().String()
+	}
+	return name
+}
+
+// 类型名，类型定义以包修饰名限定，用于命名泛型类型的实例
+func (self ProgramContext) typeName(t Type) string {
+	switch typ := t.(type) {
+	case *Typedef:
+		return self.mangleName(typ.Pkg) + "::" + typ.Name
+	case *TypePtr:
+		return "*" + self.typeName(typ.Elem)
+	case *TypeArray:
+		return fmt.Sprintf("[%d]%s", typ.Size, self.typeName(typ.Elem))
+	case *TypeTuple:
+		elems := make([]string, len(typ.Elems))
+		for i, e := range typ.Elems {
+			elems[i] = self.typeName(e)
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	case *TypeFunc:
+		params := make([]string, len(typ.Params))
+		for i, p := range typ.Params {
+			params[i] = self.typeName(p)
+		}
+		if typ.VarArg {
+			params = append(params, "...")
+		}
+		return "func(" + strings.Join(params, ", ") + ")" + self.typeName(typ.Ret)
+	default:
+		return t.String()
 	}
 }
 
@@ -41,9 +182,12 @@ type packageContext struct {
 
 	globals  map[string]types.Pair[bool, Ident]
 	typedefs map[string]types.Pair[bool, *Typedef]
+	generics map[string]types.Pair[bool, *genericTypedef]
 
 	externs  map[string]*packageContext
 	includes []*packageContext
+
+	typeParams map[string]Type // 实例化泛型类型时绑定的类型形参
 }
 
 // 新建包环境
@@ -53,15 +197,39 @@ func newPackageContext(f *ProgramContext, path stlos.Path) *packageContext {
 		path:     path,
 		globals:  make(map[string]types.Pair[bool, Ident]),
 		typedefs: make(map[string]types.Pair[bool, *Typedef]),
+		generics: make(map[string]types.Pair[bool, *genericTypedef]),
 		externs:  make(map[string]*packageContext),
 	}
 }
 
+// 绑定类型形参，返回的包环境与原包环境共用全局符号
+func (self packageContext) withTypeParams(params []lex.Token, args []Type) *packageContext {
+	self.typeParams = make(map[string]Type, len(params))
+	for i, p := range params {
+		self.typeParams[p.Source] = args[i]
+	}
+	return &self
+}
+
 // GetProgramContext 获取程序环境
 func (self packageContext) GetProgramContext() *ProgramContext {
 	return self.f
 }
 
+// GetMangleName 获取包用于符号修饰的名字
+func (self packageContext) GetMangleName() string {
+	return self.f.mangleName(self.path)
+}
+
+// 获取path相对base的路径，以.分隔
+func relPath(base, path stlos.Path) (string, bool) {
+	rel, err := filepath.Rel(base.String(), path.String())
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return strings.ReplaceAll(rel, string(filepath.Separator), "."), true
+}
+
 func (self packageContext) GetValue(name string) types.Pair[bool, Ident] {
 	if v, ok := self.globals[name]; ok {
 		return v
@@ -93,20 +261,58 @@ type localContext interface {
 	IsEnd() bool
 }
 
+// 移出状态，局部变量到移出的位置，在某条执行路径上被移出即视为已移出
+type movedSet map[*Variable]utils.Position
+
+// 复制
+func (self movedSet) clone() movedSet {
+	res := make(movedSet, len(self))
+	for v, pos := range self {
+		res[v] = pos
+	}
+	return res
+}
+
+// 合并另一条执行路径的移出状态
+func (self movedSet) merge(other movedSet) {
+	for v, pos := range other {
+		if _, ok := self[v]; !ok {
+			self[v] = pos
+		}
+	}
+}
+
+// 循环中跳转时的移出状态
+type loopMoved struct {
+	breaks    []movedSet // break时的移出状态
+	continues []movedSet // continue时的移出状态
+}
+
+// 局部变量的声明
+type declaredVariable struct {
+	name  string
+	block *blockContext
+}
+
 // 函数环境
 type functionContext struct {
-	f      *packageContext
-	ret    Type
-	params map[string]*Param
-	end    bool
+	f        *packageContext
+	ret      Type
+	params   map[string]*Param
+	moved    movedSet                       // 当前执行路径上被移出的局部变量
+	loops    []*loopMoved                   // 所在的循环，由内到外
+	declared map[*Variable]declaredVariable // 局部变量的声明
+	end      bool
 }
 
 // 新建函数环境
 func newFunctionContext(f *packageContext, ret Type) *functionContext {
 	return &functionContext{
-		f:      f,
-		ret:    ret,
-		params: make(map[string]*Param),
+		f:        f,
+		ret:      ret,
+		params:   make(map[string]*Param),
+		moved:    make(movedSet),
+		declared: make(map[*Variable]declaredVariable),
 	}
 }
 
@@ -144,10 +350,11 @@ func (self functionContext) IsEnd() bool {
 
 // 代码块环境
 type blockContext struct {
-	f      localContext
-	inLoop bool
-	locals map[string]*Variable
-	end    bool
+	f       localContext
+	inLoop  bool
+	inDefer bool // 是否是defer代码块
+	locals  map[string]*Variable
+	end     bool
 }
 
 // 代码块环境
@@ -172,13 +379,18 @@ func (self blockContext) GetValue(name string) Ident {
 }
 
 func (self *blockContext) AddValue(name string, value Ident) bool {
-	self.locals[name] = value.(*Variable)
+	v := value.(*Variable)
+	self.locals[name] = v
+	self.getFunctionContext().declared[v] = declaredVariable{name: name, block: self}
 	return true
 }
 
 func (self *blockContext) IsInLoop() bool {
 	if self.inLoop {
 		return true
+	} else if self.inDefer {
+		// 不能跳出defer代码块
+		return false
 	} else if self.f != nil {
 		if fb, ok := self.f.(*blockContext); ok {
 			return fb.IsInLoop()
@@ -187,10 +399,83 @@ func (self *blockContext) IsInLoop() bool {
 	return false
 }
 
+// IsInDefer 是否在defer代码块中
+func (self *blockContext) IsInDefer() bool {
+	if self.inDefer {
+		return true
+	} else if fb, ok := self.f.(*blockContext); ok {
+		return fb.IsInDefer()
+	}
+	return false
+}
+
 func (self *blockContext) GetPackageContext() *packageContext {
 	return self.f.GetPackageContext()
 }
 
+// 所在的函数环境
+func (self *blockContext) getFunctionContext() *functionContext {
+	if fb, ok := self.f.(*blockContext); ok {
+		return fb.getFunctionContext()
+	}
+	return self.f.(*functionContext)
+}
+
+// 是否是代码块block或者在其中
+func (self *blockContext) isInside(block *blockContext) bool {
+	for cur := self; cur != block; {
+		fb, ok := cur.f.(*blockContext)
+		if !ok {
+			return false
+		}
+		cur = fb
+	}
+	return true
+}
+
+// 记录局部变量被移出（或者立即析构），之后不能再使用，defer代码块在离开作用域时才执行，不记录
+func (self *blockContext) markMoved(pos utils.Position, v *Variable) {
+	if self.IsInDefer() {
+		return
+	}
+	self.getFunctionContext().moved[v] = pos
+}
+
+// 局部变量被重新赋值，在当前执行路径上恢复为可用
+func (self *blockContext) markAssigned(v *Variable) {
+	delete(self.getFunctionContext().moved, v)
+}
+
+// 局部变量被移出的位置，没有被移出时返回false
+func (self *blockContext) getMoved(v *Variable) (utils.Position, bool) {
+	pos, ok := self.getFunctionContext().moved[v]
+	return pos, ok
+}
+
+// 当前执行路径的移出状态
+func (self *blockContext) saveMoved() movedSet {
+	return self.getFunctionContext().moved.clone()
+}
+
+// 设置当前执行路径的移出状态
+func (self *blockContext) restoreMoved(moved movedSet) {
+	self.getFunctionContext().moved = moved
+}
+
+// 记录break或者continue时的移出状态
+func (self *blockContext) markLoopControl(isBreak bool) {
+	fctx := self.getFunctionContext()
+	if len(fctx.loops) == 0 {
+		return
+	}
+	loop := fctx.loops[len(fctx.loops)-1]
+	if isBreak {
+		loop.breaks = append(loop.breaks, fctx.moved.clone())
+	} else {
+		loop.continues = append(loop.continues, fctx.moved.clone())
+	}
+}
+
 func (self *blockContext) SetEnd() {
 	self.end = true
 }
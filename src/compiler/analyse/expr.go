@@ -4,6 +4,9 @@ import (
 	"github.com/kkkunny/Sim/src/compiler/lex"
 	"github.com/kkkunny/Sim/src/compiler/parse"
 	"github.com/kkkunny/Sim/src/compiler/utils"
+	stlutil "github.com/kkkunny/stl/util"
+	"math"
+	"math/big"
 )
 
 // Expr 表达式
@@ -24,7 +27,7 @@ type Ident interface {
 // Integer 整数
 type Integer struct {
 	Type  Type
-	Value int64
+	Value *big.Int
 }
 
 func (self Integer) stmt() {}
@@ -142,6 +145,7 @@ func (self Null) IsConst() bool {
 
 // Binary 二元表达式
 type Binary struct {
+	Pos         utils.Position
 	Opera       string
 	Left, Right Expr
 }
@@ -291,6 +295,7 @@ func (self EmptyArray) IsConst() bool {
 
 // Assign 赋值
 type Assign struct {
+	Pos         utils.Position
 	Opera       string
 	Left, Right Expr
 }
@@ -322,6 +327,10 @@ type Equal struct {
 func (self Equal) stmt() {}
 
 func (self Equal) GetType() Type {
+	// 向量逐元素比较
+	if vt, ok := GetBaseType(self.Left.GetType()).(*TypeVec); ok {
+		return NewVecType(vt.Size, Bool)
+	}
 	return Bool
 }
 
@@ -339,6 +348,7 @@ func (self Equal) IsConst() bool {
 
 // Unary 一元表达式
 type Unary struct {
+	Pos   utils.Position
 	Type  Type
 	Opera string
 	Value Expr
@@ -351,11 +361,12 @@ func (self Unary) GetType() Type {
 }
 
 func (self Unary) GetMut() bool {
-	return false
+	// 解引用的结果是指针指向的内存
+	return self.Opera == "*"
 }
 
 func (self Unary) IsTemporary() bool {
-	return true
+	return self.Opera != "*"
 }
 
 func (self Unary) IsConst() bool {
@@ -364,6 +375,7 @@ func (self Unary) IsConst() bool {
 
 // Index 索引
 type Index struct {
+	Pos         utils.Position
 	Type        Type
 	From, Index Expr
 }
@@ -375,11 +387,12 @@ func (self Index) GetType() Type {
 }
 
 func (self Index) GetMut() bool {
-	return self.From.GetMut()
+	// 指针索引的结果是指针指向的内存
+	return IsPtrTypeAndSon(self.From.GetType()) || self.From.GetMut()
 }
 
 func (self Index) IsTemporary() bool {
-	return self.From.IsTemporary()
+	return !IsPtrTypeAndSon(self.From.GetType()) && self.From.IsTemporary()
 }
 
 func (self Index) IsConst() bool {
@@ -537,6 +550,17 @@ func (self GetField) IsConst() bool {
 	return false
 }
 
+// IsBitField 是否是位域
+func (self GetField) IsBitField() bool {
+	st := GetBaseType(self.From.GetType()).(*TypeStruct)
+	for iter := st.Fields.Begin(); iter.HasValue(); iter.Next() {
+		if iter.Key() == self.Index {
+			return st.GetBits(iter.Index()) != 0
+		}
+	}
+	return false
+}
+
 // Covert 类型转换
 type Covert struct {
 	From Expr
@@ -608,34 +632,210 @@ func (self GetTypeBytes) IsConst() bool {
 	return false
 }
 
+// Hash 哈希值
+type Hash struct {
+	Temp   *Variable // 被哈希的值，只求值一次
+	Values []Expr    // 参与计算的u64
+}
+
+func (self Hash) stmt() {}
+
+func (self Hash) GetType() Type {
+	return U64
+}
+
+func (self Hash) GetMut() bool {
+	return false
+}
+
+func (self Hash) IsTemporary() bool {
+	return true
+}
+
+func (self Hash) IsConst() bool {
+	return false
+}
+
+// Move 移出值，Value为局部变量时离开作用域时不再析构，为临时值时不再在语句结束时析构，否则为解引用、成员或者下标，移出后原位置置为零值
+type Move struct {
+	Value Expr
+}
+
+func (self Move) stmt() {}
+
+func (self Move) GetType() Type {
+	return self.Value.GetType()
+}
+
+func (self Move) GetMut() bool {
+	return false
+}
+
+func (self Move) IsTemporary() bool {
+	return true
+}
+
+func (self Move) IsConst() bool {
+	return false
+}
+
+// Drop 立即析构，值为局部变量时离开作用域时不再析构
+type Drop struct {
+	Value Expr
+}
+
+func (self Drop) stmt() {}
+
+func (self Drop) GetType() Type {
+	return None
+}
+
+func (self Drop) GetMut() bool {
+	return false
+}
+
+func (self Drop) IsTemporary() bool {
+	return true
+}
+
+func (self Drop) IsConst() bool {
+	return false
+}
+
+// Try 错误传播（expr?），Value为Result或Option，失败时返回Ret类型的值（Result时带上错误）
+type Try struct {
+	Value    Expr
+	Ret      Type
+	IsResult bool
+}
+
+func (self Try) stmt() {}
+
+func (self Try) GetType() Type {
+	return resultFieldType(self.Value.GetType(), "value")
+}
+
+func (self Try) GetMut() bool {
+	return false
+}
+
+func (self Try) IsTemporary() bool {
+	return true
+}
+
+func (self Try) IsConst() bool {
+	return false
+}
+
+// Panic 报错并终止程序，Cond不为nil时为断言（Cond为假时报错）
+type Panic struct {
+	Pos         utils.Position
+	Cond        Expr
+	Msg         Expr   // 信息，*i8或者String，为nil时使用Text
+	MsgIsString bool   // Msg是否是String
+	Text        string // 常量信息
+}
+
+func (self Panic) stmt() {}
+
+func (self Panic) GetType() Type {
+	return None
+}
+
+func (self Panic) GetMut() bool {
+	return false
+}
+
+func (self Panic) IsTemporary() bool {
+	return true
+}
+
+func (self Panic) IsConst() bool {
+	return false
+}
+
+// Volatile 易变读写（volatile_load(ptr)、volatile_store(ptr, value)），不会被优化掉或者重排
+type Volatile struct {
+	Ptr   Expr
+	Value Expr // 写入的值，读取时为nil
+}
+
+func (self Volatile) stmt() {}
+
+func (self Volatile) GetType() Type {
+	if self.Value != nil {
+		return None
+	}
+	return GetBaseType(self.Ptr.GetType()).(*TypePtr).Elem
+}
+
+func (self Volatile) GetMut() bool {
+	return false
+}
+
+func (self Volatile) IsTemporary() bool {
+	return true
+}
+
+func (self Volatile) IsConst() bool {
+	return false
+}
+
 // *********************************************************************************************************************
 
+// 整数字面量，neg为是否取负，超出类型的取值范围时报错
+func analyseInteger(expect Type, ast *parse.Int, neg bool, pos utils.Position) (Expr, utils.Error) {
+	if ast.Suffix != "" {
+		expect = getBuiltinType(ast.Suffix)
+	} else if expect == nil || !IsNumberTypeAndSon(expect) {
+		expect = Isize
+	}
+	if IsFloatTypeAndSon(expect) {
+		f, _ := new(big.Float).SetInt(ast.Value).Float64()
+		return analyseFloat(expect, parse.NewFloat(ast.Token, f, ""), neg, pos)
+	}
+
+	value := new(big.Int).Set(ast.Value)
+	if neg {
+		value.Neg(value)
+	}
+	if min, max := getIntTypeRange(GetBaseType(expect)); value.Cmp(min) < 0 || value.Cmp(max) > 0 {
+		return nil, utils.Errorf(pos, "literal `%s%s` overflows type `%s`", stlutil.Ternary(neg, "-", ""), ast.Token.Source, expect)
+	}
+	return &Integer{
+		Type:  expect,
+		Value: value,
+	}, nil
+}
+
+// 浮点数字面量，neg为是否取负
+func analyseFloat(expect Type, ast *parse.Float, neg bool, pos utils.Position) (Expr, utils.Error) {
+	if ast.Suffix != "" {
+		expect = getBuiltinType(ast.Suffix)
+	} else if expect == nil || !IsFloatTypeAndSon(expect) {
+		expect = F64
+	}
+	if GetBaseType(expect).Equal(F32) && ast.Value > math.MaxFloat32 {
+		return nil, utils.Errorf(pos, "literal `%s%s` overflows type `%s`", stlutil.Ternary(neg, "-", ""), ast.Token.Source, expect)
+	}
+
+	value := ast.Value
+	if neg {
+		value = -value
+	}
+	return &Float{
+		Type:  expect,
+		Value: value,
+	}, nil
+}
+
 // 表达式
 func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Error) {
 	switch expr := ast.(type) {
 	case *parse.Int:
-		if expect == nil || !IsNumberTypeAndSon(expect) {
-			expect = Isize
-		}
-		if IsIntTypeAndSon(expect) {
-			return &Integer{
-				Type:  expect,
-				Value: expr.Value,
-			}, nil
-		} else {
-			return &Float{
-				Type:  expect,
-				Value: float64(expr.Value),
-			}, nil
-		}
+		return analyseInteger(expect, expr, false, expr.Position())
 	case *parse.Float:
-		if expect == nil || !IsFloatTypeAndSon(expect) {
-			expect = F64
-		}
-		return &Float{
-			Type:  expect,
-			Value: expr.Value,
-		}, nil
+		return analyseFloat(expect, expr, false, expr.Position())
 	case *parse.Bool:
 		if expect == nil || !IsBoolTypeAndSon(expect) {
 			expect = Bool
@@ -650,9 +850,15 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		}
 		return &Integer{
 			Type:  expect,
-			Value: int64(expr.Value),
+			Value: big.NewInt(int64(expr.Value)),
 		}, nil
 	case *parse.String:
+		if expect != nil && ctx.GetPackageContext().f.isStringType(expect) {
+			return &String{
+				Type:  expect,
+				Value: expr.Value,
+			}, nil
+		}
 		if expect == nil || !GetDepthBaseType(expect).Equal(NewPtrType(I8)) {
 			expect = NewPtrType(I8)
 		}
@@ -669,11 +875,14 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		return analyseIdent(ctx, expr)
 	case *parse.Array:
 		if len(expr.Elems) == 0 {
-			if expect == nil || !IsArrayTypeAndSon(expect) {
+			if expect == nil || !(IsArrayTypeAndSon(expect) || IsVecTypeAndSon(expect)) {
 				return nil, utils.Errorf(expr.Position(), "expect a array type")
 			}
 			return &EmptyArray{Type: expect}, nil
 		}
+		if expect != nil && IsVecTypeAndSon(expect) {
+			return analyseVector(ctx, expect, expr)
+		}
 		if expect != nil {
 			if at, ok := GetBaseType(expect).(*TypeArray); ok && at.Size == uint(len(expr.Elems)) {
 				expect = at.Elem
@@ -699,6 +908,9 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			return nil, utils.NewMultiError(errs...)
 		}
 
+		if err := moveElems(ctx, expr.Elems, elems); err != nil {
+			return nil, err
+		}
 		var rt Type = NewArrayType(uint(len(elems)), elems[0].GetType())
 		if expect != nil && GetDepthBaseType(expect).Equal(GetDepthBaseType(rt)) {
 			rt = expect
@@ -731,6 +943,9 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		for i, e := range elems {
 			expects[i] = e.GetType()
 		}
+		if err := moveElems(ctx, expr.Elems, elems); err != nil {
+			return nil, err
+		}
 		var rt Type = NewTupleType(expects...)
 		if expect != nil && GetDepthBaseType(expect).Equal(GetDepthBaseType(rt)) {
 			rt = expect
@@ -748,11 +963,18 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		}
 		if expect == nil || !IsStructTypeAndSon(expect) {
 			return nil, utils.Errorf(expr.Position(), "expect a struct type")
-		} else if GetBaseType(expect).(*TypeStruct).Fields.Length() != len(expr.Fields) {
-			return nil, utils.Errorf(expr.Position(), "expect `%d` fields", len(expr.Fields))
+		}
+		// 联合体只初始化第一个成员
+		st := GetBaseType(expect).(*TypeStruct)
+		count := st.Fields.Length()
+		if st.Union && count > 1 {
+			count = 1
+		}
+		if count != len(expr.Fields) {
+			return nil, utils.Errorf(expr.Position(), "expect `%d` fields", count)
 		}
 		expects := make([]Type, len(expr.Fields))
-		for iter := GetBaseType(expect).(*TypeStruct).Fields.Begin(); iter.HasValue(); iter.Next() {
+		for iter := st.Fields.Begin(); iter.HasValue() && iter.Index() < count; iter.Next() {
 			expects[iter.Index()] = iter.Value().Second
 		}
 		fields, err := analyseExprList(ctx, expects, expr.Fields)
@@ -762,6 +984,9 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		for i, e := range fields {
 			expects[i] = e.GetType()
 		}
+		if err := moveElems(ctx, expr.Fields, fields); err != nil {
+			return nil, err
+		}
 		return &Struct{
 			Type:   expect,
 			Fields: fields,
@@ -769,14 +994,25 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 	case *parse.Unary:
 		switch expr.Opera.Kind {
 		case lex.SUB:
+			// 负数字面量
+			switch literal := expr.Value.(type) {
+			case *parse.Int:
+				return analyseInteger(expect, literal, true, expr.Position())
+			case *parse.Float:
+				return analyseFloat(expect, literal, true, expr.Position())
+			}
 			value, err := analyseExpr(ctx, expect, expr.Value)
 			if err != nil {
 				return nil, err
 			}
-			if !IsNumberTypeAndSon(value.GetType()) {
+			if res, ok, err := analyseUnaryOverload(ctx, value, expr); ok {
+				return res, err
+			}
+			if !IsNumberTypeAndSon(GetScalarType(value.GetType())) {
 				return nil, utils.Errorf(expr.Value.Position(), "expect a number")
 			}
 			return &Binary{
+				Pos:   expr.Position(),
 				Opera: "-",
 				Left:  getDefaultExprByType(value.GetType()),
 				Right: value,
@@ -786,26 +1022,45 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			if err != nil {
 				return nil, err
 			}
-			if !IsSintTypeAndSon(value.GetType()) {
-				return nil, utils.Errorf(expr.Value.Position(), "expect a signed integer")
+			if res, ok, err := analyseUnaryOverload(ctx, value, expr); ok {
+				return res, err
+			}
+			vt := value.GetType()
+			if !IsIntTypeAndSon(GetScalarType(vt)) {
+				return nil, utils.Errorf(expr.Value.Position(), "expect a integer")
+			}
+			var ones Expr = &Integer{
+				Type:  GetScalarType(vt),
+				Value: big.NewInt(-1),
+			}
+			if IsVecTypeAndSon(vt) {
+				ones = &Covert{From: ones, To: vt}
 			}
 			return &Binary{
+				Pos:   expr.Position(),
 				Opera: "^",
 				Left:  value,
-				Right: &Integer{
-					Type:  value.GetType(),
-					Value: -1,
-				},
+				Right: ones,
 			}, nil
 		case lex.NOT:
-			if expect == nil || !GetBaseType(expect).Equal(Bool) {
+			if expect == nil || !GetBaseType(GetScalarType(expect)).Equal(Bool) {
 				expect = Bool
 			}
-			value, err := expectExprAndSon(ctx, expect, expr.Value)
+			value, err := analyseExpr(ctx, expect, expr.Value)
 			if err != nil {
 				return nil, err
 			}
+			if res, ok, err := analyseUnaryOverload(ctx, value, expr); ok {
+				return res, err
+			}
+			// 布尔向量逐元素取反
+			if !isBoolVec(value.GetType()) {
+				if value, err = expectExprWithTypeAndSon(expr.Value.Position(), expect, value); err != nil {
+					return nil, err
+				}
+			}
 			return &Unary{
+				Pos:   expr.Position(),
 				Type:  value.GetType(),
 				Opera: "!",
 				Value: value,
@@ -820,8 +1075,11 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			}
 			if value.IsTemporary() {
 				return nil, utils.Errorf(expr.Value.Position(), "not expect a temporary value")
+			} else if field, ok := value.(*GetField); ok && field.IsBitField() {
+				return nil, utils.Errorf(expr.Value.Position(), "can not take the address of a bit-field")
 			}
 			return &Unary{
+				Pos:   expr.Position(),
 				Type:  NewPtrType(value.GetType()),
 				Opera: "&",
 				Value: value,
@@ -839,6 +1097,7 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 				return nil, utils.Errorf(expr.Value.Position(), "expect a pointer")
 			}
 			return &Unary{
+				Pos:   expr.Position(),
 				Type:  GetBaseType(vt).(*TypePtr).Elem,
 				Opera: "*",
 				Value: value,
@@ -847,10 +1106,20 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			panic("")
 		}
 	case *parse.Binary:
-		left, err := analyseExpr(ctx, nil, expr.Left)
+		var left Expr
+		var err utils.Error
+		if expr.Opera.Kind == lex.ASS {
+			left, err = analyseAssignTarget(ctx, expr.Left)
+		} else {
+			left, err = analyseExpr(ctx, nil, expr.Left)
+		}
 		if err != nil {
 			return nil, err
 		}
+		// 运算符重载
+		if res, ok, err := analyseBinaryOverload(ctx, left, expr); ok {
+			return res, err
+		}
 		lt := left.GetType()
 		right, err := expectExpr(ctx, lt, expr.Right)
 		if err != nil {
@@ -864,17 +1133,30 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			switch expr.Opera.Kind {
 			case lex.ASS:
 			case lex.ADS, lex.SUS, lex.MUS, lex.DIS, lex.MOS:
-				if !IsNumberTypeAndSon(lt) {
+				if !IsNumberTypeAndSon(GetScalarType(lt)) {
 					return nil, utils.Errorf(expr.Left.Position(), "expect a number")
 				}
-			case lex.ANS, lex.ORS, lex.XOS, lex.SLS, lex.SRS:
-				if !IsIntTypeAndSon(lt) {
+			case lex.ANS, lex.ORS, lex.XOS:
+				if !IsIntTypeAndSon(GetScalarType(lt)) && !isBoolVec(lt) {
+					return nil, utils.Errorf(expr.Left.Position(), "expect a integer")
+				}
+			case lex.SLS, lex.SRS:
+				if !IsIntTypeAndSon(GetScalarType(lt)) {
 					return nil, utils.Errorf(expr.Left.Position(), "expect a integer")
 				}
 			default:
 				panic("unknown binary")
 			}
+			if expr.Opera.Kind == lex.ASS {
+				if right, err = moveValue(ctx, expr.Right.Position(), right); err != nil {
+					return nil, err
+				}
+				if v, ok := left.(*Variable); ok {
+					ctx.markAssigned(v)
+				}
+			}
 			return &Assign{
+				Pos:   expr.Position(),
 				Opera: expr.Opera.Source,
 				Left:  left,
 				Right: right,
@@ -884,13 +1166,29 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 				return nil, utils.Errorf(expr.Left.Position(), "expect a boolean")
 			}
 		case lex.EQ, lex.NE:
+			// 字符串按内容比较
+			if f := ctx.GetPackageContext().f.getStringFunc("equal"); f != nil && ctx.GetPackageContext().f.isStringType(lt) {
+				var res Expr = &FuncCall{
+					Func: f,
+					Args: []Expr{left, right},
+				}
+				if expr.Opera.Kind == lex.NE {
+					res = &Unary{
+						Pos:   expr.Position(),
+						Type:  res.GetType(),
+						Opera: "!",
+						Value: res,
+					}
+				}
+				return res, nil
+			}
 			return &Equal{
 				Opera: expr.Opera.Source,
 				Left:  left,
 				Right: right,
 			}, nil
 		case lex.LT, lex.LE, lex.GT, lex.GE:
-			if !IsNumberTypeAndSon(lt) {
+			if !IsNumberTypeAndSon(GetScalarType(lt)) {
 				return nil, utils.Errorf(expr.Left.Position(), "expect a number")
 			}
 			return &Equal{
@@ -899,21 +1197,30 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 				Right: right,
 			}, nil
 		case lex.ADD, lex.SUB, lex.MUL, lex.DIV, lex.MOD:
-			if !IsNumberTypeAndSon(lt) {
+			if !IsNumberTypeAndSon(GetScalarType(lt)) {
 				return nil, utils.Errorf(expr.Left.Position(), "expect a number")
 			}
-		case lex.AND, lex.OR, lex.XOR, lex.SHL, lex.SHR:
-			if !IsIntTypeAndSon(lt) {
+		case lex.AND, lex.OR, lex.XOR:
+			if !IsIntTypeAndSon(GetScalarType(lt)) && !isBoolVec(lt) {
+				return nil, utils.Errorf(expr.Left.Position(), "expect a integer")
+			}
+		case lex.SHL, lex.SHR:
+			if !IsIntTypeAndSon(GetScalarType(lt)) {
 				return nil, utils.Errorf(expr.Left.Position(), "expect a integer")
 			}
 		default:
 			panic("unknown binary")
 		}
 		return &Binary{
+			Pos:   expr.Position(),
 			Opera: expr.Opera.Source,
 			Left:  left,
 			Right: right,
 		}, nil
+	case *parse.Try:
+		return analyseTry(ctx, expr)
+	case *parse.Asm:
+		return analyseAsm(ctx, expr)
 	case *parse.Ternary:
 		cond, err := expectExprAndSon(ctx, Bool, expr.Cond)
 		if err != nil {
@@ -936,7 +1243,7 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		f, err := analyseExpr(ctx, nil, expr.Func)
 		if err != nil {
 			if ident, ok := expr.Func.(*parse.Ident); ok && ident.Pkg == nil {
-				return analyseBuildInFuncCall(ctx, ident, expr.Args)
+				return analyseBuildInFuncCall(ctx, expect, ident, expr.Args)
 			}
 			return nil, err
 		}
@@ -946,6 +1253,15 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		}
 
 		if method, ok := f.(*Method); ok {
+			if args, ok, err := analyseFormatCallArgs(ctx, ft.Params[1:], expr.Args); ok {
+				if err != nil {
+					return nil, err
+				}
+				return &MethodCall{
+					Method: method,
+					Args:   args,
+				}, nil
+			}
 			if len(ft.Params)-1 != len(expr.Args) {
 				return nil, utils.Errorf(expr.Func.Position(), "expect %d arguments", len(ft.Params)-1)
 			}
@@ -970,7 +1286,18 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 				Args:   args,
 			}, nil
 		} else {
-			if len(ft.Params) != len(expr.Args) {
+			if args, ok, err := analyseFormatCallArgs(ctx, ft.Params, expr.Args); ok {
+				if err != nil {
+					return nil, err
+				}
+				return &FuncCall{
+					Func: f,
+					Args: args,
+				}, nil
+			}
+			if ft.VarArg && len(ft.Params) > len(expr.Args) {
+				return nil, utils.Errorf(expr.Func.Position(), "expect at least %d arguments", len(ft.Params))
+			} else if !ft.VarArg && len(ft.Params) != len(expr.Args) {
 				return nil, utils.Errorf(expr.Func.Position(), "expect %d arguments", len(ft.Params))
 			}
 
@@ -983,6 +1310,13 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 					errs = append(errs, err)
 				}
 			}
+			for i := len(ft.Params); i < len(expr.Args); i++ {
+				var err utils.Error
+				args[i], err = analyseVarArg(ctx, expr.Args[i])
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
 			if len(errs) == 1 {
 				return nil, errs[0]
 			} else if len(errs) > 1 {
@@ -1002,22 +1336,13 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 
 		// 方法
 		prefixType := prefix.GetType()
-		if IsTypedef(prefixType) || (IsPtrType(prefixType) && IsTypedef(prefixType.(*TypePtr).Elem)) {
-			var _selfType *Typedef
-			if td, ok := prefixType.(*Typedef); ok {
-				_selfType = td
-			} else {
-				_selfType = prefixType.(*TypePtr).Elem.(*Typedef)
-			}
-
-			funcName := _selfType.String() + "." + expr.End.Source
-			if funcObj := ctx.GetValue(funcName); funcObj != nil {
-				fun := funcObj.(*Function)
-				return &Method{
-					Self: prefix,
-					Func: fun,
-				}, nil
-			}
+		_selfType := prefixType
+		if pt, ok := prefixType.(*TypePtr); ok {
+			_selfType = pt.Elem
+		}
+		if fun := lookupMethod(ctx, _selfType, expr.End.Source); fun != nil {
+			ctx.GetPackageContext().f.warnDeprecated(expr.End.Pos, expr.End.Source, fun.Deprecated)
+			return bindMethod(expr.End.Pos, prefix, fun, expr.End.Source)
 		}
 
 		// 属性
@@ -1028,6 +1353,7 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			} else if td, ok := prefixType.(*Typedef); ok && ctx.GetPackageContext().path != td.Pkg && !t.Fields.Get(expr.End.Source).First {
 				return nil, utils.Errorf(expr.End.Pos, "unknown identifier")
 			}
+			warnDeprecatedField(ctx, t, expr.End)
 			return &GetField{
 				From:  prefix,
 				Index: expr.End.Source,
@@ -1042,8 +1368,10 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			} else if td, ok := t.Elem.(*Typedef); ok && ctx.GetPackageContext().path != td.Pkg && !st.Fields.Get(expr.End.Source).First {
 				return nil, utils.Errorf(expr.End.Pos, "unknown identifier")
 			}
+			warnDeprecatedField(ctx, st, expr.End)
 			return &GetField{
 				From: &Unary{
+					Pos:   expr.Position(),
 					Type:  t.Elem,
 					Opera: "*",
 					Value: prefix,
@@ -1057,6 +1385,9 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 		if err != nil {
 			return nil, err
 		}
+		if res, ok, err := analyseIndexOverload(ctx, prefix, expr); ok {
+			return res, err
+		}
 		switch pt := GetBaseType(prefix.GetType()).(type) {
 		case *TypeArray:
 			index, err := autoExpectExpr(ctx, Usize, expr.Index)
@@ -1064,6 +1395,18 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 				return nil, err
 			}
 			return &Index{
+				Pos:   expr.Position(),
+				Type:  pt.Elem,
+				From:  prefix,
+				Index: index,
+			}, nil
+		case *TypeVec:
+			index, err := autoExpectExpr(ctx, Usize, expr.Index)
+			if err != nil {
+				return nil, err
+			}
+			return &Index{
+				Pos:   expr.Position(),
 				Type:  pt.Elem,
 				From:  prefix,
 				Index: index,
@@ -1074,6 +1417,7 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 				return nil, err
 			}
 			return &Index{
+				Pos:   expr.Position(),
 				Type:  pt.Elem,
 				From:  prefix,
 				Index: index,
@@ -1086,9 +1430,12 @@ func analyseExpr(ctx *blockContext, expect Type, ast parse.Expr) (Expr, utils.Er
 			literal, ok := index.(*Integer)
 			if !ok {
 				return nil, utils.Errorf(expr.Index.Position(), "expect a integer literal")
+			} else if literal.Value.Cmp(big.NewInt(int64(len(pt.Elems)))) >= 0 {
+				return nil, utils.Errorf(expr.Index.Position(), "index %s out of range [0, %d)", literal.Value, len(pt.Elems))
 			}
 			return &Index{
-				Type:  pt.Elems[literal.Value],
+				Pos:   expr.Position(),
+				Type:  pt.Elems[literal.Value.Int64()],
 				From:  prefix,
 				Index: literal,
 			}, nil
@@ -1170,17 +1517,17 @@ func getDefaultExprByType(t Type) Expr {
 		switch {
 		case IsNoneType(t):
 			panic("")
-		case IsIntType(t):
+		case IsIntTypeAndSon(t):
 			return &Integer{
 				Type:  t,
-				Value: 0,
+				Value: big.NewInt(0),
 			}
-		case IsFloatType(t):
+		case IsFloatTypeAndSon(t):
 			return &Float{
 				Type:  t,
 				Value: 0,
 			}
-		case IsBoolType(t):
+		case IsBoolTypeAndSon(t):
 			return &Boolean{
 				Type:  t,
 				Value: false,
@@ -1190,7 +1537,7 @@ func getDefaultExprByType(t Type) Expr {
 		}
 	case *TypeFunc:
 		return &Null{Type: t}
-	case *TypeArray:
+	case *TypeArray, *TypeVec:
 		return &EmptyArray{Type: t}
 	case *TypeTuple:
 		return &EmptyTuple{Type: t}
@@ -1231,27 +1578,54 @@ func analyseExprList(ctx *blockContext, expects []Type, asts []parse.Expr) ([]Ex
 
 // 标识符
 func analyseIdent(ctx *blockContext, ast *parse.Ident) (Expr, utils.Error) {
+	var v Ident
 	if ast.Pkg == nil {
-		v := ctx.GetValue(ast.Name.Source)
+		v = ctx.GetValue(ast.Name.Source)
 		if v == nil {
 			return nil, utils.Errorf(ast.Position(), "unknown identifier")
 		}
-		return v, nil
+	} else if pkg := ctx.GetPackageContext().externs[ast.Pkg.Source]; ast.Type != nil || pkg == nil {
+		return analyseAssocIdent(ctx, ast)
 	} else {
-		pkg := ctx.GetPackageContext().externs[ast.Pkg.Source]
-		if pkg == nil {
-			return nil, utils.Errorf(ast.Pkg.Pos, "unknown identifier")
-		}
 		value := pkg.GetValue(ast.Name.Source)
 		if !value.First || value.Second == nil {
 			return nil, utils.Errorf(ast.Name.Pos, "unknown identifier")
 		}
-		return value.Second, nil
+		v = value.Second
+	}
+	switch value := v.(type) {
+	case *Variable:
+		if pos, ok := ctx.getMoved(value); ok {
+			return nil, utils.Errorf(ast.Position(), "use of moved variable `%s` (moved at %d:%d)", ast.Name.Source, pos.BeginRow, pos.BeginCol)
+		}
+	case *Function:
+		ctx.GetPackageContext().f.warnDeprecated(ast.Position(), ast.Name.Source, value.Deprecated)
+	case *GlobalVariable:
+		ctx.GetPackageContext().f.warnDeprecated(ast.Position(), ast.Name.Source, value.Deprecated)
+	}
+	return v, nil
+}
+
+// 类型的关联函数或者方法T::f、pkg::T::f，方法的接收者为第一个参数
+func analyseAssocIdent(ctx *blockContext, ast *parse.Ident) (Expr, utils.Error) {
+	typeAst := parse.NewTypeIdent(nil, *ast.Pkg)
+	if ast.Type != nil {
+		typeAst = parse.NewTypeIdent(ast.Pkg, *ast.Type)
+	}
+	t, err := analyseType(ctx.GetPackageContext(), typeAst)
+	if err != nil {
+		return nil, utils.Errorf(typeAst.Position(), "unknown identifier")
 	}
+	f := lookupMethod(ctx, t, ast.Name.Source)
+	if f == nil {
+		return nil, utils.Errorf(ast.Name.Pos, "unknown identifier")
+	}
+	ctx.GetPackageContext().f.warnDeprecated(ast.Position(), ast.Name.Source, f.Deprecated)
+	return f, nil
 }
 
 // 内置函数调用
-func analyseBuildInFuncCall(ctx *blockContext, ident *parse.Ident, paramAsts []parse.Expr) (Expr, utils.Error) {
+func analyseBuildInFuncCall(ctx *blockContext, expect Type, ident *parse.Ident, paramAsts []parse.Expr) (Expr, utils.Error) {
 	switch ident.Name.Source {
 	case "len":
 		if len(paramAsts) != 1 {
@@ -1261,12 +1635,16 @@ func analyseBuildInFuncCall(ctx *blockContext, ident *parse.Ident, paramAsts []p
 		if err != nil {
 			return nil, err
 		}
-		pt := param.GetType()
-		array, ok := GetBaseType(pt).(*TypeArray)
-		if ok {
+		switch t := GetBaseType(param.GetType()).(type) {
+		case *TypeArray:
 			return &Integer{
 				Type:  Usize,
-				Value: int64(array.Size),
+				Value: big.NewInt(int64(t.Size)),
+			}, nil
+		case *TypeVec:
+			return &Integer{
+				Type:  Usize,
+				Value: big.NewInt(int64(t.Size)),
 			}, nil
 		}
 		return nil, utils.Errorf(paramAsts[0].Position(), "expect a array")
@@ -1283,6 +1661,23 @@ func analyseBuildInFuncCall(ctx *blockContext, ident *parse.Ident, paramAsts []p
 			Value: param.GetType().String(),
 		}, nil
 	case "size":
+		if len(paramAsts) != 1 {
+			return nil, utils.Errorf(ident.Position(), "expect 1 arguments")
+		}
+		param, err := analyseExpr(ctx, nil, paramAsts[0])
+		// 参数也可以是类型，与函数同名时（如posix的stat）优先作为类型
+		if _, isFunc := param.(*Function); err != nil || isFunc {
+			if typeAst := exprToTypeAst(paramAsts[0]); typeAst != nil {
+				if t, terr := analyseType(ctx.GetPackageContext(), typeAst); terr == nil {
+					return &GetTypeBytes{Type: t}, nil
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &GetTypeBytes{Type: param.GetType()}, nil
+	case "hash":
 		if len(paramAsts) != 1 {
 			return nil, utils.Errorf(ident.Position(), "expect 1 arguments")
 		}
@@ -1290,17 +1685,506 @@ func analyseBuildInFuncCall(ctx *blockContext, ident *parse.Ident, paramAsts []p
 		if err != nil {
 			return nil, err
 		}
-		return &GetTypeBytes{Type: param.GetType()}, nil
+		return analyseHash(ctx, paramAsts[0].Position(), param)
+	case "move":
+		if len(paramAsts) != 1 {
+			return nil, utils.Errorf(ident.Position(), "expect 1 arguments")
+		}
+		param, err := analyseExpr(ctx, nil, paramAsts[0])
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := param.(*Variable); ok {
+			ctx.markMoved(paramAsts[0].Position(), v)
+			return &Move{Value: v}, nil
+		} else if param.IsTemporary() {
+			return nil, utils.Errorf(paramAsts[0].Position(), "can not move a temporary value")
+		} else if !param.GetMut() {
+			return nil, utils.Errorf(paramAsts[0].Position(), "can not move out of an immutable value")
+		}
+		return &Move{Value: param}, nil
+	case "drop":
+		if len(paramAsts) != 1 {
+			return nil, utils.Errorf(ident.Position(), "expect 1 arguments")
+		}
+		param, err := analyseExpr(ctx, nil, paramAsts[0])
+		if err != nil {
+			return nil, err
+		} else if IsNoneType(param.GetType()) {
+			return nil, utils.Errorf(paramAsts[0].Position(), "expect a value")
+		}
+		if v, ok := param.(*Variable); ok && NeedDrop(v.Type) {
+			ctx.markMoved(paramAsts[0].Position(), v)
+		} else if param.IsTemporary() && NeedDrop(param.GetType()) {
+			// 立即析构的临时值不再在语句结束时析构
+			param = &Move{Value: param}
+		}
+		return &Drop{Value: param}, nil
+	case "ok", "err", "some", "none":
+		return analyseResult(ctx, expect, ident, paramAsts)
+	case "panic":
+		if len(paramAsts) != 1 {
+			return nil, utils.Errorf(ident.Position(), "expect 1 arguments")
+		}
+		p := &Panic{Pos: ident.Position()}
+		if err := analysePanicMsg(ctx, p, paramAsts[0]); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "assert":
+		if len(paramAsts) != 1 && len(paramAsts) != 2 {
+			return nil, utils.Errorf(ident.Position(), "expect 1 or 2 arguments")
+		}
+		cond, err := expectExpr(ctx, Bool, paramAsts[0])
+		if err != nil {
+			return nil, err
+		}
+		p := &Panic{Pos: ident.Position(), Cond: cond, Text: "assertion failed"}
+		if len(paramAsts) == 2 {
+			if err = analysePanicMsg(ctx, p, paramAsts[1]); err != nil {
+				return nil, err
+			}
+		} else if text, ok := paramAsts[0].Position().Text(); ok {
+			p.Text += ": " + text
+		}
+		return p, nil
+	case "atomic_load", "atomic_store", "atomic_cas", "atomic_fetch_add", "atomic_fetch_sub":
+		return analyseAtomic(ctx, ident, paramAsts)
+	case "volatile_load", "volatile_store":
+		return analyseVolatile(ctx, ident, paramAsts)
+	case "shuffle":
+		return analyseShuffle(ctx, ident, paramAsts)
+	case "reduce_add", "reduce_mul", "reduce_min", "reduce_max", "reduce_and", "reduce_or", "reduce_xor":
+		return analyseReduce(ctx, ident, paramAsts)
 	default:
 		return nil, utils.Errorf(ident.Position(), "unknown identifier")
 	}
 }
 
+// 报错信息，可以是*i8或者String
+func analysePanicMsg(ctx *blockContext, p *Panic, ast parse.Expr) utils.Error {
+	msg, err := analyseExpr(ctx, nil, ast)
+	if err != nil {
+		return err
+	}
+	mt := msg.GetType()
+	if ctx.GetPackageContext().f.isStringType(mt) {
+		p.MsgIsString = true
+	} else if !NewPtrType(I8).Equal(mt) {
+		return utils.Errorf(ast.Position(), "expect type `*i8` or `String` but there is `%s`", mt)
+	}
+	p.Msg = msg
+	return nil
+}
+
+// 易变读写，只能用于指向整数、浮点数、布尔值或者指针的指针
+func analyseVolatile(ctx *blockContext, ident *parse.Ident, paramAsts []parse.Expr) (Expr, utils.Error) {
+	store := ident.Name.Source == "volatile_store"
+	argc := stlutil.Ternary(store, 2, 1)
+	if len(paramAsts) != argc {
+		return nil, utils.Errorf(ident.Position(), "expect %d arguments", argc)
+	}
+	ptr, err := analyseExpr(ctx, nil, paramAsts[0])
+	if err != nil {
+		return nil, err
+	}
+	pt, ok := GetBaseType(ptr.GetType()).(*TypePtr)
+	if !ok || !(IsNumberTypeAndSon(pt.Elem) || IsBoolTypeAndSon(pt.Elem) || IsPtrTypeAndSon(pt.Elem) || IsFuncTypeAndSon(pt.Elem)) {
+		return nil, utils.Errorf(paramAsts[0].Position(), "expect a pointer to integer, float, bool or pointer but there is `%s`", ptr.GetType())
+	}
+	v := &Volatile{Ptr: ptr}
+	if store {
+		if v.Value, err = expectExpr(ctx, pt.Elem, paramAsts[1]); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// 结果类型（std.result中的Result或Option）的成员类型
+func resultFieldType(t Type, name string) Type {
+	return GetBaseType(t).(*TypeStruct).Fields.Get(name).Second
+}
+
+// 构造结果（ok(v)、err(e)、some(v)、none()），类型由期待的类型决定，未使用的成员为零值
+func analyseResult(ctx *blockContext, expect Type, ident *parse.Ident, paramAsts []parse.Expr) (Expr, utils.Error) {
+	name := ident.Name.Source
+	generic, flag, field := "Result", "ok", "value"
+	switch name {
+	case "err":
+		field = "error"
+	case "some", "none":
+		generic, flag = "Option", "some"
+	}
+	if expect == nil || !ctx.GetPackageContext().f.isResultType(expect, generic) {
+		return nil, utils.Errorf(ident.Position(), "can not infer the type of `%s`, expect a `%s` type", name, generic)
+	}
+	argc := 1
+	if name == "none" {
+		argc = 0
+	}
+	if len(paramAsts) != argc {
+		return nil, utils.Errorf(ident.Position(), "expect %d arguments", argc)
+	}
+
+	var value Expr
+	if argc != 0 {
+		v, err := expectExpr(ctx, resultFieldType(expect, field), paramAsts[0])
+		if err != nil {
+			return nil, err
+		}
+		if value, err = moveValue(ctx, paramAsts[0].Position(), v); err != nil {
+			return nil, err
+		}
+	}
+	// 按名字填充成员，不依赖std.result中成员的顺序
+	st := GetBaseType(expect).(*TypeStruct)
+	fields := make([]Expr, st.Fields.Length())
+	for iter := st.Fields.Begin(); iter.HasValue(); iter.Next() {
+		switch {
+		case iter.Key() == flag:
+			fields[iter.Index()] = &Boolean{Type: Bool, Value: name == "ok" || name == "some"}
+		case iter.Key() == field && value != nil:
+			fields[iter.Index()] = value
+		default:
+			fields[iter.Index()] = getDefaultExprByType(iter.Value().Second)
+		}
+	}
+	return &Struct{
+		Type:   expect,
+		Fields: fields,
+	}, nil
+}
+
+// 错误传播，Result的错误类型必须与函数返回的Result相同
+func analyseTry(ctx *blockContext, ast *parse.Try) (Expr, utils.Error) {
+	value, err := analyseExpr(ctx, nil, ast.Value)
+	if err != nil {
+		return nil, err
+	}
+	pctx := ctx.GetPackageContext().f
+	vt, ret := value.GetType(), ctx.GetRetType()
+	isResult := pctx.isResultType(vt, "Result")
+	if !isResult && !pctx.isResultType(vt, "Option") {
+		return nil, utils.Errorf(ast.Value.Position(), "expect a `Result` or `Option` but there is `%s`", vt)
+	} else if ctx.IsInDefer() {
+		return nil, utils.Errorf(ast.Position(), "can not use `?` in defer")
+	}
+	if isResult {
+		if !pctx.isResultType(ret, "Result") {
+			return nil, utils.Errorf(ast.Position(), "can not use `?` on `Result` in a function returning `%s`", ret)
+		} else if et := resultFieldType(vt, "error"); !et.Equal(resultFieldType(ret, "error")) {
+			return nil, utils.Errorf(ast.Position(), "expect error type `%s` but there is `%s`", resultFieldType(ret, "error"), et)
+		}
+	} else if !pctx.isResultType(ret, "Option") {
+		return nil, utils.Errorf(ast.Position(), "can not use `?` on `Option` in a function returning `%s`", ret)
+	}
+	if value, err = moveValue(ctx, ast.Value.Position(), value); err != nil {
+		return nil, err
+	}
+	return &Try{
+		Value:    value,
+		Ret:      ret,
+		IsResult: isResult,
+	}, nil
+}
+
+// 需要析构的值作为整体被保存（定义变量、赋值、返回、作为字面量的元素和结果的值）时转移所有权：
+// 局部变量被移出，避免离开作用域时被析构；临时值用Move标记，不再在语句结束时析构；
+// 解引用、成员、下标等位置不能隐式复制，需要使用move(...)或者.clone()；
+// 作为函数参数时只是借用，需要转移所有权时使用move(x)
+func moveValue(ctx *blockContext, pos utils.Position, v Expr) (Expr, utils.Error) {
+	if !NeedDrop(v.GetType()) {
+		return v, nil
+	}
+	switch value := v.(type) {
+	case *Variable:
+		ctx.markMoved(pos, value)
+		return &Move{Value: value}, nil
+	case *Param:
+		return v, nil
+	case *Select:
+		var err utils.Error
+		if value.True, err = moveValue(ctx, pos, value.True); err != nil {
+			return nil, err
+		}
+		if value.False, err = moveValue(ctx, pos, value.False); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case *Covert:
+		if NeedDrop(value.From.GetType()) {
+			var err utils.Error
+			if value.From, err = moveValue(ctx, pos, value.From); err != nil {
+				return nil, err
+			}
+			return value, nil
+		}
+	}
+	if !v.IsTemporary() {
+		return nil, utils.Errorf(pos, "can not implicitly copy a value of type `%s` which needs drop, use `move(...)` or `.clone()`", v.GetType())
+	}
+	return &Move{Value: v}, nil
+}
+
+// 赋值的目标，已经被移出的局部变量可以重新赋值
+func analyseAssignTarget(ctx *blockContext, ast parse.Expr) (Expr, utils.Error) {
+	if ident, ok := ast.(*parse.Ident); ok && ident.Pkg == nil {
+		if v, ok := ctx.GetValue(ident.Name.Source).(*Variable); ok {
+			return v, nil
+		}
+	}
+	return analyseExpr(ctx, nil, ast)
+}
+
+// 字面量的元素
+func moveElems(ctx *blockContext, asts []parse.Expr, elems []Expr) utils.Error {
+	for i, e := range elems {
+		var err utils.Error
+		if elems[i], err = moveValue(ctx, asts[i].Position(), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 哈希值，类型定义有方法hash() u64时调用该方法，否则按成员计算
+func analyseHash(ctx *blockContext, pos utils.Position, v Expr) (Expr, utils.Error) {
+	temp := &Variable{Type: v.GetType(), Value: v}
+	hash := &Hash{Temp: temp}
+	if err := collectHashValues(ctx, pos, hash, temp); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// 收集参与哈希计算的值
+func collectHashValues(ctx *blockContext, pos utils.Position, hash *Hash, v Expr) utils.Error {
+	t := v.GetType()
+	if td, ok := t.(*Typedef); ok {
+		if f := lookupMethod(ctx, td, "hash"); f != nil {
+			ft := f.GetType().(*TypeFunc)
+			if len(ft.Params) != 1 || !ft.Ret.Equal(U64) {
+				return utils.Errorf(pos, "method `hash` of type `%s` must be `func() u64`", td)
+			}
+			method, err := bindMethod(pos, v, f, "hash")
+			if err != nil {
+				return err
+			}
+			hash.Values = append(hash.Values, &MethodCall{Method: method})
+			return nil
+		}
+	}
+
+	switch bt := GetBaseType(t).(type) {
+	case *typeBasic:
+		if !IsIntType(bt) && !IsBoolType(bt) {
+			break
+		}
+		hash.Values = append(hash.Values, &Covert{From: v, To: U64})
+		// 128位整数的高64位
+		if IsIntType(bt) && getIntTypeBits(bt) > 64 {
+			high := &Binary{Pos: pos, Opera: ">>", Left: v, Right: &Integer{Type: t, Value: big.NewInt(64)}}
+			hash.Values = append(hash.Values, &Covert{From: high, To: U64})
+		}
+		return nil
+	case *TypePtr, *TypeFunc:
+		hash.Values = append(hash.Values, &Covert{From: &Covert{From: v, To: Usize}, To: U64})
+		return nil
+	case *TypeVec:
+		for i := uint(0); i < bt.Size; i++ {
+			elem := &Index{
+				Pos:   pos,
+				Type:  bt.Elem,
+				From:  v,
+				Index: &Integer{Type: Usize, Value: big.NewInt(int64(i))},
+			}
+			if err := collectHashValues(ctx, pos, hash, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *TypeArray:
+		for i := uint(0); i < bt.Size; i++ {
+			elem := &Index{
+				Pos:   pos,
+				Type:  bt.Elem,
+				From:  v,
+				Index: &Integer{Type: Usize, Value: big.NewInt(int64(i))},
+			}
+			if err := collectHashValues(ctx, pos, hash, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *TypeTuple:
+		for i, et := range bt.Elems {
+			elem := &Index{
+				Pos:   pos,
+				Type:  et,
+				From:  v,
+				Index: &Integer{Type: Usize, Value: big.NewInt(int64(i))},
+			}
+			if err := collectHashValues(ctx, pos, hash, elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *TypeStruct:
+		if bt.Union {
+			break
+		}
+		for iter := bt.Fields.Begin(); iter.HasValue(); iter.Next() {
+			if err := collectHashValues(ctx, pos, hash, &GetField{From: v, Index: iter.Key()}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return utils.Errorf(pos, "can not hash type `%s`", t)
+}
+
+// 访问弃用的字段时产生警告
+func warnDeprecatedField(ctx *blockContext, st *TypeStruct, name lex.Token) {
+	if msg, ok := st.Deprecated[name.Source]; ok {
+		ctx.GetPackageContext().f.warnDeprecated(name.Pos, name.Source, &msg)
+	}
+}
+
+// 查找类型的方法，其他包中的类型定义只能找到公开方法，找不到时查找本包中为该类型定义的方法
+func lookupMethod(ctx *blockContext, t Type, name string) *Function {
+	funcName := t.String() + "." + name
+	pkgCtx := ctx.GetPackageContext()
+	if td, ok := t.(*Typedef); ok && td.Pkg != pkgCtx.path {
+		if typePkg := pkgCtx.f.importedPackageSet[td.Pkg]; typePkg != nil {
+			if v := typePkg.globals[funcName]; v.First {
+				return v.Second.(*Function)
+			}
+		}
+	}
+	if f, ok := ctx.GetValue(funcName).(*Function); ok {
+		return f
+	}
+	return nil
+}
+
+// 绑定方法的接收者，值接收者的指针自动解引用，指针接收者不能是临时值
+func bindMethod(pos utils.Position, self Expr, f *Function, name string) (*Method, utils.Error) {
+	st := self.GetType()
+	switch f.Receiver {
+	case ReceiverNone:
+		if pt, ok := st.(*TypePtr); ok {
+			st = pt.Elem
+		}
+		typeName := st.String()
+		if td, ok := st.(*Typedef); ok {
+			typeName = td.Name
+		}
+		return nil, utils.Errorf(pos, "associated function `%s` must be called by `%s::%s`", name, typeName, name)
+	case ReceiverValue:
+		if IsPtrType(st) && !st.Equal(f.Params[0].Type) {
+			self = &Unary{
+				Pos:   pos,
+				Type:  st.(*TypePtr).Elem,
+				Opera: "*",
+				Value: self,
+			}
+		}
+	case ReceiverPtr:
+		if field, ok := self.(*GetField); !IsPtrType(st) && (!self.GetMut() || (ok && field.IsBitField())) {
+			return nil, utils.Errorf(pos, "can not call method `%s` with pointer receiver on a temporary value", name)
+		}
+	}
+	return &Method{
+		Self: self,
+		Func: f,
+	}, nil
+}
+
+// 将表达式形式的类型（如size的参数）转换为类型，不能转换时返回nil
+func exprToTypeAst(ast parse.Expr) parse.Type {
+	switch expr := ast.(type) {
+	case *parse.Ident:
+		return parse.NewTypeIdent(expr.Pkg, expr.Name)
+	case *parse.Index:
+		// 泛型类型实参
+		ident, ok := expr.Front.(*parse.Ident)
+		arg := exprToTypeAst(expr.Index)
+		if !ok || arg == nil {
+			return nil
+		}
+		t := parse.NewTypeIdent(ident.Pkg, ident.Name)
+		t.Args = []parse.Type{arg}
+		return t
+	case *parse.Unary:
+		elem := exprToTypeAst(expr.Value)
+		if expr.Opera.Kind != lex.MUL || elem == nil {
+			return nil
+		}
+		return parse.NewTypePtr(ast.Position(), elem)
+	default:
+		return nil
+	}
+}
+
+// 可变参数，进行默认参数提升
+func analyseVarArg(ctx *blockContext, ast parse.Expr) (Expr, utils.Error) {
+	arg, err := analyseExpr(ctx, nil, ast)
+	if err != nil {
+		return nil, err
+	}
+	at := arg.GetType()
+	switch t := GetBaseType(at).(type) {
+	case *typeBasic:
+		switch {
+		case IsNoneType(t):
+			return nil, utils.Errorf(ast.Position(), "expect a value")
+		case t == F32:
+			return &Covert{From: arg, To: F64}, nil
+		case t == I8 || t == I16 || t == U8 || t == U16 || t == Bool:
+			// 都可以用int表示，按c的规则提升为int
+			return &Covert{From: arg, To: I32}, nil
+		}
+	case *TypePtr, *TypeFunc:
+	default:
+		return nil, utils.Errorf(ast.Position(), "can not pass type `%s` as a variadic argument", at)
+	}
+	return arg, nil
+}
+
 // 类型转换
 func analyseCovert(v Expr, t Type) *Covert {
 	ft := v.GetType()
+	// 标量转换为向量时先转换为元素类型，再广播到每个元素
+	if vt, ok := GetBaseType(t).(*TypeVec); ok && IsBasicType(GetBaseType(ft)) {
+		if !GetBaseType(ft).Equal(vt.Elem) {
+			if !canCovertVecElem(GetBaseType(ft), vt.Elem) {
+				return nil
+			}
+			v = &Covert{From: v, To: vt.Elem}
+		}
+		return &Covert{From: v, To: t}
+	}
 	switch {
 	case GetDepthBaseType(ft).Equal(GetDepthBaseType(t)):
+	case IsVecTypeAndSon(ft) && IsVecTypeAndSon(t):
+		// 逐元素转换
+		fv, tv := GetBaseType(ft).(*TypeVec), GetBaseType(t).(*TypeVec)
+		if fv.Size != tv.Size || !canCovertVecElem(fv.Elem, tv.Elem) {
+			return nil
+		}
+	case IsVecTypeAndSon(ft) && IsArrayTypeAndSon(t), IsArrayTypeAndSon(ft) && IsVecTypeAndSon(t):
+		// 数组和向量互相转换
+		var vt *TypeVec
+		var at *TypeArray
+		if IsVecTypeAndSon(ft) {
+			vt, at = GetBaseType(ft).(*TypeVec), GetBaseType(t).(*TypeArray)
+		} else {
+			vt, at = GetBaseType(t).(*TypeVec), GetBaseType(ft).(*TypeArray)
+		}
+		if vt.Size != at.Size || !vt.Elem.Equal(GetBaseType(at.Elem)) {
+			return nil
+		}
 	case IsNumberTypeAndSon(ft) && IsNumberTypeAndSon(t):
 	case GetBaseType(ft).Equal(Usize) && (IsPtrTypeAndSon(t) || IsFuncTypeAndSon(t)):
 	case (IsPtrTypeAndSon(ft) || IsFuncTypeAndSon(ft)) && GetBaseType(t).Equal(Usize):
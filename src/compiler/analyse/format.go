@@ -0,0 +1,529 @@
+package analyse
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/parse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// FormatPieces 格式化片段数组，值为指向第一个std.fmt.Piece的指针（没有片段时为null）
+type FormatPieces struct {
+	Type   Type
+	Temps  []*Variable // 格式化参数，只求值一次
+	Pieces []Expr
+}
+
+func (self FormatPieces) stmt() {}
+
+func (self FormatPieces) GetType() Type {
+	return self.Type
+}
+
+func (self FormatPieces) GetMut() bool {
+	return false
+}
+
+func (self FormatPieces) IsTemporary() bool {
+	return true
+}
+
+func (self FormatPieces) IsConst() bool {
+	return false
+}
+
+// 片段种类，与std/fmt中的KIND_*一致
+const (
+	pieceText uint8 = iota
+	pieceStr
+	pieceCStr
+	pieceInt
+	pieceUint
+	pieceFloat
+	pieceBool
+	piecePtr
+	pieceChar
+)
+
+// 格式标志，与std/fmt中的FLAG_*一致
+const (
+	formatLeft uint8 = 1 << iota
+	formatCenter
+	formatPlus
+	formatAlt
+	formatZero
+)
+
+// 格式说明，{[参数下标][:[对齐][+][#][0][宽度][.精度][类型]]}
+type formatSpec struct {
+	flags     uint8
+	width     uint32
+	precision int32 // 精度，-1为默认
+	verb      byte  // 格式类型，0为默认
+}
+
+// 格式字符串中的占位符
+type formatHole struct {
+	text  string // 占位符之前的文本
+	index int    // 参数下标
+	spec  formatSpec
+}
+
+// *********************************************************************************************************************
+
+// 格式化函数调用的参数，最后一个形参为std.fmt.Args且对应实参为字符串字面量时按格式字符串展开其后的实参，ok为false时不是格式化调用
+func analyseFormatCallArgs(ctx *blockContext, params []Type, asts []parse.Expr) (args []Expr, ok bool, err utils.Error) {
+	n := len(params)
+	if n == 0 || len(asts) < n || !ctx.GetPackageContext().f.isFormatArgsType(params[n-1]) {
+		return nil, false, nil
+	}
+	format, ok := asts[n-1].(*parse.String)
+	if !ok {
+		return nil, false, nil
+	}
+
+	args = make([]Expr, n)
+	var errs []utils.Error
+	for i, pt := range params[:n-1] {
+		var err utils.Error
+		args[i], err = expectExpr(ctx, pt, asts[i])
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	args[n-1], err = analyseFormatArgs(ctx, params[n-1], format, asts[n:])
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return nil, true, errs[0]
+	} else if len(errs) > 1 {
+		return nil, true, utils.NewMultiError(errs...)
+	}
+	return args, true, nil
+}
+
+// 格式化参数，将格式字符串和参数展开为std.fmt.Args
+func analyseFormatArgs(ctx *blockContext, argsType Type, format *parse.String, asts []parse.Expr) (Expr, utils.Error) {
+	holes, rest, err := parseFormatString(format.Position(), format.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	temps := make([]*Variable, len(asts))
+	var errs []utils.Error
+	for i, a := range asts {
+		v, err := analyseExpr(ctx, nil, a)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		} else if IsNoneType(v.GetType()) {
+			errs = append(errs, utils.Errorf(a.Position(), "expect a value"))
+			continue
+		}
+		temps[i] = &Variable{
+			Type:  v.GetType(),
+			Value: v,
+		}
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	} else if len(errs) > 1 {
+		return nil, utils.NewMultiError(errs...)
+	}
+
+	f := &formatter{
+		prog:      ctx.GetPackageContext().f,
+		pieceType: ctx.GetPackageContext().f.getFmtType("Piece"),
+	}
+	used := make([]bool, len(asts))
+	for _, hole := range holes {
+		f.text.WriteString(hole.text)
+		if hole.index >= len(asts) {
+			errs = append(errs, utils.Errorf(format.Position(), "format string refers to argument `%d` but there are %d arguments", hole.index, len(asts)))
+			continue
+		}
+		used[hole.index] = true
+		f.pos = asts[hole.index].Position()
+		if err := f.writeValue(temps[hole.index], hole.spec, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	f.text.WriteString(rest)
+	f.flushText()
+	for i, u := range used {
+		if !u {
+			errs = append(errs, utils.Errorf(asts[i].Position(), "argument never used"))
+		}
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	} else if len(errs) > 1 {
+		return nil, utils.NewMultiError(errs...)
+	}
+
+	st := GetBaseType(argsType).(*TypeStruct)
+	return newStructByName(argsType, map[string]Expr{
+		"pieces": &FormatPieces{
+			Type:   st.Fields.Get("pieces").Second,
+			Temps:  temps,
+			Pieces: f.pieces,
+		},
+		"len": &Integer{
+			Type:  Usize,
+			Value: big.NewInt(int64(len(f.pieces))),
+		},
+	}), nil
+}
+
+// 按成员名新建结构体，未指定的成员为默认值，类型不同的成员进行类型转换
+func newStructByName(t Type, values map[string]Expr) *Struct {
+	st := GetBaseType(t).(*TypeStruct)
+	fields := make([]Expr, 0, st.Fields.Length())
+	for iter := st.Fields.Begin(); iter.HasValue(); iter.Next() {
+		ft := iter.Value().Second
+		v, ok := values[iter.Key()]
+		if !ok {
+			v = getDefaultExprByType(ft)
+		} else if !v.GetType().Equal(ft) {
+			v = &Covert{
+				From: v,
+				To:   ft,
+			}
+		}
+		fields = append(fields, v)
+	}
+	return &Struct{
+		Type:   t,
+		Fields: fields,
+	}
+}
+
+// 解析格式字符串，返回占位符和最后一个占位符之后的文本
+func parseFormatString(pos utils.Position, s string) ([]formatHole, string, utils.Error) {
+	var holes []formatHole
+	var text strings.Builder
+	var next int // 下一个按顺序使用的参数
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			if i+1 < len(s) && s[i+1] == '{' {
+				text.WriteByte('{')
+				i++
+				continue
+			}
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, "", utils.Errorf(pos, "unmatched `{` in format string")
+			}
+			content := s[i+1 : i+end]
+			index, spec := content, ""
+			if j := strings.IndexByte(content, ':'); j >= 0 {
+				index, spec = content[:j], content[j+1:]
+			}
+
+			hole := formatHole{text: text.String()}
+			text.Reset()
+			if index == "" {
+				hole.index = next
+				next++
+			} else if n, err := strconv.ParseUint(index, 10, 16); err == nil {
+				hole.index = int(n)
+			} else {
+				return nil, "", utils.Errorf(pos, "invalid argument index `%s` in format string", index)
+			}
+			var ok bool
+			if hole.spec, ok = parseFormatSpec(spec); !ok {
+				return nil, "", utils.Errorf(pos, "invalid format spec `%s`", spec)
+			}
+			holes = append(holes, hole)
+			i += end
+		case '}':
+			if i+1 < len(s) && s[i+1] == '}' {
+				text.WriteByte('}')
+				i++
+				continue
+			}
+			return nil, "", utils.Errorf(pos, "unmatched `}` in format string")
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+	return holes, text.String(), nil
+}
+
+// 解析格式说明
+func parseFormatSpec(s string) (formatSpec, bool) {
+	spec := formatSpec{precision: -1}
+	var i int
+	if i < len(s) {
+		switch s[i] {
+		case '<':
+			spec.flags |= formatLeft
+			i++
+		case '^':
+			spec.flags |= formatCenter
+			i++
+		case '>':
+			i++
+		}
+	}
+	for _, flag := range []struct {
+		c byte
+		v uint8
+	}{{'+', formatPlus}, {'#', formatAlt}, {'0', formatZero}} {
+		if i < len(s) && s[i] == flag.c {
+			spec.flags |= flag.v
+			i++
+		}
+	}
+	if v, n, ok := readFormatNumber(s[i:]); !ok {
+		return spec, false
+	} else if n > 0 {
+		spec.width = uint32(v)
+		i += n
+	}
+	if i < len(s) && s[i] == '.' {
+		v, n, ok := readFormatNumber(s[i+1:])
+		if !ok || n == 0 {
+			return spec, false
+		}
+		spec.precision = int32(v)
+		i += n + 1
+	}
+	if i < len(s) && strings.IndexByte("dxXobceEfgsp?", s[i]) >= 0 {
+		spec.verb = s[i]
+		i++
+	}
+	return spec, i == len(s)
+}
+
+// 读取格式说明中的十进制数，返回值和消耗的字节数
+func readFormatNumber(s string) (uint64, int, bool) {
+	var n int
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n == 0 {
+		return 0, 0, true
+	}
+	v, err := strconv.ParseUint(s[:n], 10, 16)
+	return v, n, err == nil
+}
+
+// 格式化展开
+type formatter struct {
+	prog      *ProgramContext
+	pieceType *Typedef
+	pos       utils.Position // 当前参数的位置
+
+	pieces []Expr
+	text   strings.Builder // 尚未生成片段的文本
+}
+
+// 将尚未生成片段的文本作为片段
+func (self *formatter) flushText() {
+	if self.text.Len() == 0 {
+		return
+	}
+	s := self.text.String()
+	self.text.Reset()
+	self.pieces = append(self.pieces, self.newPiece(pieceText, formatSpec{precision: -1}, map[string]Expr{
+		"data": &String{
+			Type:  NewPtrType(I8),
+			Value: s,
+		},
+		"len": &Integer{
+			Type:  Usize,
+			Value: big.NewInt(int64(len(s))),
+		},
+	}))
+}
+
+// 新建片段
+func (self *formatter) newPiece(kind uint8, spec formatSpec, values map[string]Expr) Expr {
+	// 只有运行时需要区分的类型才写入片段
+	var verb byte
+	if strings.IndexByte("xXobeEfg", spec.verb) >= 0 {
+		verb = spec.verb
+	}
+	values["kind"] = &Integer{Type: U8, Value: big.NewInt(int64(kind))}
+	values["verb"] = &Integer{Type: U8, Value: big.NewInt(int64(verb))}
+	values["flags"] = &Integer{Type: U8, Value: big.NewInt(int64(spec.flags))}
+	values["width"] = &Integer{Type: U32, Value: big.NewInt(int64(spec.width))}
+	values["precision"] = &Integer{Type: I32, Value: big.NewInt(int64(spec.precision))}
+	return newStructByName(self.pieceType, values)
+}
+
+// 写入值片段
+func (self *formatter) writePiece(kind uint8, spec formatSpec, values map[string]Expr) {
+	self.flushText()
+	self.pieces = append(self.pieces, self.newPiece(kind, spec, values))
+}
+
+// 检查格式类型
+func (self *formatter) checkVerb(t Type, spec formatSpec, verbs string) utils.Error {
+	if spec.verb == 0 || strings.IndexByte(verbs, spec.verb) >= 0 {
+		return nil
+	}
+	return utils.Errorf(self.pos, "can not format type `%s` with `%c`", t, spec.verb)
+}
+
+// 格式化值，nested为是否是数组、元组或结构体的成员
+func (self *formatter) writeValue(v Expr, spec formatSpec, nested bool) utils.Error {
+	t := v.GetType()
+	// 嵌套或者?格式的字符串加上引号
+	quote := nested || spec.verb == '?'
+
+	if self.prog.isStringType(t) {
+		if err := self.checkVerb(t, spec, "s?"); err != nil {
+			return err
+		}
+		if quote {
+			self.text.WriteByte('"')
+		}
+		self.writePiece(pieceStr, spec, map[string]Expr{
+			"data": &GetField{From: v, Index: "data"},
+			"len":  &GetField{From: v, Index: "len"},
+		})
+		if quote {
+			self.text.WriteByte('"')
+		}
+		return nil
+	}
+
+	switch bt := GetBaseType(t).(type) {
+	case *typeBasic:
+		switch {
+		case IsIntType(bt):
+			if err := self.checkVerb(t, spec, "dxXobc?"); err != nil {
+				return err
+			}
+			if spec.verb == 'c' {
+				if nested {
+					self.text.WriteByte('\'')
+				}
+				self.writePiece(pieceChar, spec, map[string]Expr{"value": v})
+				if nested {
+					self.text.WriteByte('\'')
+				}
+				return nil
+			}
+			kind := pieceUint
+			if IsSintType(bt) {
+				kind = pieceInt
+			}
+			values := map[string]Expr{"value": v}
+			// 按128位传递，高64位中不足128位的有符号整数为符号位
+			if IsSintType(bt) || getIntTypeBits(bt) > 64 {
+				wide := v
+				if getIntTypeBits(bt) <= 64 {
+					wide = &Covert{From: v, To: I128}
+				}
+				values["high"] = &Binary{Pos: self.pos, Opera: ">>", Left: wide, Right: &Integer{Type: wide.GetType(), Value: big.NewInt(64)}}
+			}
+			self.writePiece(kind, spec, values)
+		case IsFloatType(bt):
+			if err := self.checkVerb(t, spec, "eEfg?"); err != nil {
+				return err
+			}
+			self.writePiece(pieceFloat, spec, map[string]Expr{"float": v})
+		case IsBoolType(bt):
+			if err := self.checkVerb(t, spec, "?"); err != nil {
+				return err
+			}
+			self.writePiece(pieceBool, spec, map[string]Expr{"value": v})
+		default:
+			return utils.Errorf(self.pos, "expect a value")
+		}
+	case *TypePtr:
+		// *i8按c字符串输出
+		if GetBaseType(bt.Elem).Equal(I8) {
+			if err := self.checkVerb(t, spec, "sp?"); err != nil {
+				return err
+			}
+			if spec.verb != 'p' {
+				if quote {
+					self.text.WriteByte('"')
+				}
+				self.writePiece(pieceCStr, spec, map[string]Expr{
+					"data": &Covert{From: v, To: NewPtrType(I8)},
+				})
+				if quote {
+					self.text.WriteByte('"')
+				}
+				return nil
+			}
+		} else if err := self.checkVerb(t, spec, "p?"); err != nil {
+			return err
+		}
+		self.writePiece(piecePtr, spec, map[string]Expr{"value": &Covert{From: v, To: Usize}})
+	case *TypeFunc:
+		if err := self.checkVerb(t, spec, "p?"); err != nil {
+			return err
+		}
+		self.writePiece(piecePtr, spec, map[string]Expr{"value": &Covert{From: v, To: Usize}})
+	case *TypeArray:
+		return self.writeElems(v, bt.Size, bt.Elem, spec)
+	case *TypeVec:
+		return self.writeElems(v, bt.Size, bt.Elem, spec)
+	case *TypeTuple:
+		self.text.WriteByte('(')
+		for i, et := range bt.Elems {
+			if i > 0 {
+				self.text.WriteString(", ")
+			}
+			elem := &Index{
+				Pos:   self.pos,
+				Type:  et,
+				From:  v,
+				Index: &Integer{Type: Usize, Value: big.NewInt(int64(i))},
+			}
+			if err := self.writeValue(elem, spec, true); err != nil {
+				return err
+			}
+		}
+		self.text.WriteByte(')')
+	case *TypeStruct:
+		if td, ok := t.(*Typedef); ok {
+			self.text.WriteString(td.Name)
+		}
+		self.text.WriteByte('{')
+		for iter := bt.Fields.Begin(); iter.HasValue(); iter.Next() {
+			if iter.Index() > 0 {
+				self.text.WriteString(", ")
+			}
+			self.text.WriteString(iter.Key())
+			self.text.WriteString(": ")
+			if err := self.writeValue(&GetField{From: v, Index: iter.Key()}, spec, true); err != nil {
+				return err
+			}
+		}
+		self.text.WriteByte('}')
+	default:
+		return utils.Errorf(self.pos, "can not format type `%s`", t)
+	}
+	return nil
+}
+
+// 格式化数组或者向量的元素
+func (self *formatter) writeElems(v Expr, size uint, elemType Type, spec formatSpec) utils.Error {
+	self.text.WriteByte('[')
+	for i := uint(0); i < size; i++ {
+		if i > 0 {
+			self.text.WriteString(", ")
+		}
+		elem := &Index{
+			Pos:   self.pos,
+			Type:  elemType,
+			From:  v,
+			Index: &Integer{Type: Usize, Value: big.NewInt(int64(i))},
+		}
+		if err := self.writeValue(elem, spec, true); err != nil {
+			return err
+		}
+	}
+	self.text.WriteByte(']')
+	return nil
+}
@@ -1,10 +1,9 @@
 package analyse
 
 import (
-	"github.com/kkkunny/Sim/src/compiler/lex"
+	"github.com/kkkunny/Sim/src/compiler/mangle"
 	"github.com/kkkunny/Sim/src/compiler/parse"
 	"github.com/kkkunny/Sim/src/compiler/utils"
-	stlos "github.com/kkkunny/stl/os"
 )
 
 // Global 全局
@@ -15,15 +14,36 @@ type Global interface {
 // Function 函数
 type Function struct {
 	// 属性
-	ExternName string // 外部名
-	NoReturn   bool   // 函数是否不返回
-	Inline     *bool  // 函数是否强制内联或者强制不内联
-
-	Ret    Type
-	Params []*Param
-	Body   *Block
+	ExternName string  // 外部名
+	NoReturn   bool    // 函数是否不返回
+	Inline     *bool   // 函数是否强制内联或者强制不内联
+	Cold       bool    // 函数是否很少执行
+	Weak       bool    // 是否是弱符号
+	Section    string  // 所在的段，为空时使用默认段
+	CallConv   string  // 调用约定，为空时为c
+	Deprecated *string // 弃用说明，没有弃用时为空
+
+	Symbol   string // 修饰后的符号名，没有外部名时使用
+	Public   bool   // 是否公开
+	Instance bool   // 是否是泛型类型实例的方法，使用实例的每个目标文件中都有定义
+
+	Ret      Type
+	Params   []*Param
+	VarArg   bool         // 是否是可变参数
+	Receiver ReceiverKind // 方法的接收者，普通函数为ReceiverAuto
+	Body     *Block
 }
 
+// ReceiverKind 方法的接收者
+type ReceiverKind uint8
+
+const (
+	ReceiverAuto  ReceiverKind = iota // func (T)，self为*T，临时值先复制到临时变量
+	ReceiverValue                     // func (self T)，self为值的副本，指针自动解引用
+	ReceiverPtr                       // func (self *T)，不能通过临时值调用
+	ReceiverNone                      // 关联函数func T::name()，通过T::name调用
+)
+
 func (self Function) global() {}
 
 func (self Function) stmt() {}
@@ -35,7 +55,10 @@ func (self Function) GetType() Type {
 	for i, p := range self.Params {
 		paramTypes[i] = p.Type
 	}
-	return NewFuncType(self.Ret, paramTypes...)
+	ft := NewFuncType(self.Ret, paramTypes...)
+	ft.VarArg = self.VarArg
+	ft.CallConv = self.CallConv
+	return ft
 }
 
 func (self Function) GetMut() bool {
@@ -52,7 +75,15 @@ func (self Function) IsConst() bool {
 
 // GlobalVariable 全局变量
 type GlobalVariable struct {
-	ExternName string
+	// 属性
+	ExternName  string  // 外部名
+	Weak        bool    // 是否是弱符号
+	Section     string  // 所在的段，为空时使用默认段
+	ThreadLocal string  // 线程局部存储模型，为空时不是线程局部变量
+	Deprecated  *string // 弃用说明，没有弃用时为空
+
+	Symbol string // 修饰后的符号名，没有外部名时使用
+	Public bool   // 是否公开
 
 	Type  Type
 	Value Expr
@@ -108,38 +139,12 @@ func analyseExternFunction(ctx *packageContext, ast *parse.ExternFunction) (*Fun
 	f := &Function{
 		Ret:    retType,
 		Params: params,
+		VarArg: ast.VarArg,
 	}
 
 	// 属性
-	errors = make([]utils.Error, 0)
-	for _, astAttr := range ast.Attrs {
-		switch attr := astAttr.(type) {
-		case *parse.AttrExtern:
-			f.ExternName = attr.Name.Source
-		case *parse.AttrLink:
-			for _, asm := range attr.Asms {
-				linkPath := stlos.Path(asm.Value)
-				if !linkPath.IsAbsolute() {
-					linkPath = ctx.path.Join(linkPath)
-				}
-				if !linkPath.IsExist() {
-					errors = append(errors, utils.Errorf(asm.Position(), "can not find path `%s`", linkPath))
-				}
-				ctx.f.Links[linkPath] = struct{}{}
-			}
-			for _, lib := range attr.Libs {
-				ctx.f.Libs[lib.Value] = struct{}{}
-			}
-		case *parse.AttrNoReturn:
-			f.NoReturn = true
-		default:
-			panic("unknown attr")
-		}
-	}
-	if len(errors) == 1 {
-		return nil, errors[0]
-	} else if len(errors) > 1 {
-		return nil, utils.NewMultiError(errors...)
+	if _, err := analyseFuncAttrs(ctx, f, ast.Name.Source, ast.Attrs, attrOnExternFunc); err != nil {
+		return nil, err
 	}
 
 	if !ctx.AddValue(ast.Public, ast.Name.Source, f) {
@@ -174,26 +179,24 @@ func analyseFunctionDecl(ctx *packageContext, ast *parse.Function) (*Function, u
 	f := &Function{
 		Ret:    retType,
 		Params: params,
+		Symbol: mangle.Function(ctx.GetMangleName(), ast.Name.Source),
+		Public: ast.Public,
 	}
 
 	// 属性
-	for _, astAttr := range ast.Attrs {
-		switch attr := astAttr.(type) {
-		case *parse.AttrExtern:
-			f.ExternName = attr.Name.Source
-		case *parse.AttrNoReturn:
-			f.NoReturn = true
-		case *parse.AttrInline:
-			var v bool
-			if attr.Value.Kind == lex.TRUE {
-				v = true
-			} else {
-				v = false
-			}
-			f.Inline = &v
-		default:
-			panic("unknown attr")
+	if _, err := analyseFuncAttrs(ctx, f, ast.Name.Source, ast.Attrs, attrOnFunc); err != nil {
+		return nil, err
+	}
+
+	// 主包的main函数由编译器生成的程序入口调用，入口占用main符号
+	if ctx.path == ctx.f.mainPath && ast.Name.Source == "main" {
+		if len(f.Params) != 0 || !(f.Ret.Equal(None) || f.Ret.Equal(U8) || f.Ret.Equal(I32)) {
+			return nil, utils.Errorf(ast.Name.Pos, "main function must be `func main()`, `func main()u8` or `func main()i32`")
 		}
+		if f.ExternName == "main" {
+			f.ExternName = ""
+		}
+		ctx.f.Main = f
 	}
 
 	if !ctx.AddValue(ast.Public, ast.Name.Source, f) {
@@ -266,8 +269,10 @@ func analyseGlobalVariable(ctx *packageContext, ast *parse.GlobalValue) (*Global
 	}
 
 	v := &GlobalVariable{
-		Type:  typ,
-		Value: value,
+		Symbol: mangle.Variable(ctx.GetMangleName(), ast.Variable.Name.Source),
+		Public: ast.Public,
+		Type:   typ,
+		Value:  value,
 	}
 	if !ctx.AddValue(ast.Public, ast.Variable.Name.Source, v) {
 		return nil, utils.Errorf(ast.Variable.Name.Pos, "duplicate identifier")
@@ -275,27 +280,8 @@ func analyseGlobalVariable(ctx *packageContext, ast *parse.GlobalValue) (*Global
 
 	// 属性
 	var errors []utils.Error
-	for _, astAttr := range ast.Attrs {
-		switch attr := astAttr.(type) {
-		case *parse.AttrExtern:
-			v.ExternName = attr.Name.Source
-		case *parse.AttrLink:
-			for _, asm := range attr.Asms {
-				linkPath := stlos.Path(asm.Value)
-				if !linkPath.IsAbsolute() {
-					linkPath = ctx.path.Join(linkPath)
-				}
-				if !linkPath.IsExist() {
-					errors = append(errors, utils.Errorf(asm.Position(), "can not find path `%s`", linkPath))
-				}
-				ctx.f.Links[linkPath] = struct{}{}
-			}
-			for _, lib := range attr.Libs {
-				ctx.f.Libs[lib.Value] = struct{}{}
-			}
-		default:
-			panic("unknown attr")
-		}
+	if err := analyseGlobalVariableAttrs(ctx, v, ast.Variable.Name.Source, ast.Attrs); err != nil {
+		errors = append(errors, err)
 	}
 	if v.ExternName == "" && ast.Variable.Value == nil {
 		errors = append(errors, utils.Errorf(ast.Variable.Name.Pos, "missing value"))
@@ -311,27 +297,46 @@ func analyseGlobalVariable(ctx *packageContext, ast *parse.GlobalValue) (*Global
 
 // 方法声明
 func analyseMethodDecl(ctx *packageContext, ast *parse.Method) (*Function, utils.Error) {
-	_selfType, err := analyseType(ctx, parse.NewTypeIdent(nil, ast.Self))
+	_selfType, err := analyseType(ctx, methodSelfType(ast))
 	if err != nil {
 		return nil, err
 	}
-	selfType := NewPtrType(_selfType)
+	// 泛型类型的实例以实例名修饰，其他包中的类型加上包名
+	selfName := ast.Self.Source
+	if td, ok := _selfType.(*Typedef); ok {
+		selfName = td.Name
+	}
+	if ast.SelfPkg != nil {
+		selfName = ast.SelfPkg.Source + "::" + selfName
+	}
 
 	retType, err := analyseType(ctx, ast.Ret)
 	if err != nil {
 		return nil, err
 	}
 
-	params := make([]*Param, len(ast.Params)+1)
-	params[0] = &Param{Type: selfType}
+	receiver := ReceiverAuto
+	var params []*Param
+	switch {
+	case ast.Static:
+		receiver = ReceiverNone
+	case ast.Recv == nil:
+		params = append(params, &Param{Type: NewPtrType(_selfType)})
+	case ast.RecvPtr:
+		receiver = ReceiverPtr
+		params = append(params, &Param{Type: NewPtrType(_selfType)})
+	default:
+		receiver = ReceiverValue
+		params = append(params, &Param{Type: _selfType})
+	}
 	var errors []utils.Error
-	for i, p := range ast.Params {
+	for _, p := range ast.Params {
 		pt, err := analyseType(ctx, p.Type)
 		if err != nil {
 			errors = append(errors, err)
 			continue
 		}
-		params[i+1] = &Param{Type: pt}
+		params = append(params, &Param{Type: pt})
 	}
 	if len(errors) == 1 {
 		return nil, errors[0]
@@ -340,38 +345,42 @@ func analyseMethodDecl(ctx *packageContext, ast *parse.Method) (*Function, utils
 	}
 
 	f := &Function{
-		Ret:    retType,
-		Params: params,
+		Ret:      retType,
+		Params:   params,
+		Receiver: receiver,
+		Symbol:   mangle.Method(ctx.GetMangleName(), selfName, ast.Name.Source),
+		Public:   ast.Public,
 	}
 
 	// 属性
-	for _, astAttr := range ast.Attrs {
-		switch attr := astAttr.(type) {
-		case *parse.AttrNoReturn:
-			f.NoReturn = true
-		case *parse.AttrInline:
-			var v bool
-			if attr.Value.Kind == lex.TRUE {
-				v = true
-			} else {
-				v = false
-			}
-			f.Inline = &v
-		default:
-			panic("unknown attr")
-		}
+	drop, err := analyseFuncAttrs(ctx, f, ast.Name.Source, ast.Attrs, attrOnMethod)
+	if err != nil {
+		return nil, err
 	}
 
 	name := _selfType.String() + "." + ast.Name.Source
 	if !ctx.AddValue(ast.Public, name, f) {
 		return nil, utils.Errorf(ast.Name.Pos, "duplicate identifier")
 	}
+
+	// 析构方法
+	if drop != nil {
+		td, ok := _selfType.(*Typedef)
+		if !ok || td.Pkg != ctx.path {
+			return nil, utils.Errorf(drop.Position(), "expect a method of type definition in this package")
+		} else if receiver == ReceiverValue || receiver == ReceiverNone || len(f.Params) != 1 || !f.Ret.Equal(None) || f.NoReturn {
+			return nil, utils.Errorf(ast.Name.Pos, "drop method must be `func (%s) %s()`", ast.Self.Source, ast.Name.Source)
+		} else if td.Drop != nil {
+			return nil, utils.Errorf(drop.Position(), "type `%s` already has a drop method", td.Name)
+		}
+		td.Drop = f
+	}
 	return f, nil
 }
 
 // 方法定义
 func analyseMethodDef(ctx *packageContext, ast *parse.Method) utils.Error {
-	_selfType, err := analyseType(ctx, parse.NewTypeIdent(nil, ast.Self))
+	_selfType, err := analyseType(ctx, methodSelfType(ast))
 	if err != nil {
 		return err
 	}
@@ -379,15 +388,20 @@ func analyseMethodDef(ctx *packageContext, ast *parse.Method) utils.Error {
 	name := _selfType.String() + "." + ast.Name.Source
 	f := ctx.GetValue(name).Second.(*Function)
 	fctx := newFunctionContext(ctx, f.Ret)
-	for i, p := range f.Params {
-		if i == 0 {
-			fctx.AddValue("self", p)
-		} else {
-			pn := ast.Params[i].Name
-			if pn != nil {
-				if !fctx.AddValue(pn.Source, p) {
-					return utils.Errorf(pn.Pos, "duplicate identifier")
-				}
+	params := f.Params
+	if f.Receiver != ReceiverNone {
+		recv := "self"
+		if ast.Recv != nil {
+			recv = ast.Recv.Source
+		}
+		fctx.AddValue(recv, params[0])
+		params = params[1:]
+	}
+	for i, p := range params {
+		pn := ast.Params[i].Name
+		if pn != nil {
+			if !fctx.AddValue(pn.Source, p) {
+				return utils.Errorf(pn.Pos, "duplicate identifier")
 			}
 		}
 	}
@@ -406,3 +420,12 @@ func analyseMethodDef(ctx *packageContext, ast *parse.Method) utils.Error {
 	f.Body = body
 	return nil
 }
+
+// 方法的接收者类型，泛型类型的方法以类型形参作为类型实参
+func methodSelfType(ast *parse.Method) *parse.TypeIdent {
+	t := parse.NewTypeIdent(ast.SelfPkg, ast.Self)
+	for _, p := range ast.SelfParams {
+		t.Args = append(t.Args, parse.NewTypeIdent(nil, p))
+	}
+	return t
+}
@@ -0,0 +1,274 @@
+package analyse
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/lex"
+	"github.com/kkkunny/Sim/src/compiler/parse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+)
+
+// OverloadAssign 重载的复合赋值，左值的地址只求值一次
+type OverloadAssign struct {
+	Temp   *Variable // 左值的地址
+	Assign *Assign   // *Temp = (*Temp).op(右值)
+}
+
+func (self OverloadAssign) stmt() {}
+
+func (self OverloadAssign) GetType() Type {
+	return None
+}
+
+func (self OverloadAssign) GetMut() bool {
+	return false
+}
+
+func (self OverloadAssign) IsTemporary() bool {
+	return true
+}
+
+func (self OverloadAssign) IsConst() bool {
+	return false
+}
+
+// 二元运算符对应的方法名
+var binaryOperators = map[lex.TokenKind]string{
+	lex.ADD: "add",
+	lex.SUB: "sub",
+	lex.MUL: "mul",
+	lex.DIV: "div",
+	lex.MOD: "mod",
+	lex.AND: "and",
+	lex.OR:  "or",
+	lex.XOR: "xor",
+	lex.SHL: "shl",
+	lex.SHR: "shr",
+	lex.EQ:  "eq",
+	lex.NE:  "ne",
+	lex.LT:  "lt",
+	lex.LE:  "le",
+	lex.GT:  "gt",
+	lex.GE:  "ge",
+}
+
+// 复合赋值对应的二元运算符
+var compoundOperators = map[lex.TokenKind]lex.TokenKind{
+	lex.ADS: lex.ADD,
+	lex.SUS: lex.SUB,
+	lex.MUS: lex.MUL,
+	lex.DIS: lex.DIV,
+	lex.MOS: lex.MOD,
+	lex.ANS: lex.AND,
+	lex.ORS: lex.OR,
+	lex.XOS: lex.XOR,
+	lex.SLS: lex.SHL,
+	lex.SRS: lex.SHR,
+}
+
+// 没有定义时由取反得到的比较运算符，操作数的求值顺序不变
+var negatedOperators = map[lex.TokenKind]lex.TokenKind{
+	lex.NE: lex.EQ,
+	lex.GE: lex.LT,
+	lex.LE: lex.GT,
+}
+
+// 一元运算符对应的方法名
+var unaryOperators = map[lex.TokenKind]string{
+	lex.SUB: "neg",
+	lex.NOT: "not",
+	lex.NEG: "inv",
+}
+
+// 查找运算符方法，检查参数个数
+func lookupOperator(ctx *blockContext, pos utils.Position, td *Typedef, name string, params int) (*Function, utils.Error) {
+	f := lookupMethod(ctx, td, name)
+	if f == nil {
+		return nil, nil
+	}
+	if f.Receiver == ReceiverNone || len(f.Params) != params+1 {
+		return nil, utils.Errorf(pos, "operator method `%s` of type `%s` must have %d parameters", name, td, params)
+	}
+	ctx.GetPackageContext().f.warnDeprecated(pos, name, f.Deprecated)
+	return f, nil
+}
+
+// 调用运算符方法
+func callOperator(ctx *blockContext, pos utils.Position, self Expr, f *Function, name string, argAsts ...parse.Expr) (Expr, utils.Error) {
+	method, err := bindMethod(pos, self, f, name)
+	if err != nil {
+		return nil, err
+	}
+	ft := f.GetType().(*TypeFunc)
+	args := make([]Expr, len(argAsts))
+	for i, a := range argAsts {
+		var err utils.Error
+		if args[i], err = expectExpr(ctx, ft.Params[i+1], a); err != nil {
+			return nil, err
+		}
+	}
+	return &MethodCall{
+		Method: method,
+		Args:   args,
+	}, nil
+}
+
+// 二元运算符重载，左值为定义了对应方法的类型定义时调用该方法，否则ok为false
+func analyseBinaryOverload(ctx *blockContext, left Expr, ast *parse.Binary) (Expr, bool, utils.Error) {
+	td, ok := left.GetType().(*Typedef)
+	if !ok {
+		return nil, false, nil
+	}
+	kind := ast.Opera.Kind
+	if op, ok := compoundOperators[kind]; ok {
+		return analyseCompoundOverload(ctx, td, left, op, ast)
+	}
+	name, ok := binaryOperators[kind]
+	if !ok {
+		return nil, false, nil
+	}
+	f, err := lookupOperator(ctx, ast.Opera.Pos, td, name, 1)
+	if err != nil {
+		return nil, true, err
+	}
+	negated := false
+	if f == nil {
+		if kind, negated = negatedOperators[kind]; !negated {
+			return nil, false, nil
+		}
+		name = binaryOperators[kind]
+		if f, err = lookupOperator(ctx, ast.Opera.Pos, td, name, 1); f == nil {
+			return nil, err != nil, err
+		}
+	}
+
+	res, err := callOperator(ctx, ast.Opera.Pos, left, f, name, ast.Right)
+	if err != nil {
+		return nil, true, err
+	}
+	// 比较运算符的结果为布尔值
+	switch kind {
+	case lex.EQ, lex.NE, lex.LT, lex.LE, lex.GT, lex.GE:
+		if !IsBoolTypeAndSon(res.GetType()) {
+			return nil, true, utils.Errorf(ast.Opera.Pos, "operator method `%s` of type `%s` must return a boolean", name, td)
+		}
+	}
+	if negated {
+		res = &Unary{
+			Pos:   ast.Position(),
+			Type:  res.GetType(),
+			Opera: "!",
+			Value: res,
+		}
+	}
+	return res, true, nil
+}
+
+// 复合赋值重载，a op= b等价于a = a.op(b)
+func analyseCompoundOverload(ctx *blockContext, td *Typedef, left Expr, op lex.TokenKind, ast *parse.Binary) (Expr, bool, utils.Error) {
+	name := binaryOperators[op]
+	f, err := lookupOperator(ctx, ast.Opera.Pos, td, name, 1)
+	if f == nil {
+		return nil, err != nil, err
+	}
+	if !left.GetMut() {
+		return nil, true, utils.Errorf(ast.Left.Position(), "expect a mutable value")
+	} else if rt := f.GetType().(*TypeFunc).Ret; !rt.Equal(td) {
+		return nil, true, utils.Errorf(ast.Opera.Pos, "operator method `%s` of type `%s` must return `%s`", name, td, td)
+	}
+
+	// 没有副作用的左值直接求值两次，覆盖局部变量时会析构原有的值
+	if isPureLvalue(left) {
+		right, err := callOperator(ctx, ast.Opera.Pos, left, f, name, ast.Right)
+		if err != nil {
+			return nil, true, err
+		}
+		return &Assign{
+			Pos:   ast.Position(),
+			Opera: "=",
+			Left:  left,
+			Right: &Move{Value: right},
+		}, true, nil
+	}
+	if field, ok := left.(*GetField); ok && field.IsBitField() {
+		return nil, true, utils.Errorf(ast.Left.Position(), "can not take the address of a bit-field")
+	}
+	temp := &Variable{
+		Type: NewPtrType(td),
+		Value: &Unary{
+			Pos:   ast.Left.Position(),
+			Type:  NewPtrType(td),
+			Opera: "&",
+			Value: left,
+		},
+	}
+	lvalue := &Unary{
+		Pos:   ast.Left.Position(),
+		Type:  td,
+		Opera: "*",
+		Value: temp,
+	}
+	right, err := callOperator(ctx, ast.Opera.Pos, lvalue, f, name, ast.Right)
+	if err != nil {
+		return nil, true, err
+	}
+	return &OverloadAssign{
+		Temp: temp,
+		Assign: &Assign{
+			Pos:   ast.Position(),
+			Opera: "=",
+			Left:  lvalue,
+			Right: &Move{Value: right},
+		},
+	}, true, nil
+}
+
+// 一元运算符重载
+func analyseUnaryOverload(ctx *blockContext, value Expr, ast *parse.Unary) (Expr, bool, utils.Error) {
+	td, ok := value.GetType().(*Typedef)
+	if !ok {
+		return nil, false, nil
+	}
+	name := unaryOperators[ast.Opera.Kind]
+	f, err := lookupOperator(ctx, ast.Opera.Pos, td, name, 0)
+	if f == nil {
+		return nil, err != nil, err
+	}
+	res, err := callOperator(ctx, ast.Opera.Pos, value, f, name)
+	return res, true, err
+}
+
+// 索引重载，方法index返回指针时结果为指针指向的内存，可以赋值
+func analyseIndexOverload(ctx *blockContext, from Expr, ast *parse.Index) (Expr, bool, utils.Error) {
+	td, ok := from.GetType().(*Typedef)
+	if !ok {
+		return nil, false, nil
+	}
+	f, err := lookupOperator(ctx, ast.Position(), td, "index", 1)
+	if f == nil {
+		return nil, err != nil, err
+	}
+	res, err := callOperator(ctx, ast.Position(), from, f, "index", ast.Index)
+	if err != nil {
+		return nil, true, err
+	}
+	if rt := res.GetType(); IsPtrType(rt) {
+		res = &Unary{
+			Pos:   ast.Position(),
+			Type:  rt.(*TypePtr).Elem,
+			Opera: "*",
+			Value: res,
+		}
+	}
+	return res, true, nil
+}
+
+// 是否是没有副作用的左值
+func isPureLvalue(v Expr) bool {
+	switch e := v.(type) {
+	case *Variable, *Param, *GlobalVariable:
+		return true
+	case *GetField:
+		return isPureLvalue(e.From)
+	default:
+		return false
+	}
+}
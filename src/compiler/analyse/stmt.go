@@ -73,9 +73,10 @@ type LoopControl struct {
 
 func (self LoopControl) stmt() {}
 
-// Defer 延迟调用
+// Defer 延迟执行，Call不为nil时为延迟的函数调用或者方法调用（函数、接收者和参数立即求值），否则延迟执行Body
 type Defer struct {
-	Call *FuncCall
+	Call Expr
+	Body *Block
 }
 
 func (self Defer) stmt() {}
@@ -115,13 +116,27 @@ func analyseBlock(ctx localContext, ast *parse.Block, inLoop bool) (*blockContex
 func analyseStmt(ctx *blockContext, ast parse.Stmt) (Stmt, utils.Error) {
 	switch stmt := ast.(type) {
 	case *parse.Return:
+		if ctx.IsInDefer() {
+			return nil, utils.Errorf(stmt.Position(), "can not return in defer")
+		}
 		res, err := analyseReturn(ctx, stmt)
 		ctx.SetEnd()
 		return res, err
 	case *parse.Variable:
 		return analyseVariable(ctx, stmt)
 	case parse.Expr:
-		return analyseExpr(ctx, nil, stmt)
+		expr, err := analyseExpr(ctx, nil, stmt)
+		if err != nil {
+			return nil, err
+		}
+		// 不能忽略Result
+		if _, ok := expr.(*Assign); !ok && ctx.GetPackageContext().f.isResultType(expr.GetType(), "Result") {
+			return nil, utils.Errorf(stmt.Position(), "unused value of type `%s`, handle it or discard it with `drop(...)`", expr.GetType())
+		}
+		if p, ok := expr.(*Panic); ok && p.Cond == nil {
+			ctx.SetEnd()
+		}
+		return expr, nil
 	case *parse.Block:
 		bctx, res, err := analyseBlock(ctx, stmt, false)
 		if err != nil {
@@ -146,6 +161,7 @@ func analyseStmt(ctx *blockContext, ast parse.Stmt) (Stmt, utils.Error) {
 		if !ctx.IsInLoop() {
 			return nil, utils.Errorf(stmt.Position(), "must in a loop")
 		}
+		ctx.markLoopControl(stmt.Kind.Source == "break")
 		ctx.SetEnd()
 		return &LoopControl{Type: stmt.Kind.Source}, nil
 	case *parse.Defer:
@@ -172,6 +188,9 @@ func analyseReturn(ctx *blockContext, ast *parse.Return) (*Return, utils.Error)
 			if err != nil {
 				return nil, err
 			}
+			if value, err = moveValue(ctx, ast.Value.Position(), value); err != nil {
+				return nil, err
+			}
 			return &Return{Value: value}, nil
 		}
 	}
@@ -210,6 +229,11 @@ func analyseVariable(ctx *blockContext, ast *parse.Variable) (*Variable, utils.E
 		value = getDefaultExprByType(typ)
 	}
 
+	if ast.Value != nil {
+		if value, err = moveValue(ctx, ast.Value.Position(), value); err != nil {
+			return nil, err
+		}
+	}
 	v := &Variable{
 		Type:  typ,
 		Value: value,
@@ -220,52 +244,52 @@ func analyseVariable(ctx *blockContext, ast *parse.Variable) (*Variable, utils.E
 	return v, nil
 }
 
-// 条件分支
+// 条件分支，分支之后的移出状态为没有结束的分支的移出状态之和
 func analyseIfElse(ctx *blockContext, ast *parse.IfElse) (*IfElse, utils.Error, bool) {
 	cond, err := expectExprAndSon(ctx, Bool, ast.Cond)
 	if err != nil {
 		return nil, err, false
 	}
 
+	before := ctx.saveMoved()
 	tctx, tb, te := analyseBlock(ctx, ast.Body, false)
-
-	if ast.Next == nil {
-		if te != nil {
-			return nil, te, false
-		}
-		return &IfElse{
-			Cond: cond,
-			True: tb,
-		}, nil, false
-	} else if ast.Next != nil && ast.Next.Cond == nil {
-		fctx, fb, fe := analyseBlock(ctx, ast.Next.Body, false)
-		if te != nil && fe != nil {
-			return nil, utils.NewMultiError(te, fe), false
-		} else if te != nil {
-			return nil, te, false
-		} else if fe != nil {
-			return nil, fe, false
-		}
-		return &IfElse{
-			Cond:  cond,
-			True:  tb,
-			False: fb,
-		}, nil, tctx.IsEnd() && fctx.IsEnd()
-	} else {
-		nb, ne, nret := analyseIfElse(ctx, ast.Next)
-		if te != nil && ne != nil {
-			return nil, utils.NewMultiError(te, ne), false
-		} else if te != nil {
-			return nil, te, false
-		} else if ne != nil {
-			return nil, ne, false
+	tMoved, tEnd := ctx.saveMoved(), te == nil && tctx.IsEnd()
+	ctx.restoreMoved(before)
+
+	var fb *Block
+	var fe utils.Error
+	var fEnd bool
+	if ast.Next != nil && ast.Next.Cond == nil {
+		var fctx *blockContext
+		fctx, fb, fe = analyseBlock(ctx, ast.Next.Body, false)
+		fEnd = fe == nil && fctx.IsEnd()
+	} else if ast.Next != nil {
+		var nb *IfElse
+		nb, fe, fEnd = analyseIfElse(ctx, ast.Next)
+		if fe == nil {
+			fb = &Block{Stmts: []Stmt{nb}}
 		}
-		return &IfElse{
-			Cond:  cond,
-			True:  tb,
-			False: &Block{Stmts: []Stmt{nb}},
-		}, nil, tctx.IsEnd() && nret
 	}
+	switch {
+	case tEnd:
+	case fEnd:
+		ctx.restoreMoved(tMoved)
+	default:
+		ctx.getFunctionContext().moved.merge(tMoved)
+	}
+
+	if te != nil && fe != nil {
+		return nil, utils.NewMultiError(te, fe), false
+	} else if te != nil {
+		return nil, te, false
+	} else if fe != nil {
+		return nil, fe, false
+	}
+	return &IfElse{
+		Cond:  cond,
+		True:  tb,
+		False: fb,
+	}, nil, tEnd && fEnd
 }
 
 // 循环
@@ -275,10 +299,35 @@ func analyseFor(ctx *blockContext, ast *parse.Loop) (*Loop, utils.Error) {
 		return nil, err
 	}
 
-	_, body, err := analyseBlock(ctx, ast.Body, true)
+	// 循环体可能执行0次或者多次
+	fctx := ctx.getFunctionContext()
+	before := ctx.saveMoved()
+	loop := &loopMoved{}
+	fctx.loops = append(fctx.loops, loop)
+	bctx, body, err := analyseBlock(ctx, ast.Body, true)
+	fctx.loops = fctx.loops[:len(fctx.loops)-1]
 	if err != nil {
 		return nil, err
 	}
+	backs := loop.continues
+	if !bctx.IsEnd() {
+		backs = append(backs, ctx.saveMoved())
+	}
+	// 回到循环开始时，循环外的局部变量不能在上一次循环中被移出
+	for _, back := range backs {
+		for v, pos := range back {
+			if _, ok := before[v]; ok {
+				continue
+			}
+			if decl, ok := fctx.declared[v]; ok && !decl.block.isInside(bctx) {
+				return nil, utils.Errorf(pos, "`%s` is moved in the loop, assign it again before the next iteration", decl.name)
+			}
+		}
+	}
+	for _, moved := range append(backs, loop.breaks...) {
+		before.merge(moved)
+	}
+	ctx.restoreMoved(before)
 
 	return &Loop{
 		Cond: cond,
@@ -286,15 +335,28 @@ func analyseFor(ctx *blockContext, ast *parse.Loop) (*Loop, utils.Error) {
 	}, nil
 }
 
-// 延迟调用
+// 延迟执行
 func analyseDefer(ctx *blockContext, ast *parse.Defer) (*Defer, utils.Error) {
-	obj, err := analyseExpr(ctx, nil, ast.Call)
-	if err != nil {
-		return nil, err
-	}
-	call, ok := obj.(*FuncCall)
-	if !ok {
-		return nil, utils.Errorf(ast.Call.Position(), "expect a function call")
+	dctx := newBlockContext(ctx, false)
+	dctx.inDefer = true
+	switch stmt := ast.Body.(type) {
+	case *parse.Block:
+		_, body, err := analyseBlock(dctx, stmt, false)
+		if err != nil {
+			return nil, err
+		}
+		return &Defer{Body: body}, nil
+	case parse.Expr:
+		obj, err := analyseExpr(dctx, nil, stmt)
+		if err != nil {
+			return nil, err
+		}
+		switch obj.(type) {
+		case *FuncCall, *MethodCall:
+			return &Defer{Call: obj}, nil
+		}
+		return &Defer{Body: &Block{Stmts: []Stmt{obj}}}, nil
+	default:
+		panic("unknown stmt")
 	}
-	return &Defer{Call: call}, nil
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/kkkunny/stl/set"
 	"github.com/kkkunny/stl/table"
 	"github.com/kkkunny/stl/types"
+	"math/big"
 	"strings"
 )
 
@@ -23,12 +24,14 @@ var (
 	I16   = &typeBasic{Name: "i16"}
 	I32   = &typeBasic{Name: "i32"}
 	I64   = &typeBasic{Name: "i64"}
+	I128  = &typeBasic{Name: "i128"}
 	Isize = &typeBasic{Name: "isize"}
 
 	U8    = &typeBasic{Name: "u8"}
 	U16   = &typeBasic{Name: "u16"}
 	U32   = &typeBasic{Name: "u32"}
 	U64   = &typeBasic{Name: "u64"}
+	U128  = &typeBasic{Name: "u128"}
 	Usize = &typeBasic{Name: "usize"}
 
 	F32 = &typeBasic{Name: "f32"}
@@ -75,7 +78,7 @@ func IsIntTypeAndSon(t Type) bool {
 
 // IsSintType 是否是有符号整型
 func IsSintType(t Type) bool {
-	return t == I8 || t == I16 || t == I32 || t == I64 || t == Isize
+	return t == I8 || t == I16 || t == I32 || t == I64 || t == I128 || t == Isize
 }
 
 // IsSintTypeAndSon 是否是有符号整型及其子类型
@@ -85,7 +88,7 @@ func IsSintTypeAndSon(t Type) bool {
 
 // IsUintType 是否是无符号整型
 func IsUintType(t Type) bool {
-	return t == U8 || t == U16 || t == U32 || t == U64 || t == Usize
+	return t == U8 || t == U16 || t == U32 || t == U64 || t == U128 || t == Usize
 }
 
 // IsUintTypeAndSon 是否是无符号整型及其子类型
@@ -93,6 +96,39 @@ func IsUintTypeAndSon(t Type) bool {
 	return IsUintType(GetBaseType(t))
 }
 
+// 获取整型的位数
+func getIntTypeBits(t Type) uint {
+	switch t {
+	case I8, U8:
+		return 8
+	case I16, U16:
+		return 16
+	case I32, U32:
+		return 32
+	case I64, U64:
+		return 64
+	case I128, U128:
+		return 128
+	case Isize, Usize:
+		return utils.PtrByte * 8
+	default:
+		panic("")
+	}
+}
+
+// 整数类型的取值范围[min, max]
+func getIntTypeRange(t Type) (min, max *big.Int) {
+	bits := getIntTypeBits(t)
+	one := big.NewInt(1)
+	if IsSintType(t) {
+		max = new(big.Int).Lsh(one, bits-1)
+		min = new(big.Int).Neg(max)
+		return min, max.Sub(max, one)
+	}
+	max = new(big.Int).Lsh(one, bits)
+	return big.NewInt(0), max.Sub(max, one)
+}
+
 // IsFloatType 是否是浮点型
 func IsFloatType(t Type) bool {
 	return t == F32 || t == F64
@@ -126,8 +162,10 @@ func (self typeBasic) Equal(t Type) bool {
 
 // TypeFunc 函数类型
 type TypeFunc struct {
-	Ret    Type
-	Params []Type
+	Ret      Type
+	Params   []Type
+	VarArg   bool   // 是否是可变参数
+	CallConv string // 调用约定，为空时为c
 }
 
 // NewFuncType 新建函数类型
@@ -151,7 +189,22 @@ func IsFuncTypeAndSon(t Type) bool {
 
 func (self TypeFunc) String() string {
 	var buf strings.Builder
+	if self.CallConv != "" {
+		buf.WriteString("@callconv(" + self.CallConv + ") ")
+	}
 	buf.WriteString("func(")
+	for i, p := range self.Params {
+		buf.WriteString(p.String())
+		if i < len(self.Params)-1 {
+			buf.WriteString(", ")
+		}
+	}
+	if self.VarArg {
+		if len(self.Params) > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("...")
+	}
 	buf.WriteByte(')')
 	buf.WriteString(self.Ret.String())
 	return buf.String()
@@ -159,7 +212,7 @@ func (self TypeFunc) String() string {
 
 func (self TypeFunc) Equal(t Type) bool {
 	if f, ok := t.(*TypeFunc); ok {
-		if !self.Ret.Equal(f.Ret) || len(self.Params) != len(f.Params) {
+		if !self.Ret.Equal(f.Ret) || len(self.Params) != len(f.Params) || self.VarArg != f.VarArg || self.CallConv != f.CallConv {
 			return false
 		}
 		for i, p := range self.Params {
@@ -208,6 +261,50 @@ func (self TypeArray) Equal(t Type) bool {
 	return false
 }
 
+// TypeVec 向量类型（SIMD），元素为整型、浮点型或者布尔类型
+type TypeVec struct {
+	Size uint
+	Elem Type
+}
+
+// NewVecType 新建向量类型
+func NewVecType(size uint, elem Type) *TypeVec {
+	return &TypeVec{
+		Size: size,
+		Elem: elem,
+	}
+}
+
+// IsVecType 是否是向量类型
+func IsVecType(t Type) bool {
+	_, ok := t.(*TypeVec)
+	return ok
+}
+
+// IsVecTypeAndSon 是否是向量类型及其子类型
+func IsVecTypeAndSon(t Type) bool {
+	return IsVecType(GetBaseType(t))
+}
+
+// GetScalarType 获取向量类型的元素类型，其他类型返回自身，用于逐元素运算的类型检查
+func GetScalarType(t Type) Type {
+	if vt, ok := GetBaseType(t).(*TypeVec); ok {
+		return vt.Elem
+	}
+	return t
+}
+
+func (self TypeVec) String() string {
+	return fmt.Sprintf("vec[%d]%s", self.Size, self.Elem)
+}
+
+func (self TypeVec) Equal(t Type) bool {
+	if v, ok := t.(*TypeVec); ok {
+		return self.Size == v.Size && self.Elem.Equal(v.Elem)
+	}
+	return false
+}
+
 // TypeTuple 元组类型
 type TypeTuple struct {
 	Elems []Type
@@ -252,9 +349,17 @@ func (self TypeTuple) Equal(t Type) bool {
 	return false
 }
 
-// TypeStruct 结构体类型
+// TypeStruct 结构体类型（或联合体类型）
 type TypeStruct struct {
 	Fields *table.LinkedHashMap[string, types.Pair[bool, Type]]
+	Bits   []uint // 位域宽度，与Fields一一对应，0表示不是位域
+
+	Deprecated map[string]string // 弃用的字段及其说明
+
+	// 布局
+	Union  bool // 是否是联合体
+	Packed bool // 是否紧凑排列
+	Align  uint // 指定的对齐，0表示自然对齐
 }
 
 // NewStructType 新建结构体类型
@@ -273,10 +378,43 @@ func IsStructTypeAndSon(t Type) bool {
 	return IsStructType(GetBaseType(t))
 }
 
+// HasCustomLayout 是否不是自然排列的结构体
+func (self TypeStruct) HasCustomLayout() bool {
+	if self.Union || self.Packed || self.Align != 0 {
+		return true
+	}
+	for _, b := range self.Bits {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBits 获取成员的位域宽度，0表示不是位域
+func (self TypeStruct) GetBits(index int) uint {
+	if index >= len(self.Bits) {
+		return 0
+	}
+	return self.Bits[index]
+}
+
 func (self TypeStruct) String() string {
 	var buf strings.Builder
+	if self.Packed {
+		buf.WriteString("@packed ")
+	}
+	if self.Align != 0 {
+		buf.WriteString(fmt.Sprintf("@align(%d) ", self.Align))
+	}
+	if self.Union {
+		buf.WriteString("union ")
+	}
 	for iter := self.Fields.Begin(); iter.HasValue(); iter.Next() {
-		buf.WriteString(fmt.Sprintf("%s: %s", iter.Key(), iter.Value()))
+		buf.WriteString(fmt.Sprintf("%s: %s", iter.Key(), iter.Value().Second))
+		if bits := self.GetBits(iter.Index()); bits != 0 {
+			buf.WriteString(fmt.Sprintf(": %d", bits))
+		}
 		if iter.HasNext() {
 			buf.WriteString(", ")
 		}
@@ -286,13 +424,15 @@ func (self TypeStruct) String() string {
 
 func (self TypeStruct) Equal(t Type) bool {
 	if s, ok := t.(*TypeStruct); ok {
-		if self.Fields.Length() != s.Fields.Length() {
+		if self.Fields.Length() != s.Fields.Length() || self.Union != s.Union || self.Packed != s.Packed || self.Align != s.Align {
 			return false
 		}
 		for iter := self.Fields.Begin(); iter.HasValue(); iter.Next() {
 			sk, sv := s.Fields.GetByIndex(iter.Index())
 			if iter.Key() != sk || iter.Value().First != sv.First || !iter.Value().Second.Equal(sv.Second) {
 				return false
+			} else if self.GetBits(iter.Index()) != s.GetBits(iter.Index()) {
+				return false
 			}
 		}
 		return true
@@ -339,6 +479,12 @@ type Typedef struct {
 	Pkg  stlos.Path
 	Name string
 	Dst  Type
+	Drop *Function // 析构方法（@drop）
+
+	Deprecated *string // 弃用说明，没有弃用时为空
+
+	Generic string // 泛型类型的实例所属的泛型类型名
+	Args    []Type // 泛型类型的实例的类型实参
 }
 
 // NewTypedef 新建类型定义
@@ -367,6 +513,52 @@ func (self Typedef) Equal(t Type) bool {
 	return false
 }
 
+// NeedDrop 类型的值离开作用域时是否需要析构（自身或者成员有析构方法）
+func NeedDrop(t Type) bool {
+	switch typ := t.(type) {
+	case *Typedef:
+		return typ.Drop != nil || NeedDrop(typ.Dst)
+	case *TypeArray:
+		return typ.Size != 0 && NeedDrop(typ.Elem)
+	case *TypeTuple:
+		for _, e := range typ.Elems {
+			if NeedDrop(e) {
+				return true
+			}
+		}
+		return false
+	case *TypeStruct:
+		if typ.Union {
+			return false
+		}
+		for iter := typ.Fields.Begin(); iter.HasValue(); iter.Next() {
+			if NeedDrop(iter.Value().Second) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// 泛型类型定义，按类型实参实例化为类型定义
+type genericTypedef struct {
+	ctx       *packageContext // 定义所在的包
+	ast       *parse.TypeDef
+	methods   []*parse.Method
+	instances map[string]*Typedef // 实例，以实例名为键
+}
+
+// 新建泛型类型定义
+func newGenericTypedef(ctx *packageContext, ast *parse.TypeDef) *genericTypedef {
+	return &genericTypedef{
+		ctx:       ctx,
+		ast:       ast,
+		instances: make(map[string]*Typedef),
+	}
+}
+
 // GetBaseType 获取底层类型
 func GetBaseType(t Type) Type {
 	switch typ := t.(type) {
@@ -387,11 +579,15 @@ func GetDepthBaseType(t Type) Type {
 		for i, p := range typ.Params {
 			params[i] = GetBaseType(p)
 		}
-		return NewFuncType(GetBaseType(typ.Ret), params...)
+		ft := NewFuncType(GetBaseType(typ.Ret), params...)
+		ft.VarArg = typ.VarArg
+		return ft
 	case *TypePtr:
 		return NewPtrType(GetBaseType(typ.Elem))
 	case *TypeArray:
 		return NewArrayType(typ.Size, GetBaseType(typ.Elem))
+	case *TypeVec:
+		return typ
 	case *TypeTuple:
 		elems := make([]Type, len(typ.Elems))
 		for i, p := range typ.Elems {
@@ -403,7 +599,9 @@ func GetDepthBaseType(t Type) Type {
 		for iter := typ.Fields.Begin(); iter.HasValue(); iter.Next() {
 			fields.Set(iter.Key(), types.NewPair(iter.Value().First, GetBaseType(iter.Value().Second)))
 		}
-		return NewStructType(fields)
+		st := NewStructType(fields)
+		st.Bits, st.Union, st.Packed, st.Align = typ.Bits, typ.Union, typ.Packed, typ.Align
+		return st
 	case *Typedef:
 		return GetBaseType(typ.Dst)
 	default:
@@ -420,7 +618,11 @@ func analyseType(ctx *packageContext, ast parse.Type) (Type, utils.Error) {
 	}
 	switch typ := ast.(type) {
 	case *parse.TypeIdent:
-		return analyseTypeIdent(ctx, typ, false)
+		t, err := analyseTypeIdent(ctx, typ, false)
+		if td, ok := t.(*Typedef); ok && err == nil {
+			ctx.f.warnDeprecated(typ.Position(), typ.Name.Source, td.Deprecated)
+		}
+		return t, err
 	case *parse.TypeFunc:
 		ret, err := analyseType(ctx, typ.Ret)
 		if err != nil {
@@ -437,7 +639,9 @@ func analyseType(ctx *packageContext, ast parse.Type) (Type, utils.Error) {
 			}
 		}
 		if len(errors) == 0 {
-			return NewFuncType(ret, params...), nil
+			ft := NewFuncType(ret, params...)
+			ft.VarArg = typ.VarArg
+			return ft, nil
 		} else if len(errors) == 1 {
 			return nil, errors[0]
 		} else {
@@ -447,8 +651,22 @@ func analyseType(ctx *packageContext, ast parse.Type) (Type, utils.Error) {
 		elem, err := analyseType(ctx, typ.Elem)
 		if err != nil {
 			return nil, err
+		} else if !typ.Size.Value.IsUint64() {
+			return nil, utils.Errorf(typ.Size.Position(), "array size `%s` is too large", typ.Size.Token.Source)
 		}
-		return NewArrayType(uint(typ.Size.Value), elem), nil
+		return NewArrayType(uint(typ.Size.Value.Uint64()), elem), nil
+	case *parse.TypeVec:
+		elem, err := analyseType(ctx, typ.Elem)
+		if err != nil {
+			return nil, err
+		} else if !IsNumberType(elem) && !IsBoolType(elem) {
+			return nil, utils.Errorf(typ.Elem.Position(), "expect a integer, float or bool type")
+		} else if typ.Size.Value.Sign() == 0 {
+			return nil, utils.Errorf(typ.Size.Position(), "vector size can not be zero")
+		} else if !typ.Size.Value.IsUint64() {
+			return nil, utils.Errorf(typ.Size.Position(), "vector size `%s` is too large", typ.Size.Token.Source)
+		}
+		return NewVecType(uint(typ.Size.Value.Uint64()), elem), nil
 	case *parse.TypeTuple:
 		elems := make([]Type, len(typ.Elems))
 		var errors []utils.Error
@@ -469,19 +687,47 @@ func analyseType(ctx *packageContext, ast parse.Type) (Type, utils.Error) {
 		}
 	case *parse.TypeStruct:
 		fields := table.NewLinkedHashMap[string, types.Pair[bool, Type]]()
+		st := NewStructType(fields)
+		var bits []uint
 		var errors []utils.Error
-		for _, f := range typ.Fields {
+		for i, f := range typ.Fields {
+			if typ.Attrs != nil {
+				if err := analyseFieldAttrs(st, f.Second.Name.Source, typ.Attrs[i]); err != nil {
+					errors = append(errors, err)
+				}
+			}
 			ft, err := analyseType(ctx, f.Second.Type)
 			if err != nil {
 				errors = append(errors, err)
+				continue
 			} else if fields.ContainKey(f.Second.Name.Source) {
 				errors = append(errors, utils.Errorf(f.Second.Name.Pos, "duplicate identifier"))
-			} else {
-				fields.Set(f.Second.Name.Source, types.NewPair(f.First, ft))
+				continue
 			}
+			fields.Set(f.Second.Name.Source, types.NewPair(f.First, ft))
+
+			// 位域
+			var bit uint
+			if width := typ.Bits[i]; width != nil {
+				if !IsIntTypeAndSon(ft) {
+					errors = append(errors, utils.Errorf(f.Second.Type.Position(), "expect a integer"))
+				} else if width.Value.Sign() == 0 || width.Value.Cmp(big.NewInt(int64(getIntTypeBits(GetBaseType(ft))))) > 0 {
+					errors = append(errors, utils.Errorf(width.Position(), "invalid bit-field width `%s`", width.Value))
+				} else {
+					bit = uint(width.Value.Uint64())
+				}
+			}
+			bits = append(bits, bit)
 		}
 		if len(errors) == 0 {
-			return NewStructType(fields), nil
+			st.Union = typ.Union
+			for _, b := range bits {
+				if b != 0 {
+					st.Bits = bits
+					break
+				}
+			}
+			return st, nil
 		} else if len(errors) == 1 {
 			return nil, errors[0]
 		} else {
@@ -527,6 +773,8 @@ func checkTypeCircle(tmp *set.LinkedHashSet[*Typedef], t Type) bool {
 		return checkTypeCircle(tmp, typ.Elem)
 	case *TypeArray:
 		return checkTypeCircle(tmp, typ.Elem)
+	case *TypeVec:
+		return false
 	case *TypeTuple:
 		for _, e := range typ.Elems {
 			if checkTypeCircle(tmp, e) {
@@ -554,48 +802,154 @@ func checkTypeCircle(tmp *set.LinkedHashSet[*Typedef], t Type) bool {
 	}
 }
 
+// 获取内置类型，不存在时返回nil
+func getBuiltinType(name string) Type {
+	switch name {
+	case "i8":
+		return I8
+	case "i16":
+		return I16
+	case "i32":
+		return I32
+	case "i64":
+		return I64
+	case "i128":
+		return I128
+	case "isize":
+		return Isize
+	case "u8":
+		return U8
+	case "u16":
+		return U16
+	case "u32":
+		return U32
+	case "u64":
+		return U64
+	case "u128":
+		return U128
+	case "usize":
+		return Usize
+	case "f32":
+		return F32
+	case "f64":
+		return F64
+	case "bool":
+		return Bool
+	default:
+		return nil
+	}
+}
+
 // 标识符类型
 func analyseTypeIdent(ctx *packageContext, ast *parse.TypeIdent, isImport bool) (Type, utils.Error) {
 	if ast.Pkg == nil {
-		switch ast.Name.Source {
-		case "i8":
-			return I8, nil
-		case "i16":
-			return I16, nil
-		case "i32":
-			return I32, nil
-		case "i64":
-			return I64, nil
-		case "isize":
-			return Isize, nil
-		case "u8":
-			return U8, nil
-		case "u16":
-			return U16, nil
-		case "u32":
-			return U32, nil
-		case "u64":
-			return U64, nil
-		case "usize":
-			return Usize, nil
-		case "f32":
-			return F32, nil
-		case "f64":
-			return F64, nil
-		case "bool":
-			return Bool, nil
-		default:
-			// 类型定义
-			if td, ok := ctx.typedefs[ast.Name.Source]; ok && (!isImport || td.First) {
-				return td.Second, nil
+		// 类型形参
+		if t, ok := ctx.typeParams[ast.Name.Source]; ok && !isImport {
+			if len(ast.Args) != 0 {
+				return nil, utils.Errorf(ast.Position(), "type parameter `%s` can not have type arguments", ast.Name.Source)
+			}
+			return t, nil
+		}
+		if t := getBuiltinType(ast.Name.Source); t != nil {
+			if len(ast.Args) != 0 {
+				return nil, utils.Errorf(ast.Position(), "type `%s` is not generic", ast.Name.Source)
+			}
+			return t, nil
+		}
+		// 类型定义
+		if td, ok := ctx.typedefs[ast.Name.Source]; ok && (!isImport || td.First) {
+			if len(ast.Args) != 0 {
+				return nil, utils.Errorf(ast.Position(), "type `%s` is not generic", ast.Name.Source)
 			}
-			return nil, utils.Errorf(ast.Position(), "unknown identifier")
+			return td.Second, nil
+		}
+		// 泛型类型定义
+		if g, ok := ctx.generics[ast.Name.Source]; ok && !isImport {
+			return g.Second.instantiate(ctx, ast)
 		}
+		return nil, utils.Errorf(ast.Position(), "unknown identifier")
 	} else {
 		pkg := ctx.externs[ast.Pkg.Source]
 		if pkg == nil {
 			return nil, utils.Errorf(ast.Pkg.Pos, "unknown `%s`", ast.Pkg.Source)
 		}
+		// 类型实参在当前包中分析
+		if g, ok := pkg.generics[ast.Name.Source]; ok && g.First {
+			return g.Second.instantiate(ctx, ast)
+		}
+		if len(ast.Args) != 0 {
+			return nil, utils.Errorf(ast.Position(), "type `%s` is not generic", ast.Name.Source)
+		}
 		return analyseTypeIdent(pkg, parse.NewTypeIdent(nil, ast.Name), true)
 	}
 }
+
+// 实例化，ctx为类型实参所在的包
+func (self *genericTypedef) instantiate(ctx *packageContext, ast *parse.TypeIdent) (*Typedef, utils.Error) {
+	params := self.ast.Params
+	if len(ast.Args) != len(params) {
+		return nil, utils.Errorf(ast.Position(), "expect %d type arguments but there is %d", len(params), len(ast.Args))
+	}
+	args := make([]Type, len(ast.Args))
+	names := make([]string, len(ast.Args))
+	var errors []utils.Error
+	for i, a := range ast.Args {
+		arg, err := analyseType(ctx, a)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		} else if IsNoneType(arg) {
+			errors = append(errors, utils.Errorf(a.Position(), "expect a type"))
+			continue
+		}
+		args[i] = arg
+		names[i] = ctx.f.typeName(arg)
+	}
+	if len(errors) == 1 {
+		return nil, errors[0]
+	} else if len(errors) > 1 {
+		return nil, utils.NewMultiError(errors...)
+	}
+
+	name := fmt.Sprintf("%s[%s]", self.ast.Name.Source, strings.Join(names, ", "))
+	if td, ok := self.instances[name]; ok {
+		return td, nil
+	}
+	// 先记录实例，允许目标类型通过指针引用自身
+	td := NewTypedef(self.ctx.path, name, nil)
+	td.Generic, td.Args = self.ast.Name.Source, args
+	self.instances[name] = td
+	ictx := self.ctx.withTypeParams(params, args)
+	dst, err := analyseType(ictx, self.ast.Target)
+	if err == nil {
+		err = analyseTypeDefAttrs(td, dst, self.ast.Attrs)
+	}
+	if err != nil {
+		delete(self.instances, name)
+		return nil, err
+	}
+	td.Dst = dst
+	if checkTypeCircle(set.NewLinkedHashSet[*Typedef](), td) {
+		delete(self.instances, name)
+		return nil, utils.Errorf(self.ast.Name.Pos, "circular reference")
+	}
+
+	// 方法声明，方法体在包分析结束时分析
+	for _, m := range self.methods {
+		mctx := self.ctx.withTypeParams(m.SelfParams, args)
+		f, err := analyseMethodDecl(mctx, m)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		f.Instance = true
+		ctx.f.Globals = append(ctx.f.Globals, f)
+		ctx.f.genericMethodDefs = append(ctx.f.genericMethodDefs, types.NewPair(mctx, m))
+	}
+	if len(errors) == 1 {
+		return nil, errors[0]
+	} else if len(errors) > 1 {
+		return nil, utils.NewMultiError(errors...)
+	}
+	return td, nil
+}
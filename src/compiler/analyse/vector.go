@@ -0,0 +1,217 @@
+package analyse
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/parse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+	"math/big"
+)
+
+// Vector 向量字面量，由期待向量类型的数组字面量得到
+type Vector struct {
+	Type  Type
+	Elems []Expr
+}
+
+func (self Vector) stmt() {}
+
+func (self Vector) GetType() Type {
+	return self.Type
+}
+
+func (self Vector) GetMut() bool {
+	return false
+}
+
+func (self Vector) IsTemporary() bool {
+	return true
+}
+
+func (self Vector) IsConst() bool {
+	for _, e := range self.Elems {
+		if !e.IsConst() {
+			return false
+		}
+	}
+	return true
+}
+
+// Shuffle 按掩码从两个向量中选取元素组成新向量，下标小于Left的长度时选取Left，否则选取Right
+type Shuffle struct {
+	Left, Right Expr // Right为空时只从Left中选取
+	Mask        []uint
+}
+
+func (self Shuffle) stmt() {}
+
+func (self Shuffle) GetType() Type {
+	return NewVecType(uint(len(self.Mask)), GetBaseType(self.Left.GetType()).(*TypeVec).Elem)
+}
+
+func (self Shuffle) GetMut() bool {
+	return false
+}
+
+func (self Shuffle) IsTemporary() bool {
+	return true
+}
+
+func (self Shuffle) IsConst() bool {
+	return false
+}
+
+// ReduceOp 归约操作
+type ReduceOp uint8
+
+const (
+	ReduceAdd ReduceOp = iota // reduce_add(v)
+	ReduceMul                 // reduce_mul(v)
+	ReduceMin                 // reduce_min(v)
+	ReduceMax                 // reduce_max(v)
+	ReduceAnd                 // reduce_and(v)
+	ReduceOr                  // reduce_or(v)
+	ReduceXor                 // reduce_xor(v)
+)
+
+// 内置函数名对应的归约操作
+var reduceOps = map[string]ReduceOp{
+	"reduce_add": ReduceAdd,
+	"reduce_mul": ReduceMul,
+	"reduce_min": ReduceMin,
+	"reduce_max": ReduceMax,
+	"reduce_and": ReduceAnd,
+	"reduce_or":  ReduceOr,
+	"reduce_xor": ReduceXor,
+}
+
+// Reduce 将向量的所有元素归约为一个值
+type Reduce struct {
+	Op    ReduceOp
+	Value Expr
+}
+
+func (self Reduce) stmt() {}
+
+func (self Reduce) GetType() Type {
+	return GetBaseType(self.Value.GetType()).(*TypeVec).Elem
+}
+
+func (self Reduce) GetMut() bool {
+	return false
+}
+
+func (self Reduce) IsTemporary() bool {
+	return true
+}
+
+func (self Reduce) IsConst() bool {
+	return false
+}
+
+// 是否是布尔向量
+func isBoolVec(t Type) bool {
+	return IsVecTypeAndSon(t) && IsBoolType(GetScalarType(t))
+}
+
+// 向量元素能否转换，数字之间可以互相转换，布尔值可以转换为整数
+func canCovertVecElem(from, to Type) bool {
+	return from.Equal(to) || (IsNumberType(from) && IsNumberType(to)) || (IsBoolType(from) && IsIntType(to))
+}
+
+// 向量字面量，元素个数必须与向量长度一致
+func analyseVector(ctx *blockContext, expect Type, ast *parse.Array) (Expr, utils.Error) {
+	vt := GetBaseType(expect).(*TypeVec)
+	if uint(len(ast.Elems)) != vt.Size {
+		return nil, utils.Errorf(ast.Position(), "expect %d elements but there is %d", vt.Size, len(ast.Elems))
+	}
+	elems := make([]Expr, len(ast.Elems))
+	var errors []utils.Error
+	for i, e := range ast.Elems {
+		var err utils.Error
+		if elems[i], err = expectExpr(ctx, vt.Elem, e); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if len(errors) == 0 {
+		return &Vector{
+			Type:  expect,
+			Elems: elems,
+		}, nil
+	} else if len(errors) == 1 {
+		return nil, errors[0]
+	} else {
+		return nil, utils.NewMultiError(errors...)
+	}
+}
+
+// 洗牌，shuffle(a, [mask...])或者shuffle(a, b, [mask...])，掩码为整数字面量
+func analyseShuffle(ctx *blockContext, ident *parse.Ident, paramAsts []parse.Expr) (Expr, utils.Error) {
+	if len(paramAsts) != 2 && len(paramAsts) != 3 {
+		return nil, utils.Errorf(ident.Position(), "expect 2 or 3 arguments")
+	}
+	left, err := analyseExpr(ctx, nil, paramAsts[0])
+	if err != nil {
+		return nil, err
+	}
+	vt, ok := GetBaseType(left.GetType()).(*TypeVec)
+	if !ok {
+		return nil, utils.Errorf(paramAsts[0].Position(), "expect a vector but there is `%s`", left.GetType())
+	}
+	shuffle := &Shuffle{Left: left}
+	limit := vt.Size
+	if len(paramAsts) == 3 {
+		if shuffle.Right, err = expectExpr(ctx, left.GetType(), paramAsts[1]); err != nil {
+			return nil, err
+		}
+		limit *= 2
+	}
+
+	// 掩码
+	maskAst, ok := paramAsts[len(paramAsts)-1].(*parse.Array)
+	if !ok || len(maskAst.Elems) == 0 {
+		return nil, utils.Errorf(paramAsts[len(paramAsts)-1].Position(), "expect a array literal of indexes")
+	}
+	for _, e := range maskAst.Elems {
+		index, err := analyseExpr(ctx, U32, e)
+		if err != nil {
+			return nil, err
+		}
+		literal, ok := index.(*Integer)
+		if !ok || !IsIntTypeAndSon(literal.Type) {
+			return nil, utils.Errorf(e.Position(), "expect a integer literal")
+		} else if literal.Value.Sign() < 0 || literal.Value.Cmp(big.NewInt(int64(limit))) >= 0 {
+			return nil, utils.Errorf(e.Position(), "index %s out of range [0, %d)", literal.Value, limit)
+		}
+		shuffle.Mask = append(shuffle.Mask, uint(literal.Value.Uint64()))
+	}
+	return shuffle, nil
+}
+
+// 归约，整数的add和mul溢出时回绕，浮点数按下标顺序计算，and、or和xor只能用于整数和布尔向量
+func analyseReduce(ctx *blockContext, ident *parse.Ident, paramAsts []parse.Expr) (Expr, utils.Error) {
+	if len(paramAsts) != 1 {
+		return nil, utils.Errorf(ident.Position(), "expect 1 arguments")
+	}
+	value, err := analyseExpr(ctx, nil, paramAsts[0])
+	if err != nil {
+		return nil, err
+	}
+	vt, ok := GetBaseType(value.GetType()).(*TypeVec)
+	if !ok {
+		return nil, utils.Errorf(paramAsts[0].Position(), "expect a vector but there is `%s`", value.GetType())
+	}
+	op := reduceOps[ident.Name.Source]
+	switch op {
+	case ReduceAdd, ReduceMul, ReduceMin, ReduceMax:
+		if !IsNumberType(vt.Elem) {
+			return nil, utils.Errorf(paramAsts[0].Position(), "expect a vector of numbers")
+		}
+	default:
+		if !IsIntType(vt.Elem) && !IsBoolType(vt.Elem) {
+			return nil, utils.Errorf(paramAsts[0].Position(), "expect a vector of integers or booleans")
+		}
+	}
+	return &Reduce{
+		Op:    op,
+		Value: value,
+	}, nil
+}
@@ -0,0 +1,401 @@
+package codegen
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/analyse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+	"github.com/kkkunny/go-llvm"
+	"strings"
+)
+
+// 参数传递方式
+type abiKind uint8
+
+const (
+	abiDirect   abiKind = iota // 直接传递
+	abiCoerce                  // 转换成其他类型后传递
+	abiIndirect                // 通过指针传递（参数为byval，返回值为sret）
+	abiIgnore                  // 不传递（空类型）
+)
+
+// 参数（或返回值）的传递信息
+type abiArg struct {
+	Kind   abiKind
+	Type   llvm.Type // 原类型
+	Coerce llvm.Type // abiCoerce时实际传递的类型
+}
+
+// 函数的调用约定信息
+type abiFunc struct {
+	Ret    abiArg
+	Params []abiArg
+	Type   llvm.Type // 降级后的函数类型
+}
+
+// System V x86-64 参数分类
+type abiClass uint8
+
+const (
+	classNone abiClass = iota
+	classInteger
+	classSSE
+	classMemory
+)
+
+// 合并两个分类
+func mergeClass(l, r abiClass) abiClass {
+	switch {
+	case l == r:
+		return l
+	case l == classNone:
+		return r
+	case r == classNone:
+		return l
+	case l == classMemory || r == classMemory:
+		return classMemory
+	case l == classInteger || r == classInteger:
+		return classInteger
+	default:
+		return classSSE
+	}
+}
+
+// 是否使用System V x86-64调用约定
+func (self *CodeGenerator) isSysV() bool {
+	return strings.HasPrefix(self.triple, "x86_64") && !strings.Contains(self.triple, "windows")
+}
+
+// 是否是聚合类型
+func isAggregateType(t llvm.Type) bool {
+	switch t.TypeKind() {
+	case llvm.StructTypeKind, llvm.ArrayTypeKind:
+		return true
+	default:
+		return false
+	}
+}
+
+// 类型大小（未定义结构体的大小视为0）
+func (self *CodeGenerator) abiSize(t llvm.Type) uint64 {
+	if t.TypeKind() == llvm.StructTypeKind && t.StructElementTypesCount() == 0 {
+		return 0
+	}
+	return self.target.TypeAllocSize(t)
+}
+
+// 对类型在offset处的每个标量进行分类，结果写入classes（每8byte一个）
+func (self *CodeGenerator) classify(t llvm.Type, offset uint64, classes []abiClass) {
+	switch t.TypeKind() {
+	case llvm.StructTypeKind:
+		layout := self.layouts[t]
+		if layout != nil && layout.Union {
+			// 联合体合并所有成员的分类
+			for _, f := range layout.Fields {
+				if f.BitWidth == 0 {
+					self.classify(f.Type, offset, classes)
+				} else {
+					self.classify(llvm.ArrayType(self.ctx.Int8Type(), int((f.BitWidth+7)/8)), offset, classes)
+				}
+			}
+			return
+		}
+		for i, e := range t.StructElementTypes() {
+			if layout != nil && layout.Padding[i] {
+				continue
+			}
+			eo := offset + self.target.ElementOffset(t, i)
+			if eo%uint64(self.target.ABITypeAlignment(e)) != 0 {
+				// 未对齐的成员只能通过内存传递
+				classes[eo/8] = classMemory
+				continue
+			}
+			self.classify(e, eo, classes)
+		}
+	case llvm.ArrayTypeKind:
+		elem := t.ElementType()
+		size := self.abiSize(elem)
+		for i := 0; i < t.ArrayLength(); i++ {
+			self.classify(elem, offset+uint64(i)*size, classes)
+		}
+	default:
+		size := self.abiSize(t)
+		if size == 0 {
+			return
+		}
+		var class abiClass
+		switch t.TypeKind() {
+		case llvm.FloatTypeKind, llvm.DoubleTypeKind, llvm.VectorTypeKind:
+			class = classSSE
+		case llvm.IntegerTypeKind, llvm.PointerTypeKind:
+			class = classInteger
+		default:
+			class = classMemory
+		}
+		for i := offset / 8; i <= (offset+size-1)/8 && i < uint64(len(classes)); i++ {
+			classes[i] = mergeClass(classes[i], class)
+		}
+	}
+}
+
+// 某个8byte内是否有double
+func (self *CodeGenerator) hasDoubleAt(t llvm.Type, offset, begin uint64) bool {
+	switch t.TypeKind() {
+	case llvm.StructTypeKind:
+		if layout := self.layouts[t]; layout != nil && layout.Union {
+			for _, f := range layout.Fields {
+				if self.hasDoubleAt(f.Type, offset, begin) {
+					return true
+				}
+			}
+			return false
+		}
+		for i, e := range t.StructElementTypes() {
+			if self.hasDoubleAt(e, offset+self.target.ElementOffset(t, i), begin) {
+				return true
+			}
+		}
+		return false
+	case llvm.ArrayTypeKind:
+		size := self.abiSize(t.ElementType())
+		for i := 0; i < t.ArrayLength(); i++ {
+			if self.hasDoubleAt(t.ElementType(), offset+uint64(i)*size, begin) {
+				return true
+			}
+		}
+		return false
+	case llvm.DoubleTypeKind:
+		return offset >= begin && offset < begin+8
+	default:
+		return false
+	}
+}
+
+// 对聚合类型分类，返回降级后的类型和使用的寄存器数量，若需要通过内存传递则返回false
+func (self *CodeGenerator) classifyAggregate(t llvm.Type) (llvm.Type, int, int, bool) {
+	size := self.abiSize(t)
+	if size > 16 {
+		return llvm.Type{}, 0, 0, false
+	}
+	classes := make([]abiClass, (size+7)/8)
+	self.classify(t, 0, classes)
+
+	var intCount, sseCount int
+	elems := make([]llvm.Type, len(classes))
+	for i, c := range classes {
+		bytes := utils.Min(8, size-uint64(i)*8)
+		switch c {
+		case classMemory:
+			return llvm.Type{}, 0, 0, false
+		case classSSE:
+			sseCount++
+			if bytes <= 4 {
+				elems[i] = self.ctx.FloatType()
+			} else if self.hasDoubleAt(t, 0, uint64(i)*8) {
+				elems[i] = self.ctx.DoubleType()
+			} else {
+				elems[i] = llvm.VectorType(self.ctx.FloatType(), 2)
+			}
+		default:
+			intCount++
+			elems[i] = self.ctx.IntType(int(bytes * 8))
+		}
+	}
+	if len(elems) == 1 {
+		return elems[0], intCount, sseCount, true
+	}
+	return self.ctx.StructType(elems, false), intCount, sseCount, true
+}
+
+// 获取函数的调用约定信息
+func (self *CodeGenerator) getABIFunc(ft *analyse.TypeFunc) *abiFunc {
+	ret := self.codegenType(ft.Ret)
+	params := make([]llvm.Type, len(ft.Params))
+	for i, p := range ft.Params {
+		params[i] = self.codegenType(p)
+	}
+
+	info := &abiFunc{
+		Ret:    abiArg{Kind: abiDirect, Type: ret},
+		Params: make([]abiArg, len(params)),
+	}
+	for i, p := range params {
+		info.Params[i] = abiArg{Kind: abiDirect, Type: p}
+	}
+	if !self.isSysV() {
+		info.Type = llvm.FunctionType(ret, params, ft.VarArg)
+		return info
+	}
+
+	freeInt, freeSSE := 6, 8
+	var lowerParams []llvm.Type
+	lowerRet := ret
+
+	// 返回值
+	if isAggregateType(ret) {
+		if self.abiSize(ret) == 0 {
+			info.Ret.Kind = abiIgnore
+			lowerRet = self.ctx.VoidType()
+		} else if coerce, _, _, ok := self.classifyAggregate(ret); ok {
+			info.Ret.Kind, info.Ret.Coerce = abiCoerce, coerce
+			lowerRet = coerce
+		} else {
+			info.Ret.Kind = abiIndirect
+			lowerRet = self.ctx.VoidType()
+			lowerParams = append(lowerParams, llvm.PointerType(ret, 0))
+			freeInt--
+		}
+	}
+
+	// 参数
+	for i, p := range params {
+		switch {
+		case !isAggregateType(p):
+			switch p.TypeKind() {
+			case llvm.FloatTypeKind, llvm.DoubleTypeKind, llvm.VectorTypeKind:
+				freeSSE--
+			default:
+				// 128位整数占用两个寄存器
+				freeInt -= int((self.abiSize(p) + 7) / 8)
+			}
+			lowerParams = append(lowerParams, p)
+		case self.abiSize(p) == 0:
+			info.Params[i].Kind = abiIgnore
+		default:
+			coerce, intCount, sseCount, ok := self.classifyAggregate(p)
+			if ok && intCount <= freeInt && sseCount <= freeSSE {
+				freeInt, freeSSE = freeInt-intCount, freeSSE-sseCount
+				info.Params[i].Kind, info.Params[i].Coerce = abiCoerce, coerce
+				lowerParams = append(lowerParams, coerce)
+			} else {
+				info.Params[i].Kind = abiIndirect
+				lowerParams = append(lowerParams, llvm.PointerType(p, 0))
+			}
+		}
+	}
+
+	info.Type = llvm.FunctionType(lowerRet, lowerParams, ft.VarArg)
+	return info
+}
+
+// 给函数声明或函数调用添加sret和byval属性
+func (self *CodeGenerator) setABIAttributes(info *abiFunc, add func(i int, attr llvm.Attribute)) {
+	index := 1
+	if info.Ret.Kind == abiIndirect {
+		add(index, self.ctx.CreateTypeAttribute(llvm.AttributeKindID("sret"), info.Ret.Type))
+		index++
+	}
+	for _, p := range info.Params {
+		switch p.Kind {
+		case abiIgnore:
+			continue
+		case abiIndirect:
+			add(index, self.ctx.CreateTypeAttribute(llvm.AttributeKindID("byval"), p.Type))
+		}
+		index++
+	}
+}
+
+// 通过内存将值重新解释为另一种类型
+func (self *CodeGenerator) coerceValue(v llvm.Value, to llvm.Type) llvm.Value {
+	from := v.Type()
+	buf := self.createCoerceBuffer(from, to)
+	self.builder.CreateStore(v, self.builder.CreatePointerCast(buf, llvm.PointerType(from, 0), ""))
+	return self.builder.CreateLoad(to, self.builder.CreatePointerCast(buf, llvm.PointerType(to, 0), ""), "")
+}
+
+// 创建足够容纳两种类型的内存
+func (self *CodeGenerator) createCoerceBuffer(t1, t2 llvm.Type) llvm.Value {
+	bufType := t1
+	if self.abiSize(t2) > self.abiSize(t1) {
+		bufType = t2
+	}
+	buf := self.createAlloca(bufType)
+	buf.SetAlignment(int(utils.Max(self.typeAlign(t1), self.typeAlign(t2))))
+	return buf
+}
+
+// 按调用约定调用函数
+func (self *CodeGenerator) createCall(ft *analyse.TypeFunc, f llvm.Value, args []llvm.Value) llvm.Value {
+	info := self.getABIFunc(ft)
+
+	var sret llvm.Value
+	lowerArgs := make([]llvm.Value, 0, len(args)+1)
+	if info.Ret.Kind == abiIndirect {
+		sret = self.createAlloca(info.Ret.Type)
+		lowerArgs = append(lowerArgs, sret)
+	}
+	for i, a := range args {
+		if i >= len(info.Params) {
+			// 可变参数
+			lowerArgs = append(lowerArgs, a)
+			continue
+		}
+		switch info.Params[i].Kind {
+		case abiDirect:
+			lowerArgs = append(lowerArgs, a)
+		case abiCoerce:
+			lowerArgs = append(lowerArgs, self.coerceValue(a, info.Params[i].Coerce))
+		case abiIndirect:
+			ptr := self.createAlloca(a.Type())
+			self.builder.CreateStore(a, ptr)
+			lowerArgs = append(lowerArgs, ptr)
+		}
+	}
+
+	f = self.builder.CreatePointerCast(f, llvm.PointerType(info.Type, 0), "")
+	call := self.builder.CreateCall(info.Type, f, lowerArgs, "")
+	call.SetInstructionCallConv(callConvs[ft.CallConv])
+	self.setABIAttributes(info, call.AddCallSiteAttribute)
+
+	switch info.Ret.Kind {
+	case abiCoerce:
+		return self.coerceValue(call, info.Ret.Type)
+	case abiIndirect:
+		return self.builder.CreateLoad(info.Ret.Type, sret, "")
+	case abiIgnore:
+		return llvm.ConstNull(info.Ret.Type)
+	default:
+		return call
+	}
+}
+
+// 按调用约定获取函数参数，返回参数的地址
+func (self *CodeGenerator) lowerFuncParams(info *abiFunc, f llvm.Value) []llvm.Value {
+	params := make([]llvm.Value, len(info.Params))
+	index := 0
+	if info.Ret.Kind == abiIndirect {
+		index++
+	}
+	for i, p := range info.Params {
+		switch p.Kind {
+		case abiDirect:
+			params[i] = self.createAlloca(p.Type)
+			self.builder.CreateStore(f.Param(index), params[i])
+		case abiCoerce:
+			buf := self.createCoerceBuffer(p.Type, p.Coerce)
+			self.builder.CreateStore(f.Param(index), self.builder.CreatePointerCast(buf, llvm.PointerType(p.Coerce, 0), ""))
+			params[i] = self.builder.CreatePointerCast(buf, llvm.PointerType(p.Type, 0), "")
+		case abiIndirect:
+			params[i] = f.Param(index)
+		case abiIgnore:
+			params[i] = self.createAlloca(p.Type)
+			continue
+		}
+		index++
+	}
+	return params
+}
+
+// 按调用约定返回
+func (self *CodeGenerator) createRet(v llvm.Value) {
+	switch self.funcABI.Ret.Kind {
+	case abiCoerce:
+		self.builder.CreateRet(self.coerceValue(v, self.funcABI.Ret.Coerce))
+	case abiIndirect:
+		self.builder.CreateStore(v, self.function.Param(0))
+		self.builder.CreateRetVoid()
+	case abiIgnore:
+		self.builder.CreateRetVoid()
+	default:
+		self.builder.CreateRet(v)
+	}
+}
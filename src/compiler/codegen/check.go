@@ -0,0 +1,281 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/kkkunny/Sim/src/compiler/mangle"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+	"github.com/kkkunny/go-llvm"
+)
+
+// 报错终止程序时的退出码
+const panicExitCode = 101
+
+// 获取运行时函数，已声明时转换为指定的函数类型
+func (self *CodeGenerator) getRuntimeFunc(name string, t llvm.Type) llvm.Value {
+	f := self.module.NamedFunction(name)
+	if f.IsNil() {
+		return llvm.AddFunction(self.module, name, t)
+	}
+	return llvm.ConstPointerCast(f, llvm.PointerType(t, 0))
+}
+
+// 报错并终止程序的函数（panic、assert和运行时检查失败时调用），输出错误信息和调用栈后以退出码101退出
+func (self *CodeGenerator) getPanicFunc() llvm.Value {
+	if f := self.module.NamedFunction("__sim_panic"); !f.IsNil() {
+		return f
+	}
+	i8ptr := llvm.PointerType(self.ctx.Int8Type(), 0)
+	i32 := self.ctx.Int32Type()
+
+	// void __sim_panic(i8* msg, i32 len, i8* file, i32 row, i32 col)，len为-1时msg为c字符串
+	f := llvm.AddFunction(self.module, "__sim_panic", llvm.FunctionType(self.ctx.VoidType(), []llvm.Type{i8ptr, i32, i8ptr, i32, i32}, false))
+	f.SetLinkage(llvm.InternalLinkage)
+	f.AddFunctionAttr(self.createAttribute("noreturn"))
+	f.AddFunctionAttr(self.createAttribute("cold"))
+	f.AddFunctionAttr(self.createAttribute("noinline"))
+
+	// 调用栈在所有函数定义完成后生成
+	backtrace := llvm.AddFunction(self.module, "__sim_backtrace", llvm.FunctionType(self.ctx.VoidType(), nil, false))
+	backtrace.SetLinkage(llvm.InternalLinkage)
+	backtrace.AddFunctionAttr(self.createAttribute("noinline"))
+
+	dprintfType := llvm.FunctionType(i32, []llvm.Type{i32, i8ptr}, true)
+	fflushType := llvm.FunctionType(i32, []llvm.Type{i8ptr}, false)
+	exitType := llvm.FunctionType(self.ctx.VoidType(), []llvm.Type{i32}, false)
+
+	cur := self.builder.GetInsertBlock()
+	self.builder.SetInsertPointAtEnd(self.ctx.AddBasicBlock(f, ""))
+	// 先输出缓冲区中的内容
+	self.builder.CreateCall(fflushType, self.getRuntimeFunc("fflush", fflushType), []llvm.Value{llvm.ConstNull(i8ptr)}, "")
+	self.builder.CreateCall(dprintfType, self.getRuntimeFunc("dprintf", dprintfType), []llvm.Value{
+		llvm.ConstInt(i32, 2, false), self.constCString("panic: %s:%d:%d: %.*s\n"), f.Param(2), f.Param(3), f.Param(4), f.Param(1), f.Param(0),
+	}, "")
+	self.builder.CreateCall(backtrace.Type().ElementType(), backtrace, nil, "")
+	self.builder.CreateCall(exitType, self.getRuntimeFunc("_exit", exitType), []llvm.Value{llvm.ConstInt(i32, panicExitCode, false)}, "")
+	self.builder.CreateUnreachable()
+	if !cur.IsNil() {
+		self.builder.SetInsertPointAtEnd(cur)
+	}
+	return f
+}
+
+// 调用panic函数
+func (self *CodeGenerator) createPanic(msg, msgLen llvm.Value, pos utils.Position) {
+	f := self.getPanicFunc()
+	self.builder.CreateCall(f.Type().ElementType(), f, []llvm.Value{
+		msg,
+		msgLen,
+		self.constCString(pos.File.String()),
+		llvm.ConstInt(self.ctx.Int32Type(), uint64(pos.BeginRow), false),
+		llvm.ConstInt(self.ctx.Int32Type(), uint64(pos.BeginCol), false),
+	}, "")
+	self.builder.CreateUnreachable()
+}
+
+// 生成输出调用栈的函数，按函数地址表将返回地址还原为函数名（从修饰名还原）
+func (self *CodeGenerator) defineBacktraceFunc(f, main llvm.Value) {
+	i8ptr := llvm.PointerType(self.ctx.Int8Type(), 0)
+	i32 := self.ctx.Int32Type()
+
+	// 函数地址表
+	entryType := self.ctx.StructType([]llvm.Type{i8ptr, i8ptr}, false)
+	var entries []llvm.Value
+	entry := -1
+	for fn := self.module.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+		if fn.IsDeclaration() || fn == f {
+			continue
+		}
+		name, _ := mangle.Demangle(fn.Name())
+		if fn == main {
+			entry = len(entries)
+		}
+		entries = append(entries, self.ctx.ConstStruct([]llvm.Value{llvm.ConstPointerCast(fn, i8ptr), self.constCString(name)}, false))
+	}
+	tableInit := llvm.ConstArray(entryType, entries)
+	table := llvm.AddGlobal(self.module, tableInit.Type(), "")
+	table.SetGlobalConstant(true)
+	table.SetLinkage(llvm.PrivateLinkage)
+	table.SetInitializer(tableInit)
+	// 代码段结束地址（链接器提供），之后的地址不属于本程序的函数
+	etext := self.module.NamedGlobal("etext")
+	if etext.IsNil() {
+		etext = llvm.AddGlobal(self.module, self.ctx.Int8Type(), "etext")
+		etext.SetLinkage(llvm.ExternalWeakLinkage)
+	}
+
+	const maxFrames = 64
+	framesType := llvm.ArrayType(i8ptr, maxFrames)
+	backtraceType := llvm.FunctionType(i32, []llvm.Type{llvm.PointerType(i8ptr, 0), i32}, false)
+	dprintfType := llvm.FunctionType(i32, []llvm.Type{i32, i8ptr}, true)
+	dprintf := self.getRuntimeFunc("dprintf", dprintfType)
+	zero, one := llvm.ConstInt(t_size, 0, false), llvm.ConstInt(t_size, 1, false)
+
+	fnBk, cur := self.function, self.builder.GetInsertBlock()
+	self.function = f
+	self.builder.SetInsertPointAtEnd(self.ctx.AddBasicBlock(f, ""))
+	frames := self.createAlloca(framesType)
+	count := self.builder.CreateZExt(self.builder.CreateCall(backtraceType, self.getRuntimeFunc("backtrace", backtraceType), []llvm.Value{
+		self.builder.CreateStructGEP(framesType, frames, 0, ""), llvm.ConstInt(i32, maxFrames, false),
+	}, ""), t_size, "")
+	self.builder.CreateCall(dprintfType, dprintf, []llvm.Value{llvm.ConstInt(i32, 2, false), self.constCString("backtrace:\n")}, "")
+	limit := self.builder.CreatePtrToInt(etext, t_size, "")
+	// 跳过__sim_backtrace和__sim_panic
+	i, depth := self.createAlloca(t_size), self.createAlloca(t_size)
+	self.builder.CreateStore(llvm.ConstInt(t_size, 2, false), i)
+	self.builder.CreateStore(zero, depth)
+	best, bestAddr, j := self.createAlloca(t_size), self.createAlloca(t_size), self.createAlloca(t_size)
+
+	condBlock, frameBlock, endBlock := self.ctx.AddBasicBlock(f, ""), self.ctx.AddBasicBlock(f, ""), self.ctx.AddBasicBlock(f, "")
+	self.builder.CreateBr(condBlock)
+	self.builder.SetInsertPointAtEnd(condBlock)
+	iv := self.builder.CreateLoad(t_size, i, "")
+	self.builder.CreateCondBr(self.builder.CreateICmp(llvm.IntULT, iv, count, ""), frameBlock, endBlock)
+
+	// 在地址表中查找不大于返回地址的最大函数地址
+	self.builder.SetInsertPointAtEnd(frameBlock)
+	addr := self.builder.CreatePtrToInt(self.builder.CreateLoad(i8ptr, self.builder.CreateGEP(framesType, frames, []llvm.Value{zero, iv}, ""), ""), t_size, "")
+	self.builder.CreateStore(llvm.ConstInt(t_size, uint64(len(entries)), false), best)
+	self.builder.CreateStore(zero, bestAddr)
+	self.builder.CreateStore(zero, j)
+	searchCond, searchBody, searchNext, searchEnd := self.ctx.AddBasicBlock(f, ""), self.ctx.AddBasicBlock(f, ""), self.ctx.AddBasicBlock(f, ""), self.ctx.AddBasicBlock(f, "")
+	outside := self.builder.CreateAnd(
+		self.builder.CreateICmp(llvm.IntNE, limit, zero, ""),
+		self.builder.CreateICmp(llvm.IntUGE, addr, limit, ""),
+		"",
+	)
+	self.builder.CreateCondBr(outside, searchEnd, searchCond)
+	self.builder.SetInsertPointAtEnd(searchCond)
+	jv := self.builder.CreateLoad(t_size, j, "")
+	self.builder.CreateCondBr(self.builder.CreateICmp(llvm.IntULT, jv, llvm.ConstInt(t_size, uint64(len(entries)), false), ""), searchBody, searchEnd)
+	self.builder.SetInsertPointAtEnd(searchBody)
+	fnAddr := self.builder.CreatePtrToInt(self.builder.CreateLoad(i8ptr, self.builder.CreateGEP(tableInit.Type(), table, []llvm.Value{zero, jv, llvm.ConstInt(i32, 0, false)}, ""), ""), t_size, "")
+	better := self.builder.CreateAnd(
+		self.builder.CreateICmp(llvm.IntULE, fnAddr, addr, ""),
+		self.builder.CreateICmp(llvm.IntUGT, fnAddr, self.builder.CreateLoad(t_size, bestAddr, ""), ""),
+		"",
+	)
+	updateBlock := self.ctx.AddBasicBlock(f, "")
+	self.builder.CreateCondBr(better, updateBlock, searchNext)
+	self.builder.SetInsertPointAtEnd(updateBlock)
+	self.builder.CreateStore(jv, best)
+	self.builder.CreateStore(fnAddr, bestAddr)
+	self.builder.CreateBr(searchNext)
+	self.builder.SetInsertPointAtEnd(searchNext)
+	self.builder.CreateStore(self.builder.CreateAdd(jv, one, ""), j)
+	self.builder.CreateBr(searchCond)
+
+	// 输出找到的函数，到入口函数为止
+	self.builder.SetInsertPointAtEnd(searchEnd)
+	bv := self.builder.CreateLoad(t_size, best, "")
+	printBlock, nextBlock := self.ctx.AddBasicBlock(f, ""), self.ctx.AddBasicBlock(f, "")
+	self.builder.CreateCondBr(self.builder.CreateICmp(llvm.IntULT, bv, llvm.ConstInt(t_size, uint64(len(entries)), false), ""), printBlock, nextBlock)
+	self.builder.SetInsertPointAtEnd(printBlock)
+	dv := self.builder.CreateLoad(t_size, depth, "")
+	name := self.builder.CreateLoad(i8ptr, self.builder.CreateGEP(tableInit.Type(), table, []llvm.Value{zero, bv, llvm.ConstInt(i32, 1, false)}, ""), "")
+	self.builder.CreateCall(dprintfType, dprintf, []llvm.Value{llvm.ConstInt(i32, 2, false), self.constCString("  %2zu: %s\n"), dv, name}, "")
+	self.builder.CreateStore(self.builder.CreateAdd(dv, one, ""), depth)
+	if entry >= 0 {
+		self.builder.CreateCondBr(self.builder.CreateICmp(llvm.IntEQ, bv, llvm.ConstInt(t_size, uint64(entry), false), ""), endBlock, nextBlock)
+	} else {
+		self.builder.CreateBr(nextBlock)
+	}
+	self.builder.SetInsertPointAtEnd(nextBlock)
+	self.builder.CreateStore(self.builder.CreateAdd(iv, one, ""), i)
+	self.builder.CreateBr(condBlock)
+
+	self.builder.SetInsertPointAtEnd(endBlock)
+	self.builder.CreateRetVoid()
+
+	self.function = fnBk
+	if !cur.IsNil() {
+		self.builder.SetInsertPointAtEnd(cur)
+	}
+}
+
+// 常量c字符串
+func (self *CodeGenerator) constCString(s string) llvm.Value {
+	if v, ok := self.checkStrings[s]; ok {
+		return v
+	}
+	init := self.ctx.ConstString(s, true)
+	g := llvm.AddGlobal(self.module, init.Type(), "")
+	g.SetGlobalConstant(true)
+	g.SetLinkage(llvm.PrivateLinkage)
+	g.SetInitializer(init)
+	v := llvm.ConstPointerCast(g, llvm.PointerType(self.ctx.Int8Type(), 0))
+	self.checkStrings[s] = v
+	return v
+}
+
+// 插入运行时检查，fail为真时报错并终止程序
+func (self *CodeGenerator) createCheck(fail llvm.Value, pos utils.Position, msg string) {
+	fb, cb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
+	self.builder.CreateCondBr(fail, fb, cb)
+
+	self.builder.SetInsertPointAtEnd(fb)
+	self.createPanic(self.constCString(msg), llvm.ConstInt(self.ctx.Int32Type(), uint64(len(msg)), false), pos)
+
+	self.builder.SetInsertPointAtEnd(cb)
+}
+
+// 空指针检查
+func (self *CodeGenerator) checkNull(ptr llvm.Value, pos utils.Position) {
+	if !self.checks {
+		return
+	}
+	self.createCheck(self.builder.CreateIsNull(ptr, ""), pos, "null pointer dereference")
+}
+
+// 数组越界检查
+func (self *CodeGenerator) checkIndex(index llvm.Value, length int, pos utils.Position) {
+	if !self.checks {
+		return
+	}
+	fail := self.builder.CreateICmp(llvm.IntUGE, index, llvm.ConstInt(index.Type(), uint64(length), false), "")
+	self.createCheck(fail, pos, fmt.Sprintf("index out of range [0, %d)", length))
+}
+
+// 除零检查（有符号整数同时检查溢出）
+func (self *CodeGenerator) checkDivide(l, r llvm.Value, signed bool, pos utils.Position) {
+	if !self.checks {
+		return
+	}
+	self.createCheck(self.anyTrue(self.builder.CreateIsNull(r, "")), pos, "division by zero")
+	if signed {
+		bits := scalarType(l.Type()).IntTypeWidth()
+		min := llvm.ConstShl(self.constInt(l.Type(), 1, false), self.constInt(l.Type(), uint64(bits-1), false))
+		fail := self.builder.CreateAnd(
+			self.builder.CreateICmp(llvm.IntEQ, l, min, ""),
+			self.builder.CreateICmp(llvm.IntEQ, r, llvm.ConstAllOnes(r.Type()), ""),
+			"",
+		)
+		self.createCheck(self.anyTrue(fail), pos, "integer overflow")
+	}
+}
+
+// 移位位数检查
+func (self *CodeGenerator) checkShift(r llvm.Value, pos utils.Position) {
+	if !self.checks {
+		return
+	}
+	fail := self.builder.CreateICmp(llvm.IntUGE, r, self.constInt(r.Type(), uint64(scalarType(r.Type()).IntTypeWidth()), false), "")
+	self.createCheck(self.anyTrue(fail), pos, "shift amount out of range")
+}
+
+// 带溢出检查的有符号整数运算（opera为add、sub或mul）
+func (self *CodeGenerator) createOverflowOp(opera string, l, r llvm.Value, pos utils.Position) llvm.Value {
+	t := l.Type()
+	name := fmt.Sprintf("llvm.s%s.with.overflow.%s", opera, intrinsicTypeName(t))
+	flag := self.ctx.Int1Type()
+	if t.TypeKind() == llvm.VectorTypeKind {
+		flag = llvm.VectorType(flag, t.VectorSize())
+	}
+	ft := llvm.FunctionType(self.ctx.StructType([]llvm.Type{t, flag}, false), []llvm.Type{t, t}, false)
+	f := self.module.NamedFunction(name)
+	if f.IsNil() {
+		f = llvm.AddFunction(self.module, name, ft)
+	}
+	res := self.builder.CreateCall(ft, f, []llvm.Value{l, r}, "")
+	self.createCheck(self.anyTrue(self.builder.CreateExtractValue(res, 1, "")), pos, "integer overflow")
+	return self.builder.CreateExtractValue(res, 0, "")
+}
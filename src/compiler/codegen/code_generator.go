@@ -11,33 +11,56 @@ type CodeGenerator struct {
 	ctx      llvm.Context
 	module   llvm.Module
 	builder  llvm.Builder
+	triple   string
+	target   llvm.TargetData
 	function llvm.Value
+	funcABI  *abiFunc
+	checks   bool // 是否插入运行时检查
 
-	vars  map[analyse.Expr]llvm.Value
-	types map[string]llvm.Type
+	vars    map[analyse.Expr]llvm.Value
+	types   map[string]llvm.Type
+	layouts map[llvm.Type]*typeLayout
 
 	// loop
 	cb, eb llvm.BasicBlock
-	// defer
-	defers []deferInfo
+	// 作用域（析构和defer）
+	scopes    []*scope
+	loopScope int // 当前循环体作用域的下标
+	dropFlags map[*analyse.Variable]llvm.Value
+	temps     []*temporary // 当前语句中需要析构的临时值
 	// string
 	stringPool map[string]llvm.Value
 	// cstring
 	cstringPool map[string]llvm.Value
+	// 运行时检查用到的字符串
+	checkStrings map[string]llvm.Value
 }
 
-// NewCodeGenerator 新建代码生成器
-func NewCodeGenerator() *CodeGenerator {
+// NewCodeGenerator 新建代码生成器，checks为是否插入运行时检查
+func NewCodeGenerator(checks bool) *CodeGenerator {
 	ctx := llvm.NewContext()
+	stlutil.Must(llvm.InitializeNativeTarget())
+	triple := llvm.DefaultTargetTriple()
+	target := stlutil.MustValue(llvm.GetTargetFromTriple(triple))
+	tm := target.CreateTargetMachine(triple, "generic", "", llvm.CodeGenLevelNone, llvm.RelocPIC, llvm.CodeModelDefault)
 	cg := &CodeGenerator{
 		ctx:         ctx,
 		module:      ctx.NewModule(""),
 		builder:     ctx.NewBuilder(),
+		triple:      triple,
+		target:      tm.CreateTargetData(),
 		vars:        make(map[analyse.Expr]llvm.Value),
 		types:       make(map[string]llvm.Type),
+		layouts:     make(map[llvm.Type]*typeLayout),
+		dropFlags:   make(map[*analyse.Variable]llvm.Value),
 		stringPool:  make(map[string]llvm.Value),
 		cstringPool: make(map[string]llvm.Value),
+		checks:      checks,
+
+		checkStrings: make(map[string]llvm.Value),
 	}
+	cg.module.SetTarget(triple)
+	cg.module.SetDataLayout(cg.target.String())
 	cg.init()
 	return cg
 }
@@ -48,18 +71,53 @@ func (self *CodeGenerator) Codegen(mean analyse.ProgramContext) llvm.Module {
 	for _, g := range mean.Globals {
 		switch global := g.(type) {
 		case *analyse.Function:
-			ft := self.codegenType(global.GetType()).ElementType()
-			f := llvm.AddFunction(self.module, global.ExternName, ft)
+			info := self.getABIFunc(global.GetType().(*analyse.TypeFunc))
+			if global.ExternName != "" && global.Body == nil {
+				// 同一外部函数的多次声明共用一个符号
+				if f := self.module.NamedFunction(global.ExternName); !f.IsNil() {
+					self.vars[global] = llvm.ConstPointerCast(f, llvm.PointerType(info.Type, 0))
+					continue
+				}
+			}
+			f := llvm.AddFunction(self.module, stlutil.Ternary(global.ExternName != "", global.ExternName, global.Symbol), info.Type)
+			if global.Weak {
+				f.SetLinkage(stlutil.Ternary(global.Body == nil, llvm.ExternalWeakLinkage, llvm.WeakAnyLinkage))
+			} else if global.ExternName == "" && !global.Public {
+				f.SetLinkage(llvm.InternalLinkage)
+			} else if global.Instance && global.ExternName == "" {
+				self.setLinkOnce(f, global.Symbol)
+			}
+			if global.Section != "" {
+				f.SetSection(global.Section)
+			}
+			f.SetFunctionCallConv(callConvs[global.CallConv])
+			self.setABIAttributes(info, f.AddAttributeAtIndex)
 			if global.NoReturn {
-				f.AddFunctionAttr(self.ctx.CreateEnumAttribute(31, 0))
+				f.AddFunctionAttr(self.createAttribute("noreturn"))
 			}
 			if global.Inline != nil {
-				f.AddFunctionAttr(self.ctx.CreateEnumAttribute(stlutil.Ternary[uint](*global.Inline, 1, 26), 0))
+				f.AddFunctionAttr(self.createAttribute(stlutil.Ternary(*global.Inline, "alwaysinline", "noinline")))
+			}
+			if global.Cold {
+				f.AddFunctionAttr(self.createAttribute("cold"))
 			}
 			self.vars[global] = f
 		case *analyse.GlobalVariable:
 			vt := self.codegenType(global.GetType())
-			self.vars[global] = llvm.AddGlobal(self.module, vt, global.ExternName)
+			v := llvm.AddGlobal(self.module, vt, stlutil.Ternary(global.ExternName != "", global.ExternName, global.Symbol))
+			if global.Weak {
+				v.SetLinkage(stlutil.Ternary(global.Value == nil, llvm.ExternalWeakLinkage, llvm.WeakAnyLinkage))
+			} else if global.ExternName == "" && !global.Public {
+				v.SetLinkage(llvm.InternalLinkage)
+			}
+			if global.Section != "" {
+				v.SetSection(global.Section)
+			}
+			if global.ThreadLocal != "" {
+				setThreadLocal(v, global.ThreadLocal)
+			}
+			v.SetAlignment(int(self.typeAlign(vt)))
+			self.vars[global] = v
 		default:
 			panic("")
 		}
@@ -71,18 +129,15 @@ func (self *CodeGenerator) Codegen(mean analyse.ProgramContext) llvm.Module {
 			if global.Body != nil {
 				f := self.vars[global]
 				self.function = f
-				entry := llvm.AddBasicBlock(f, "")
+				self.funcABI = self.getABIFunc(global.GetType().(*analyse.TypeFunc))
+				entry := self.ctx.AddBasicBlock(f, "")
 				self.builder.SetInsertPointAtEnd(entry)
 
-				for i, p := range global.Params {
-					param := self.builder.CreateAlloca(self.codegenType(p.GetType()), "")
-					self.builder.CreateStore(f.Param(i), param)
-					self.vars[p] = param
+				for i, param := range self.lowerFuncParams(self.funcABI, f) {
+					self.vars[global.Params[i]] = param
 				}
 
 				self.codegenBlock(*global.Body)
-
-				self.defers = nil
 			}
 		case *analyse.GlobalVariable:
 			if global.Value != nil {
@@ -92,5 +147,15 @@ func (self *CodeGenerator) Codegen(mean analyse.ProgramContext) llvm.Module {
 			panic("")
 		}
 	}
+	// 程序入口，调用栈输出到主包的main函数为止
+	main := self.module.NamedFunction("main")
+	if mean.Main != nil {
+		self.defineEntry(mean.Main)
+		main = self.vars[mean.Main]
+	}
+	// 调用栈需要所有函数的地址
+	if f := self.module.NamedFunction("__sim_backtrace"); !f.IsNil() {
+		self.defineBacktraceFunc(f, main)
+	}
 	return self.module
 }
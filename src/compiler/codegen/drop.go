@@ -0,0 +1,163 @@
+package codegen
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/analyse"
+	"github.com/kkkunny/go-llvm"
+)
+
+// 作用域，离开时逆序执行其中的清理（析构变量和defer）
+type scope struct {
+	cleanups []func()
+}
+
+// 进入作用域
+func (self *CodeGenerator) enterScope() {
+	self.scopes = append(self.scopes, &scope{})
+}
+
+// 退出作用域（不生成析构代码）
+func (self *CodeGenerator) exitScope() {
+	self.scopes = self.scopes[:len(self.scopes)-1]
+}
+
+// 离开作用域，从内到外逆序执行下标不小于depth的作用域中的清理
+func (self *CodeGenerator) leaveScopes(depth int) {
+	for i := len(self.scopes) - 1; i >= depth; i-- {
+		cleanups := self.scopes[i].cleanups
+		for j := len(cleanups) - 1; j >= 0; j-- {
+			cleanups[j]()
+		}
+	}
+}
+
+// 在当前作用域中添加清理
+func (self *CodeGenerator) addCleanup(f func()) {
+	cur := self.scopes[len(self.scopes)-1]
+	cur.cleanups = append(cur.cleanups, f)
+}
+
+// 声明需要析构的变量，变量的析构标志置为true
+func (self *CodeGenerator) declareDrop(v *analyse.Variable) {
+	flag := self.createAlloca(self.ctx.Int1Type())
+	self.builder.CreateStore(llvm.ConstInt(self.ctx.Int1Type(), 1, false), flag)
+	self.dropFlags[v] = flag
+	self.addCleanup(func() {
+		self.dropVariable(v)
+	})
+}
+
+// 析构标志为true时析构变量，并将析构标志置为false
+func (self *CodeGenerator) dropVariable(v *analyse.Variable) {
+	flag, ok := self.dropFlags[v]
+	if !ok {
+		return
+	}
+	db, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
+	self.builder.CreateCondBr(self.builder.CreateLoad(self.ctx.Int1Type(), flag, ""), db, eb)
+	self.builder.SetInsertPointAtEnd(db)
+	self.builder.CreateStore(llvm.ConstInt(self.ctx.Int1Type(), 0, false), flag)
+	self.createDrop(self.vars[v], v.Type)
+	self.builder.CreateBr(eb)
+	self.builder.SetInsertPointAtEnd(eb)
+}
+
+// 将变量标记为已移出，离开作用域时不再析构
+func (self *CodeGenerator) moveVariable(v *analyse.Variable) {
+	if flag, ok := self.dropFlags[v]; ok {
+		self.builder.CreateStore(llvm.ConstInt(self.ctx.Int1Type(), 0, false), flag)
+	}
+}
+
+// 需要析构的临时值（函数调用、字面量和错误传播的结果），没有被移出时在所在的语句结束时析构
+type temporary struct {
+	ptr, flag llvm.Value
+	typ       analyse.Type
+}
+
+// 是否产生需要析构的临时值
+func isTemporaryOwner(v analyse.Expr) bool {
+	switch v.(type) {
+	case *analyse.FuncCall, *analyse.MethodCall, *analyse.Array, *analyse.Tuple, *analyse.Struct, *analyse.Try:
+		return analyse.NeedDrop(v.GetType())
+	default:
+		return false
+	}
+}
+
+// 将临时值保存到栈上，析构标志置为true，getValue为false时返回地址
+func (self *CodeGenerator) createTemporary(v llvm.Value, t analyse.Type, getValue bool) llvm.Value {
+	temp := &temporary{
+		ptr:  self.createEntryAlloca(v.Type()),
+		flag: self.createEntryAlloca(self.ctx.Int1Type()),
+		typ:  t,
+	}
+	self.builder.CreateStore(v, temp.ptr)
+	self.builder.CreateStore(llvm.ConstInt(self.ctx.Int1Type(), 1, false), temp.flag)
+	self.temps = append(self.temps, temp)
+	if getValue {
+		return v
+	}
+	return temp.ptr
+}
+
+// 语句结束，逆序析构下标不小于mark的临时值
+func (self *CodeGenerator) dropTemporaries(mark int) {
+	self.createTemporariesDrop(self.temps[mark:])
+	self.temps = self.temps[:mark]
+}
+
+// 逆序析构析构标志为true的临时值，并将析构标志置为false
+func (self *CodeGenerator) createTemporariesDrop(temps []*temporary) {
+	for i := len(temps) - 1; i >= 0; i-- {
+		temp := temps[i]
+		db, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
+		self.builder.CreateCondBr(self.builder.CreateLoad(self.ctx.Int1Type(), temp.flag, ""), db, eb)
+		self.builder.SetInsertPointAtEnd(db)
+		self.builder.CreateStore(llvm.ConstInt(self.ctx.Int1Type(), 0, false), temp.flag)
+		self.createDrop(temp.ptr, temp.typ)
+		self.builder.CreateBr(eb)
+		self.builder.SetInsertPointAtEnd(eb)
+	}
+}
+
+// 在函数入口分配内存并置为零值，临时值可能只在部分执行路径上产生（短路求值、选择和错误传播）
+func (self *CodeGenerator) createEntryAlloca(t llvm.Type) llvm.Value {
+	cur := self.builder.GetInsertBlock()
+	if first := self.function.EntryBasicBlock().FirstInstruction(); first.IsNil() {
+		self.builder.SetInsertPointAtEnd(self.function.EntryBasicBlock())
+	} else {
+		self.builder.SetInsertPointBefore(first)
+	}
+	v := self.createAlloca(t)
+	self.builder.CreateStore(llvm.ConstNull(t), v)
+	self.builder.SetInsertPointAtEnd(cur)
+	return v
+}
+
+// 析构ptr指向的值，先调用类型定义的析构方法，再析构成员
+func (self *CodeGenerator) createDrop(ptr llvm.Value, t analyse.Type) {
+	if !analyse.NeedDrop(t) {
+		return
+	}
+	switch typ := t.(type) {
+	case *analyse.Typedef:
+		if typ.Drop != nil {
+			self.createCall(typ.Drop.GetType().(*analyse.TypeFunc), self.vars[typ.Drop], []llvm.Value{ptr})
+		}
+		self.createDrop(ptr, typ.Dst)
+	case *analyse.TypeArray:
+		for i := uint(0); i < typ.Size; i++ {
+			self.createDrop(self.createArrayIndex(ptr, llvm.ConstInt(t_size, uint64(i), false), false), typ.Elem)
+		}
+	case *analyse.TypeTuple:
+		for i, e := range typ.Elems {
+			self.createDrop(self.createStructIndex(ptr, uint(i), false), e)
+		}
+	case *analyse.TypeStruct:
+		for iter := typ.Fields.Begin(); iter.HasValue(); iter.Next() {
+			self.createDrop(self.createStructIndex(ptr, uint(iter.Index()), false), iter.Value().Second)
+		}
+	default:
+		panic("")
+	}
+}
@@ -0,0 +1,35 @@
+package codegen
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/analyse"
+	"github.com/kkkunny/go-llvm"
+)
+
+// 程序入口的参数，std.os导入时定义，没有导入时不保存
+var entryGlobals = []string{"__sim_argc", "__sim_argv"}
+
+// 程序入口 int main(int argc, char** argv, char** envp)，保存命令行参数后调用主包的main函数
+// 环境变量由c运行时根据envp初始化到environ中，std.os直接使用environ
+func (self *CodeGenerator) defineEntry(main *analyse.Function) {
+	i32 := self.ctx.Int32Type()
+	strs := llvm.PointerType(llvm.PointerType(self.ctx.Int8Type(), 0), 0)
+	entry := llvm.AddFunction(self.module, "main", llvm.FunctionType(i32, []llvm.Type{i32, strs, strs}, false))
+	self.builder.SetInsertPointAtEnd(self.ctx.AddBasicBlock(entry, ""))
+
+	for i, name := range entryGlobals {
+		if g := self.module.NamedGlobal(name); !g.IsNil() {
+			param := entry.Param(i)
+			self.builder.CreateStore(param, self.builder.CreatePointerCast(g, llvm.PointerType(param.Type(), 0), ""))
+		}
+	}
+
+	ret := self.createCall(main.GetType().(*analyse.TypeFunc), self.vars[main], nil)
+	switch {
+	case main.Ret.Equal(analyse.None):
+		self.builder.CreateRet(llvm.ConstInt(i32, 0, false))
+	case main.Ret.Equal(analyse.U8):
+		self.builder.CreateRet(self.builder.CreateZExt(ret, i32, ""))
+	default:
+		self.builder.CreateRet(ret)
+	}
+}
@@ -5,57 +5,83 @@ import (
 	"github.com/kkkunny/Sim/src/compiler/analyse"
 	"github.com/kkkunny/go-llvm"
 	stlutil "github.com/kkkunny/stl/util"
-	"unsafe"
+	"strconv"
+	"strings"
 )
 
-// 表达式
+// 表达式，需要析构的临时值保存到栈上，在所在的语句结束时析构
 func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Value {
+	if isTemporaryOwner(mean) {
+		return self.createTemporary(self.codegenOwnedExpr(mean, true), mean.GetType(), getValue)
+	}
+	return self.codegenOwnedExpr(mean, getValue)
+}
+
+// 表达式，产生的临时值由调用者负责析构
+func (self *CodeGenerator) codegenOwnedExpr(mean analyse.Expr, getValue bool) llvm.Value {
 	switch expr := mean.(type) {
 	case *analyse.Null, *analyse.Integer, *analyse.Float, *analyse.Boolean, *analyse.String, *analyse.EmptyStruct, *analyse.EmptyArray, *analyse.EmptyTuple:
 		return self.codegenConstantExpr(mean)
 	case *analyse.Binary:
+		// 向量按元素类型选择指令
+		t := analyse.GetScalarType(expr.GetType())
 		switch expr.Opera {
 		case "+":
 			l, r := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
-			if analyse.IsSintTypeAndSon(expr.GetType()) {
+			if analyse.IsSintTypeAndSon(t) {
+				if self.checks {
+					return self.createOverflowOp("add", l, r, expr.Pos)
+				}
 				return self.builder.CreateNSWAdd(l, r, "")
-			} else if analyse.IsUintTypeAndSon(expr.GetType()) {
-				return self.builder.CreateNUWAdd(l, r, "")
+			} else if analyse.IsUintTypeAndSon(t) {
+				return self.builder.CreateAdd(l, r, "")
 			} else {
 				return self.builder.CreateFAdd(l, r, "")
 			}
 		case "-":
 			l, r := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
-			if analyse.IsSintTypeAndSon(expr.GetType()) {
+			if analyse.IsSintTypeAndSon(t) {
+				if self.checks {
+					return self.createOverflowOp("sub", l, r, expr.Pos)
+				}
 				return self.builder.CreateNSWSub(l, r, "")
-			} else if analyse.IsUintTypeAndSon(expr.GetType()) {
-				return self.builder.CreateNUWSub(l, r, "")
+			} else if analyse.IsUintTypeAndSon(t) {
+				return self.builder.CreateSub(l, r, "")
 			} else {
 				return self.builder.CreateFSub(l, r, "")
 			}
 		case "*":
 			l, r := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
-			if analyse.IsSintTypeAndSon(expr.GetType()) {
+			if analyse.IsSintTypeAndSon(t) {
+				if self.checks {
+					return self.createOverflowOp("mul", l, r, expr.Pos)
+				}
 				return self.builder.CreateNSWMul(l, r, "")
-			} else if analyse.IsUintTypeAndSon(expr.GetType()) {
-				return self.builder.CreateNUWMul(l, r, "")
+			} else if analyse.IsUintTypeAndSon(t) {
+				return self.builder.CreateMul(l, r, "")
 			} else {
 				return self.builder.CreateFMul(l, r, "")
 			}
 		case "/":
 			l, r := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
-			if analyse.IsSintTypeAndSon(expr.GetType()) {
+			if analyse.IsIntTypeAndSon(t) {
+				self.checkDivide(l, r, analyse.IsSintTypeAndSon(t), expr.Pos)
+			}
+			if analyse.IsSintTypeAndSon(t) {
 				return self.builder.CreateSDiv(l, r, "")
-			} else if analyse.IsUintTypeAndSon(expr.GetType()) {
+			} else if analyse.IsUintTypeAndSon(t) {
 				return self.builder.CreateUDiv(l, r, "")
 			} else {
 				return self.builder.CreateFDiv(l, r, "")
 			}
 		case "%":
 			l, r := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
-			if analyse.IsSintTypeAndSon(expr.GetType()) {
+			if analyse.IsIntTypeAndSon(t) {
+				self.checkDivide(l, r, analyse.IsSintTypeAndSon(t), expr.Pos)
+			}
+			if analyse.IsSintTypeAndSon(t) {
 				return self.builder.CreateSRem(l, r, "")
-			} else if analyse.IsUintTypeAndSon(expr.GetType()) {
+			} else if analyse.IsUintTypeAndSon(t) {
 				return self.builder.CreateURem(l, r, "")
 			} else {
 				return self.builder.CreateFRem(l, r, "")
@@ -71,16 +97,18 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 			return self.builder.CreateXor(l, r, "")
 		case "<<":
 			l, r := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
+			self.checkShift(r, expr.Pos)
 			return self.builder.CreateShl(l, r, "")
 		case ">>":
 			l, r := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
-			if analyse.IsSintTypeAndSon(expr.GetType()) {
+			self.checkShift(r, expr.Pos)
+			if analyse.IsSintTypeAndSon(t) {
 				return self.builder.CreateAShr(l, r, "")
 			} else {
 				return self.builder.CreateLShr(l, r, "")
 			}
 		case "&&":
-			nb, eb := llvm.AddBasicBlock(self.function, ""), llvm.AddBasicBlock(self.function, "")
+			nb, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
 			self.builder.CreateCondBr(self.builder.CreateIntCast(self.codegenExpr(expr.Left, true), self.ctx.Int1Type(), ""), nb, eb)
 			pb := self.builder.GetInsertBlock()
 
@@ -94,7 +122,7 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 			phi.AddIncoming([]llvm.Value{llvm.ConstInt(self.ctx.Int1Type(), 0, true), nv}, []llvm.BasicBlock{pb, nb})
 			return self.builder.CreateIntCast(phi, t_bool, "")
 		case "||":
-			nb, eb := llvm.AddBasicBlock(self.function, ""), llvm.AddBasicBlock(self.function, "")
+			nb, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
 			self.builder.CreateCondBr(self.builder.CreateIntCast(self.codegenExpr(expr.Left, true), self.ctx.Int1Type(), ""), eb, nb)
 			pb := self.builder.GetInsertBlock()
 
@@ -126,29 +154,10 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 		for i, a := range expr.Args {
 			args[i] = self.codegenExpr(a, true)
 		}
-		call := self.builder.CreateCall(f.Type().ReturnType(), f, args, "")
-		if meanFunc, ok := expr.Func.(*analyse.Function); ok {
-			if meanFunc.NoReturn {
-				self.doneBeforeFuncEnd()
-			}
-		}
-		return call
+		return self.createCall(analyse.GetBaseType(expr.Func.GetType()).(*analyse.TypeFunc), f, args)
 	case *analyse.MethodCall:
-		f := self.codegenExpr(expr.Method.Func, true)
-		args := make([]llvm.Value, len(expr.Args)+1)
-		if analyse.IsPtrType(expr.Method.Self.GetType()) {
-			args[0] = self.codegenExpr(expr.Method.Self, true)
-		} else if expr.Method.Self.GetMut() {
-			args[0] = self.codegenExpr(expr.Method.Self, false)
-		} else {
-			selfArg := self.codegenExpr(expr.Method.Self, true)
-			args[0] = self.builder.CreateAlloca(selfArg.Type(), "")
-			self.builder.CreateStore(selfArg, args[0])
-		}
-		for i, a := range expr.Args {
-			args[i+1] = self.codegenExpr(a, true)
-		}
-		call := self.builder.CreateCall(f.Type().ReturnType(), f, args, "")
+		f, args := self.codegenMethodCallArgs(expr)
+		call := self.createCall(expr.Method.Func.GetType().(*analyse.TypeFunc), f, args)
 		if expr.Method.Func.NoReturn {
 			self.builder.CreateUnreachable()
 		}
@@ -162,14 +171,30 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 	case *analyse.Assign:
 		switch expr.Opera {
 		case "=":
+			if field, ok := expr.Left.(*analyse.GetField); ok && field.IsBitField() {
+				from, right := self.codegenExpr(field.From, false), self.codegenExpr(expr.Right, true)
+				self.storeStructIndex(from, self.getFieldIndex(field), right)
+				return llvm.Value{}
+			}
 			left, right := self.codegenExpr(expr.Left, false), self.codegenExpr(expr.Right, true)
+			// 覆盖需要析构的局部变量前析构原有的值
+			if v, ok := expr.Left.(*analyse.Variable); ok {
+				if flag, ok := self.dropFlags[v]; ok {
+					self.dropVariable(v)
+					self.builder.CreateStore(right, left)
+					self.builder.CreateStore(llvm.ConstInt(self.ctx.Int1Type(), 1, false), flag)
+					return llvm.Value{}
+				}
+			}
 			self.builder.CreateStore(right, left)
 			return llvm.Value{}
 		default:
 			return self.codegenExpr(&analyse.Assign{
+				Pos:   expr.Pos,
 				Opera: "=",
 				Left:  expr.Left,
 				Right: &analyse.Binary{
+					Pos:   expr.Pos,
 					Opera: expr.Opera[:len(expr.Opera)-1],
 					Left:  expr.Left,
 					Right: expr.Right,
@@ -178,41 +203,42 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 		}
 	case *analyse.Equal:
 		left, right := self.codegenExpr(expr.Left, true), self.codegenExpr(expr.Right, true)
+		t := analyse.GetScalarType(expr.Left.GetType())
 		var v llvm.Value
 		switch expr.Opera {
 		case "==":
 			v = self.equal(left, right)
 		case "!=":
 			left = self.equal(left, right)
-			v = self.builder.CreateXor(left, llvm.ConstInt(left.Type(), 1, true), "")
+			v = self.builder.CreateXor(left, self.constInt(left.Type(), 1, true), "")
 		case "<":
-			if analyse.IsSintTypeAndSon(expr.Left.GetType()) {
+			if analyse.IsSintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntSLT, left, right, "")
-			} else if analyse.IsUintTypeAndSon(expr.Left.GetType()) {
+			} else if analyse.IsUintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntULT, left, right, "")
 			} else {
 				v = self.builder.CreateFCmp(llvm.FloatOLT, left, right, "")
 			}
 		case "<=":
-			if analyse.IsSintTypeAndSon(expr.Left.GetType()) {
+			if analyse.IsSintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntSLE, left, right, "")
-			} else if analyse.IsUintTypeAndSon(expr.Left.GetType()) {
+			} else if analyse.IsUintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntULE, left, right, "")
 			} else {
 				v = self.builder.CreateFCmp(llvm.FloatOLE, left, right, "")
 			}
 		case ">":
-			if analyse.IsSintTypeAndSon(expr.Left.GetType()) {
+			if analyse.IsSintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntSGT, left, right, "")
-			} else if analyse.IsUintTypeAndSon(expr.Left.GetType()) {
+			} else if analyse.IsUintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntUGT, left, right, "")
 			} else {
 				v = self.builder.CreateFCmp(llvm.FloatOGT, left, right, "")
 			}
 		case ">=":
-			if analyse.IsSintTypeAndSon(expr.Left.GetType()) {
+			if analyse.IsSintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntSGE, left, right, "")
-			} else if analyse.IsUintTypeAndSon(expr.Left.GetType()) {
+			} else if analyse.IsUintTypeAndSon(t) {
 				v = self.builder.CreateICmp(llvm.IntUGE, left, right, "")
 			} else {
 				v = self.builder.CreateFCmp(llvm.FloatOGE, left, right, "")
@@ -220,16 +246,20 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 		default:
 			panic(fmt.Sprintf("unknown equal: %+v", expr))
 		}
+		if v.Type().TypeKind() == llvm.VectorTypeKind {
+			return self.builder.CreateZExt(v, llvm.VectorType(t_bool, v.Type().VectorSize()), "")
+		}
 		return self.builder.CreateIntCast(v, t_bool, "")
 	case *analyse.Unary:
 		switch expr.Opera {
 		case "!":
 			left := self.codegenExpr(expr.Value, true)
-			return self.builder.CreateXor(left, llvm.ConstInt(left.Type(), 1, true), "")
+			return self.builder.CreateXor(left, self.constInt(left.Type(), 1, true), "")
 		case "&":
-			return self.codegenExpr(expr.Value, false)
+			return self.codegenAddr(expr.Value)
 		case "*":
 			value := self.codegenExpr(expr.Value, true)
+			self.checkNull(value, expr.Pos)
 			if getValue {
 				value = self.builder.CreateLoad(value.Type().ElementType(), value, "")
 			}
@@ -242,20 +272,26 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 		switch {
 		case analyse.IsArrayTypeAndSon(fromType):
 			from, index := self.codegenExpr(expr.From, false), self.codegenExpr(expr.Index, true)
+			self.checkIndex(index, int(analyse.GetBaseType(fromType).(*analyse.TypeArray).Size), expr.Pos)
+			return self.createArrayIndex(from, index, getValue)
+		case analyse.IsVecTypeAndSon(fromType):
+			from, index := self.codegenExpr(expr.From, false), self.codegenExpr(expr.Index, true)
+			self.checkIndex(index, int(analyse.GetBaseType(fromType).(*analyse.TypeVec).Size), expr.Pos)
 			return self.createArrayIndex(from, index, getValue)
 		case analyse.IsPtrTypeAndSon(fromType):
 			from, index := self.codegenExpr(expr.From, true), self.codegenExpr(expr.Index, true)
+			self.checkNull(from, expr.Pos)
 			return self.createPointerIndex(from, index, getValue)
 		case analyse.IsTupleTypeAndSon(fromType):
 			from := self.codegenExpr(expr.From, false)
-			index := expr.Index.(*analyse.Integer).Value
+			index := expr.Index.(*analyse.Integer).Value.Uint64()
 			return self.createStructIndex(from, uint(index), getValue)
 		default:
 			panic("")
 		}
 	case *analyse.Select:
 		cond := self.builder.CreateIntCast(self.codegenExpr(expr.Cond, true), self.ctx.Int1Type(), "")
-		tb, fb, eb := llvm.AddBasicBlock(self.function, ""), llvm.AddBasicBlock(self.function, ""), llvm.AddBasicBlock(self.function, "")
+		tb, fb, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
 		self.builder.CreateCondBr(cond, tb, fb)
 
 		self.builder.SetInsertPointAtEnd(tb)
@@ -282,7 +318,7 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 		if isConst {
 			return llvm.ConstArray(self.codegenType(expr.Type), elems)
 		} else {
-			tmp := self.builder.CreateAlloca(self.codegenType(expr.Type), "")
+			tmp := self.createAlloca(self.codegenType(expr.Type))
 			for i, e := range elems {
 				index := self.createArrayIndex(tmp, llvm.ConstInt(t_size, uint64(i), false), false)
 				self.builder.CreateStore(e, index)
@@ -299,12 +335,11 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 			}
 		}
 		if isConst {
-			return self.ctx.ConstStruct(elems, false)
+			return self.constStruct(self.codegenType(expr.Type), elems)
 		} else {
-			tmp := self.builder.CreateAlloca(self.codegenType(expr.Type), "")
+			tmp := self.createAlloca(self.codegenType(expr.Type))
 			for i, e := range elems {
-				index := self.createStructIndex(tmp, uint(i), false)
-				self.builder.CreateStore(e, index)
+				self.storeStructIndex(tmp, uint(i), e)
 			}
 			return self.builder.CreateLoad(tmp.Type().ElementType(), tmp, "")
 		}
@@ -318,34 +353,54 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 			}
 		}
 		if isConst {
-			return self.ctx.ConstStruct(elems, false)
+			return self.constStruct(self.codegenType(expr.Type), elems)
 		} else {
-			tmp := self.builder.CreateAlloca(self.codegenType(expr.Type), "")
+			tmp := self.createAlloca(self.codegenType(expr.Type))
 			for i, e := range elems {
-				index := self.createStructIndex(tmp, uint(i), false)
-				self.builder.CreateStore(e, index)
+				self.storeStructIndex(tmp, uint(i), e)
 			}
 			return self.builder.CreateLoad(tmp.Type().ElementType(), tmp, "")
 		}
 	case *analyse.GetField:
 		f := self.codegenExpr(expr.From, false)
-		var index uint
-		for iter := analyse.GetBaseType(expr.From.GetType()).(*analyse.TypeStruct).Fields.Begin(); iter.HasValue(); iter.Next() {
-			if iter.Key() == expr.Index {
-				break
-			}
-			index++
-		}
-		return self.createStructIndex(f, index, getValue)
+		return self.createStructIndex(f, self.getFieldIndex(expr), getValue || expr.IsBitField())
 	case *analyse.Covert:
 		from := self.codegenExpr(expr.From, true)
 		meanFt, meanTo := expr.From.GetType(), expr.To
 		to := self.codegenType(expr.GetType())
-		switch {
-		case analyse.GetDepthBaseType(meanFt).Equal(analyse.GetDepthBaseType(meanTo)):
+		if analyse.GetDepthBaseType(meanFt).Equal(analyse.GetDepthBaseType(meanTo)) {
 			return from
-		case analyse.IsIntTypeAndSon(meanFt) && analyse.IsIntTypeAndSon(meanTo):
-			return self.builder.CreateIntCast(from, to, "")
+		}
+		switch {
+		case analyse.IsVecTypeAndSon(meanTo) && !analyse.IsVecTypeAndSon(meanFt):
+			if analyse.IsArrayTypeAndSon(meanFt) {
+				v := llvm.Undef(to)
+				for i := 0; i < to.VectorSize(); i++ {
+					elem := self.builder.CreateExtractValue(from, i, "")
+					v = self.builder.CreateInsertElement(v, elem, llvm.ConstInt(self.ctx.Int32Type(), uint64(i), false), "")
+				}
+				return v
+			}
+			return self.createSplat(from, to)
+		case analyse.IsVecTypeAndSon(meanFt) && analyse.IsArrayTypeAndSon(meanTo):
+			v := llvm.Undef(to)
+			for i := 0; i < to.ArrayLength(); i++ {
+				elem := self.builder.CreateExtractElement(from, llvm.ConstInt(self.ctx.Int32Type(), uint64(i), false), "")
+				v = self.builder.CreateInsertValue(v, elem, i, "")
+			}
+			return v
+		}
+		// 向量逐元素转换
+		meanFt, meanTo = analyse.GetScalarType(meanFt), analyse.GetScalarType(meanTo)
+		switch {
+		case (analyse.IsIntTypeAndSon(meanFt) || analyse.IsBoolTypeAndSon(meanFt)) && analyse.IsIntTypeAndSon(meanTo):
+			if scalarType(from.Type()).IntTypeWidth() >= scalarType(to).IntTypeWidth() {
+				return self.builder.CreateIntCast(from, to, "")
+			} else if analyse.IsSintTypeAndSon(meanFt) {
+				return self.builder.CreateSExt(from, to, "")
+			} else {
+				return self.builder.CreateZExt(from, to, "")
+			}
 		case analyse.IsFloatTypeAndSon(meanFt) && analyse.IsFloatTypeAndSon(meanTo):
 			return self.builder.CreateFPCast(from, to, "")
 		case analyse.IsSintTypeAndSon(meanFt) && analyse.IsFloatTypeAndSon(meanTo):
@@ -373,19 +428,245 @@ func (self *CodeGenerator) codegenExpr(mean analyse.Expr, getValue bool) llvm.Va
 		return v
 	case *analyse.GetTypeBytes:
 		return llvm.SizeOf(self.codegenType(expr.Type))
+	case *analyse.FormatPieces:
+		for _, t := range expr.Temps {
+			self.codegenVariable(t)
+		}
+		if len(expr.Pieces) == 0 {
+			return llvm.ConstPointerNull(self.codegenType(expr.Type))
+		}
+		elemType := self.codegenType(analyse.GetBaseType(expr.Type).(*analyse.TypePtr).Elem)
+		array := self.createAlloca(llvm.ArrayType(elemType, len(expr.Pieces)))
+		for i, p := range expr.Pieces {
+			self.builder.CreateStore(self.codegenExpr(p, true), self.createArrayIndex(array, llvm.ConstInt(t_size, uint64(i), false), false))
+		}
+		return self.createArrayIndex(array, llvm.ConstInt(t_size, 0, false), false)
+	case *analyse.Move:
+		return self.codegenMove(expr)
+	case *analyse.Drop:
+		if v, ok := expr.Value.(*analyse.Variable); ok {
+			self.dropVariable(v)
+			return llvm.Value{}
+		}
+		var ptr llvm.Value
+		if expr.Value.IsTemporary() {
+			value := self.codegenExpr(expr.Value, true)
+			ptr = self.createAlloca(value.Type())
+			self.builder.CreateStore(value, ptr)
+		} else {
+			ptr = self.codegenExpr(expr.Value, false)
+		}
+		self.createDrop(ptr, expr.Value.GetType())
+		return llvm.Value{}
+	case *analyse.Panic:
+		self.codegenPanic(expr)
+		if expr.Cond == nil {
+			// 之后的代码不可达
+			self.builder.SetInsertPointAtEnd(self.ctx.AddBasicBlock(self.function, ""))
+		}
+		return llvm.Value{}
+	case *analyse.Try:
+		return self.codegenTry(expr)
+	case *analyse.Hash:
+		self.codegenVariable(expr.Temp)
+		values := make([]llvm.Value, len(expr.Values))
+		for i, v := range expr.Values {
+			values[i] = self.codegenExpr(v, true)
+		}
+		return self.createHash(values)
+	case *analyse.OverloadAssign:
+		self.codegenVariable(expr.Temp)
+		return self.codegenExpr(expr.Assign, true)
+	case *analyse.Atomic:
+		return self.codegenAtomic(expr)
+	case *analyse.Asm:
+		self.codegenAsm(expr)
+		return llvm.Value{}
+	case *analyse.Vector:
+		return self.codegenVector(expr)
+	case *analyse.Shuffle:
+		return self.codegenShuffle(expr)
+	case *analyse.Reduce:
+		return self.codegenReduce(expr)
+	case *analyse.Volatile:
+		ptr := self.codegenExpr(expr.Ptr, true)
+		if expr.Value != nil {
+			self.builder.CreateStore(self.codegenExpr(expr.Value, true), ptr).SetVolatile(true)
+			return llvm.Value{}
+		}
+		v := self.builder.CreateLoad(self.codegenType(expr.GetType()), ptr, "")
+		v.SetVolatile(true)
+		return v
 	default:
 		panic("")
 	}
 }
 
+// 内联汇编，寄存器输出作为返回值，内存操作数传递地址，读写操作数额外传入绑定到输出的当前值
+func (self *CodeGenerator) codegenAsm(mean *analyse.Asm) {
+	var constraints []string
+	var args, outPtrs []llvm.Value
+	var argTypes, retTypes []llvm.Type
+	var tiedConstraints []string
+	var tiedArgs []llvm.Value
+	var indirects []int // 内存操作数的参数下标
+	for i, o := range mean.Outputs {
+		ptr := self.codegenExpr(o.Value, false)
+		readWrite := o.Constraint[0] == '+'
+		c := o.Constraint[1:]
+		if o.IsMemory() {
+			constraints = append(constraints, "=*"+c)
+			indirects = append(indirects, len(args))
+			args, argTypes = append(args, ptr), append(argTypes, ptr.Type())
+			if readWrite {
+				tiedConstraints, tiedArgs = append(tiedConstraints, "*"+strings.TrimLeft(c, "&")), append(tiedArgs, ptr)
+			}
+			continue
+		}
+		constraints = append(constraints, "="+convertAsmConstraint(c))
+		outPtrs, retTypes = append(outPtrs, ptr), append(retTypes, ptr.Type().ElementType())
+		if readWrite {
+			tiedConstraints = append(tiedConstraints, strconv.Itoa(i))
+			tiedArgs = append(tiedArgs, self.builder.CreateLoad(ptr.Type().ElementType(), ptr, ""))
+		}
+	}
+	for _, in := range mean.Inputs {
+		if in.IsMemory() {
+			constraints = append(constraints, "*"+in.Constraint)
+			ptr := self.codegenExpr(in.Value, false)
+			indirects = append(indirects, len(args))
+			args, argTypes = append(args, ptr), append(argTypes, ptr.Type())
+			continue
+		}
+		constraints = append(constraints, convertAsmConstraint(in.Constraint))
+		v := self.codegenExpr(in.Value, true)
+		args, argTypes = append(args, v), append(argTypes, v.Type())
+	}
+	constraints = append(constraints, tiedConstraints...)
+	for i, v := range tiedArgs {
+		if tiedConstraints[i][0] == '*' {
+			indirects = append(indirects, len(args))
+		}
+		args, argTypes = append(args, v), append(argTypes, v.Type())
+	}
+	for _, c := range mean.Clobbers {
+		constraints = append(constraints, "~{"+c+"}")
+	}
+
+	var retType llvm.Type
+	switch len(retTypes) {
+	case 0:
+		retType = self.ctx.VoidType()
+	case 1:
+		retType = retTypes[0]
+	default:
+		retType = self.ctx.StructType(retTypes, false)
+	}
+	ft := llvm.FunctionType(retType, argTypes, false)
+	dialect := stlutil.Ternary(mean.Intel, llvm.InlineAsmDialectIntel, llvm.InlineAsmDialectATT)
+	template := convertAsmTemplate(mean.Template, len(mean.Outputs)+len(mean.Inputs) != 0)
+	asm := llvm.InlineAsm(ft, template, strings.Join(constraints, ","), true, false, dialect, false)
+	ret := self.builder.CreateCall(ft, asm, args, "")
+	// 内存操作数需要标注指向的类型，属性下标从1开始
+	elemKind := llvm.AttributeKindID("elementtype")
+	for _, i := range indirects {
+		ret.AddCallSiteAttribute(i+1, self.ctx.CreateTypeAttribute(elemKind, argTypes[i].ElementType()))
+	}
+	if len(outPtrs) == 1 {
+		self.builder.CreateStore(ret, outPtrs[0])
+	} else {
+		for i, ptr := range outPtrs {
+			self.builder.CreateStore(self.builder.CreateExtractValue(ret, i, ""), ptr)
+		}
+	}
+}
+
+// x86中指定寄存器的约束，与clang一样转换为llvm的{reg}
+var asmRegisterConstraints = map[string]string{
+	"a": "{ax}",
+	"b": "{bx}",
+	"c": "{cx}",
+	"d": "{dx}",
+	"S": "{si}",
+	"D": "{di}",
+}
+
+// 将约束转换为llvm的格式
+func convertAsmConstraint(c string) string {
+	prefix := c[:len(c)-len(strings.TrimLeft(c, "&"))]
+	if reg, ok := asmRegisterConstraints[c[len(prefix):]]; ok {
+		return prefix + reg
+	}
+	return c
+}
+
+// 将模板转换为llvm的格式，%n转换为${n}，%xn转换为${n:x}，%%转换为%，$转换为$$
+func convertAsmTemplate(s string, hasOperands bool) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			buf.WriteString("$$")
+		case s[i] == '%' && hasOperands:
+			i++
+			if s[i] == '%' {
+				buf.WriteByte('%')
+				continue
+			}
+			var modifier string
+			if s[i] < '0' || s[i] > '9' {
+				modifier = ":" + string(s[i])
+				i++
+			}
+			begin := i
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+			buf.WriteString("${" + s[begin:i] + modifier + "}")
+			i--
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String()
+}
+
+// 原子操作
+func (self *CodeGenerator) codegenAtomic(mean *analyse.Atomic) llvm.Value {
+	ptr := self.codegenExpr(mean.Ptr, true)
+	order := atomicOrderings[mean.Order]
+	switch mean.Op {
+	case analyse.AtomicLoad:
+		v := self.builder.CreateLoad(self.codegenType(mean.GetType()), ptr, "")
+		v.SetOrdering(order)
+		return v
+	case analyse.AtomicStore:
+		self.builder.CreateStore(self.codegenExpr(mean.Value, true), ptr).SetOrdering(order)
+		return llvm.Value{}
+	case analyse.AtomicCas:
+		old, value := self.codegenExpr(mean.Value, true), self.codegenExpr(mean.New, true)
+		cas := self.builder.CreateAtomicCmpXchg(ptr, old, value, order, atomicOrderings[mean.FailOrder], false)
+		return self.builder.CreateZExt(self.builder.CreateExtractValue(cas, 1, ""), t_bool, "")
+	default:
+		op := stlutil.Ternary(mean.Op == analyse.AtomicFetchAdd, llvm.AtomicRMWBinOpAdd, llvm.AtomicRMWBinOpSub)
+		return self.builder.CreateAtomicRMW(op, ptr, self.codegenExpr(mean.Value, true), order, false)
+	}
+}
+
 // 常量表达式
 func (self *CodeGenerator) codegenConstantExpr(mean analyse.Expr) llvm.Value {
 	switch expr := mean.(type) {
 	case *analyse.Null:
 		return llvm.ConstPointerNull(self.codegenType(expr.Type))
 	case *analyse.Integer:
-		value := *(*uint64)(unsafe.Pointer(&expr.Value))
-		return llvm.ConstInt(self.codegenType(expr.Type), value, analyse.IsSintType(expr.Type))
+		t := self.codegenType(expr.Type)
+		if expr.Value.IsInt64() {
+			return llvm.ConstInt(t, uint64(expr.Value.Int64()), true)
+		} else if expr.Value.IsUint64() {
+			return llvm.ConstInt(t, expr.Value.Uint64(), false)
+		}
+		// 超出64位的128位整数
+		return llvm.ConstIntFromString(t, expr.Value.String(), 10)
 	case *analyse.Float:
 		return llvm.ConstFloat(self.codegenType(expr.Type), expr.Value)
 	case *analyse.Boolean:
@@ -398,30 +679,44 @@ func (self *CodeGenerator) codegenConstantExpr(mean analyse.Expr) llvm.Value {
 			elems[i] = self.codegenConstantExpr(e)
 		}
 		return llvm.ConstArray(self.codegenType(expr.Type), elems)
+	case *analyse.Vector:
+		elems := make([]llvm.Value, len(expr.Elems))
+		for i, e := range expr.Elems {
+			elems[i] = self.codegenConstantExpr(e)
+		}
+		return llvm.ConstVector(elems, false)
 	case *analyse.Tuple:
 		elems := make([]llvm.Value, len(expr.Elems))
 		for i, e := range expr.Elems {
 			elems[i] = self.codegenConstantExpr(e)
 		}
-		return self.ctx.ConstStruct(elems, false)
+		return self.constStruct(self.codegenType(expr.Type), elems)
 	case *analyse.Struct:
 		elems := make([]llvm.Value, len(expr.Fields))
 		for i, e := range expr.Fields {
 			elems[i] = self.codegenConstantExpr(e)
 		}
-		return self.ctx.ConstStruct(elems, false)
+		return self.constStruct(self.codegenType(expr.Type), elems)
 	case *analyse.String:
+		data := self.constStringData(expr.Value)
+		t := self.codegenType(expr.GetType())
+		if t.TypeKind() == llvm.StructTypeKind {
+			// 标准库字符串 {data, len, ...}
+			fields := t.StructElementTypes()
+			elems := make([]llvm.Value, len(fields))
+			for i, ft := range fields {
+				elems[i] = llvm.ConstNull(ft)
+			}
+			elems[0] = llvm.ConstPointerCast(data, fields[0])
+			elems[1] = llvm.ConstInt(fields[1], uint64(len(expr.Value)), false)
+			return self.constStruct(t, elems)
+		}
 		v, ok := self.cstringPool[expr.Value]
 		if !ok {
-			init := llvm.ConstString(expr.Value, true)
-			vv := llvm.AddGlobal(self.module, init.Type(), "")
-			vv.SetGlobalConstant(true)
-			vv.SetLinkage(llvm.PrivateLinkage)
-			vv.SetInitializer(init)
-			v = llvm.AddGlobal(self.module, self.codegenType(expr.GetType()), "")
+			v = llvm.AddGlobal(self.module, t, "")
 			v.SetGlobalConstant(true)
 			v.SetLinkage(llvm.PrivateLinkage)
-			v.SetInitializer(llvm.ConstPointerCast(vv, v.Type().ElementType()))
+			v.SetInitializer(llvm.ConstPointerCast(data, t))
 			self.cstringPool[expr.Value] = v
 		}
 		return self.builder.CreateLoad(v.Type().ElementType(), v, "")
@@ -430,25 +725,46 @@ func (self *CodeGenerator) codegenConstantExpr(mean analyse.Expr) llvm.Value {
 	}
 }
 
+// 字符串常量的数据（以\0结尾）
+func (self *CodeGenerator) constStringData(s string) llvm.Value {
+	if v, ok := self.stringPool[s]; ok {
+		return v
+	}
+	init := self.ctx.ConstString(s, true)
+	v := llvm.AddGlobal(self.module, init.Type(), "")
+	v.SetGlobalConstant(true)
+	v.SetLinkage(llvm.PrivateLinkage)
+	v.SetUnnamedAddr(true)
+	v.SetInitializer(init)
+	self.stringPool[s] = v
+	return v
+}
+
 // 比较
 func (self *CodeGenerator) equal(left, right llvm.Value) llvm.Value {
 	switch left.Type().TypeKind() {
 	case llvm.IntegerTypeKind, llvm.PointerTypeKind, llvm.FunctionTypeKind:
 		return self.builder.CreateICmp(llvm.IntEQ, left, right, "")
-	case llvm.FloatTypeKind:
+	case llvm.FloatTypeKind, llvm.DoubleTypeKind:
+		return self.builder.CreateFCmp(llvm.FloatOEQ, left, right, "")
+	case llvm.VectorTypeKind:
+		// 逐元素比较
+		if left.Type().ElementType().TypeKind() == llvm.IntegerTypeKind {
+			return self.builder.CreateICmp(llvm.IntEQ, left, right, "")
+		}
 		return self.builder.CreateFCmp(llvm.FloatOEQ, left, right, "")
 	case llvm.ArrayTypeKind:
 		if left.Type().ArrayLength() == 0 {
 			return llvm.ConstInt(self.ctx.Int8Type(), 1, true)
 		}
-		i := self.builder.CreateAlloca(self.codegenType(analyse.Usize), "")
+		i := self.createAlloca(self.codegenType(analyse.Usize))
 		self.builder.CreateStore(llvm.ConstInt(i.Type().ElementType(), 0, false), i)
-		cb := llvm.AddBasicBlock(self.function, "")
+		cb := self.ctx.AddBasicBlock(self.function, "")
 		self.builder.CreateBr(cb)
 
 		self.builder.SetInsertPointAtEnd(cb)
 		iv := self.builder.CreateLoad(i.Type().ElementType(), i, "")
-		lb, eb := llvm.AddBasicBlock(self.function, ""), llvm.AddBasicBlock(self.function, "")
+		lb, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
 		lt := self.builder.CreateICmp(llvm.IntULT, iv, llvm.ConstInt(iv.Type(), uint64(left.Type().ArrayLength()), false), "")
 		self.builder.CreateCondBr(lt, lb, eb)
 
@@ -464,18 +780,23 @@ func (self *CodeGenerator) equal(left, right llvm.Value) llvm.Value {
 		return phi
 	case llvm.StructTypeKind:
 		elemCount := left.Type().StructElementTypesCount()
+		if layout := self.layouts[left.Type()]; layout != nil && layout.Union {
+			return self.equalBytes(left, right, layout.Size)
+		} else if layout != nil {
+			elemCount = len(layout.Fields)
+		}
 		if elemCount == 0 {
 			return llvm.ConstInt(self.ctx.Int8Type(), 1, true)
 		}
 		blocks := make([]llvm.BasicBlock, elemCount)
 		values := make([]llvm.Value, elemCount)
-		eb := llvm.AddBasicBlock(self.function, "")
-		for i := range left.Type().StructElementTypes() {
+		eb := self.ctx.AddBasicBlock(self.function, "")
+		for i := 0; i < elemCount; i++ {
 			l, r := self.createStructIndex(left, uint(i), true), self.createStructIndex(right, uint(i), true)
 			v := self.equal(l, r)
 			blocks[i], values[i] = self.builder.GetInsertBlock(), v
 			if i < elemCount-1 {
-				nb := llvm.AddBasicBlock(self.function, "")
+				nb := self.ctx.AddBasicBlock(self.function, "")
 				self.builder.CreateCondBr(v, nb, eb)
 				self.builder.SetInsertPointAtEnd(nb)
 			} else {
@@ -490,3 +811,78 @@ func (self *CodeGenerator) equal(left, right llvm.Value) llvm.Value {
 		panic("")
 	}
 }
+
+// 常量结构体
+func (self *CodeGenerator) constStruct(t llvm.Type, elems []llvm.Value) llvm.Value {
+	if _, ok := self.layouts[t]; ok {
+		return self.constLayoutStruct(t, elems)
+	}
+	// 类型定义是匿名的命名结构体，常量必须使用同一个类型
+	return llvm.ConstNamedStruct(t, elems)
+}
+
+// 获取成员下标
+func (self *CodeGenerator) getFieldIndex(mean *analyse.GetField) uint {
+	return getFieldIndexByName(mean.From.GetType(), mean.Index)
+}
+
+// 方法调用的函数和参数，接收者为第一个参数
+func (self *CodeGenerator) codegenMethodCallArgs(expr *analyse.MethodCall) (llvm.Value, []llvm.Value) {
+	f := self.codegenExpr(expr.Method.Func, true)
+	args := make([]llvm.Value, len(expr.Args)+1)
+	if expr.Method.Func.Receiver == analyse.ReceiverValue || analyse.IsPtrType(expr.Method.Self.GetType()) {
+		args[0] = self.codegenExpr(expr.Method.Self, true)
+	} else if isTemporaryOwner(expr.Method.Self) {
+		// 方法修改的是语句结束时析构的临时值本身
+		args[0] = self.codegenExpr(expr.Method.Self, false)
+	} else if field, ok := expr.Method.Self.(*analyse.GetField); expr.Method.Self.GetMut() && !(ok && field.IsBitField()) {
+		args[0] = self.codegenExpr(expr.Method.Self, false)
+	} else {
+		selfArg := self.codegenExpr(expr.Method.Self, true)
+		args[0] = self.createAlloca(selfArg.Type())
+		self.builder.CreateStore(selfArg, args[0])
+	}
+	for i, a := range expr.Args {
+		args[i+1] = self.codegenExpr(a, true)
+	}
+	return f, args
+}
+
+// 移出值，变量离开作用域时不再析构，临时值不再在语句结束时析构
+func (self *CodeGenerator) codegenMove(mean *analyse.Move) llvm.Value {
+	if v, ok := mean.Value.(*analyse.Variable); ok {
+		value := self.codegenExpr(v, true)
+		self.moveVariable(v)
+		return value
+	} else if mean.Value.IsTemporary() {
+		return self.codegenOwnedExpr(mean.Value, true)
+	}
+	// 移出后原位置置为零值，之后析构零值不会释放任何资源
+	ptr := self.codegenExpr(mean.Value, false)
+	value := self.builder.CreateLoad(ptr.Type().ElementType(), ptr, "")
+	self.builder.CreateStore(llvm.ConstNull(value.Type()), ptr)
+	return value
+}
+
+// 取地址，语句结束时析构的临时值直接使用栈上的位置，其他临时值先复制到栈上
+func (self *CodeGenerator) codegenAddr(mean analyse.Expr) llvm.Value {
+	if !mean.IsTemporary() || isTemporaryOwner(mean) {
+		return self.codegenExpr(mean, false)
+	}
+	v := self.codegenExpr(mean, true)
+	ptr := self.createAlloca(v.Type())
+	self.builder.CreateStore(v, ptr)
+	return ptr
+}
+
+// 按名字获取结构体成员的下标
+func getFieldIndexByName(t analyse.Type, name string) uint {
+	var index uint
+	for iter := analyse.GetBaseType(t).(*analyse.TypeStruct).Fields.Begin(); iter.HasValue(); iter.Next() {
+		if iter.Key() == name {
+			break
+		}
+		index++
+	}
+	return index
+}
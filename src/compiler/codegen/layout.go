@@ -0,0 +1,336 @@
+package codegen
+
+import (
+	"github.com/kkkunny/Sim/src/compiler/analyse"
+	"github.com/kkkunny/Sim/src/compiler/utils"
+	"github.com/kkkunny/go-llvm"
+)
+
+// 成员布局
+type fieldLayout struct {
+	Type      llvm.Type // 成员类型
+	Index     int       // 在llvm结构体中的下标（位域为其存储单元的下标）
+	Offset    uint64    // 字节偏移
+	BitOffset uint64    // 位域相对于Offset的位偏移
+	BitWidth  uint64    // 位域宽度，0表示不是位域
+	Signed    bool      // 位域是否有符号
+}
+
+// 非自然排列的类型布局（联合体、紧凑排列、指定对齐、位域、128位整数以及包含它们的类型）
+// 对应的llvm类型是带有显式填充的packed结构体，对齐由布局单独记录
+type typeLayout struct {
+	Union    bool
+	Size     uint64
+	Align    uint64
+	Fields   []fieldLayout
+	Storages []int  // 位域存储单元在llvm结构体中的下标
+	Padding  []bool // llvm结构体中的元素是否是填充
+}
+
+// 是否需要自定义布局
+func needLayout(t analyse.Type) bool {
+	switch typ := t.(type) {
+	case *analyse.TypeStruct:
+		if typ.HasCustomLayout() {
+			return true
+		}
+		for iter := typ.Fields.Begin(); iter.HasValue(); iter.Next() {
+			if needLayout(iter.Value().Second) {
+				return true
+			}
+		}
+		return false
+	case *analyse.TypeTuple:
+		for _, e := range typ.Elems {
+			if needLayout(e) {
+				return true
+			}
+		}
+		return false
+	case *analyse.TypeArray:
+		return needLayout(typ.Elem)
+	case *analyse.Typedef:
+		return needLayout(typ.Dst)
+	default:
+		// llvm 14的数据布局中128位整数按8字节对齐，而System V要求16字节
+		return t == analyse.I128 || t == analyse.U128
+	}
+}
+
+// 类型对齐
+func (self *CodeGenerator) typeAlign(t llvm.Type) uint64 {
+	if layout, ok := self.layouts[t]; ok {
+		return layout.Align
+	} else if t.TypeKind() == llvm.ArrayTypeKind {
+		return self.typeAlign(t.ElementType())
+	} else if t.TypeKind() == llvm.IntegerTypeKind && t.IntTypeWidth() == 128 {
+		return 16
+	}
+	return uint64(self.target.ABITypeAlignment(t))
+}
+
+// 获取类型（或指针指向的类型）的布局
+func (self *CodeGenerator) getLayout(t llvm.Type) *typeLayout {
+	if t.TypeKind() == llvm.PointerTypeKind {
+		t = t.ElementType()
+	}
+	return self.layouts[t]
+}
+
+// 自定义布局类型
+func (self *CodeGenerator) codegenLayoutType(key string, mean analyse.Type) llvm.Type {
+	if t, ok := self.types[key]; ok {
+		return t
+	}
+	td := self.ctx.StructCreateNamed("")
+	self.types[key] = td
+	self.setLayoutBody(td, mean)
+	return td
+}
+
+// 计算布局并设置结构体内容
+func (self *CodeGenerator) setLayoutBody(td llvm.Type, mean analyse.Type) {
+	var elems []analyse.Type
+	var bits []uint
+	var union, packed bool
+	var align uint64
+	switch typ := analyse.GetBaseType(mean).(type) {
+	case *analyse.TypeTuple:
+		elems, bits = typ.Elems, make([]uint, len(typ.Elems))
+	case *analyse.TypeStruct:
+		for iter := typ.Fields.Begin(); iter.HasValue(); iter.Next() {
+			elems = append(elems, iter.Value().Second)
+			bits = append(bits, typ.GetBits(iter.Index()))
+		}
+		union, packed, align = typ.Union, typ.Packed, uint64(typ.Align)
+	default:
+		panic("")
+	}
+
+	// 计算成员偏移
+	layout := &typeLayout{Union: union, Align: 1, Fields: make([]fieldLayout, len(elems))}
+	var bitPos uint64 // 下一个成员可以开始的位置（位）
+	for i, e := range elems {
+		f := fieldLayout{Type: self.codegenType(e)}
+		size := self.target.TypeAllocSize(f.Type)
+		fieldAlign := uint64(1)
+		if !packed {
+			fieldAlign = self.typeAlign(f.Type)
+		}
+		layout.Align = utils.Max(layout.Align, fieldAlign)
+
+		if bits[i] == 0 {
+			if !union {
+				f.Offset = utils.AlignTo((bitPos+7)/8, fieldAlign)
+				bitPos = (f.Offset + size) * 8
+			}
+			layout.Size = utils.Max(layout.Size, f.Offset+size)
+		} else {
+			f.BitWidth, f.Signed = uint64(bits[i]), analyse.IsSintTypeAndSon(e)
+			var bitOffset uint64
+			if !union {
+				// 位域不能跨越其类型大小的存储单元
+				unit := size * 8
+				if !packed && bitPos/unit != (bitPos+f.BitWidth-1)/unit {
+					bitPos = utils.AlignTo(bitPos, unit)
+				}
+				bitOffset = bitPos
+				bitPos += f.BitWidth
+			}
+			f.Offset, f.BitOffset = bitOffset/8, bitOffset%8
+			layout.Size = utils.Max(layout.Size, (bitOffset+f.BitWidth+7)/8)
+		}
+		layout.Fields[i] = f
+	}
+	if align != 0 {
+		if packed {
+			layout.Align = align
+		} else {
+			layout.Align = utils.Max(layout.Align, align)
+		}
+	}
+	layout.Size = utils.AlignTo(layout.Size, layout.Align)
+
+	// 生成带填充的结构体
+	var body []llvm.Type
+	var pos uint64 // body已覆盖的字节数
+	pad := func(to uint64) {
+		if to > pos {
+			body = append(body, llvm.ArrayType(self.ctx.Int8Type(), int(to-pos)))
+			layout.Padding = append(layout.Padding, true)
+			pos = to
+		}
+	}
+	if union {
+		// 联合体以第一个成员表示，以便常量初始化
+		if len(layout.Fields) > 0 && layout.Fields[0].BitWidth == 0 {
+			body = append(body, layout.Fields[0].Type)
+			layout.Padding = append(layout.Padding, false)
+			pos = self.target.TypeAllocSize(layout.Fields[0].Type)
+		} else if len(layout.Fields) > 0 {
+			layout.Storages = append(layout.Storages, 0)
+			body = append(body, llvm.ArrayType(self.ctx.Int8Type(), int(layout.Size)))
+			layout.Padding = append(layout.Padding, false)
+			pos = layout.Size
+		}
+	} else {
+		storage := -1 // 当前位域存储单元的下标
+		var storageBegin uint64
+		flush := func() {
+			if storage >= 0 {
+				body[storage] = llvm.ArrayType(self.ctx.Int8Type(), int(pos-storageBegin))
+				storage = -1
+			}
+		}
+		for i := range layout.Fields {
+			f := &layout.Fields[i]
+			if f.BitWidth == 0 {
+				flush()
+				pad(f.Offset)
+				f.Index = len(body)
+				body = append(body, f.Type)
+				layout.Padding = append(layout.Padding, false)
+				pos = f.Offset + self.target.TypeAllocSize(f.Type)
+				continue
+			}
+			if storage < 0 || f.Offset > pos {
+				flush()
+				pad(f.Offset)
+				storage, storageBegin = len(body), f.Offset
+				layout.Storages = append(layout.Storages, storage)
+				body = append(body, llvm.Type{})
+				layout.Padding = append(layout.Padding, false)
+			}
+			f.Index = storage
+			pos = utils.Max(pos, (f.Offset*8+f.BitOffset+f.BitWidth+7)/8)
+		}
+		flush()
+	}
+	pad(layout.Size)
+
+	td.StructSetBody(body, true)
+	self.layouts[td] = layout
+}
+
+// 成员访问的对齐
+func (self *CodeGenerator) fieldAlign(layout *typeLayout, f fieldLayout) int {
+	align := layout.Align
+	for align > 1 && f.Offset%align != 0 {
+		align /= 2
+	}
+	return int(utils.Min(align, self.typeAlign(f.Type)))
+}
+
+// 自定义布局类型的成员
+func (self *CodeGenerator) createLayoutIndex(v llvm.Value, layout *typeLayout, i uint, getValue bool) llvm.Value {
+	if v.Type().TypeKind() != llvm.PointerTypeKind {
+		ptr := self.createAlloca(v.Type())
+		self.builder.CreateStore(v, ptr)
+		v = ptr
+	}
+	f := layout.Fields[i]
+	if f.BitWidth != 0 {
+		if !getValue {
+			panic("can not get the address of a bit-field")
+		}
+		return self.loadBitField(v, f)
+	}
+
+	var ptr llvm.Value
+	if layout.Union {
+		ptr = self.builder.CreatePointerCast(v, llvm.PointerType(f.Type, 0), "")
+	} else {
+		ptr = self.builder.CreateStructGEP(v.Type().ElementType(), v, f.Index, "")
+	}
+	if !getValue {
+		return ptr
+	}
+	value := self.builder.CreateLoad(f.Type, ptr, "")
+	value.SetAlignment(self.fieldAlign(layout, f))
+	return value
+}
+
+// 位域所在存储的指针
+func (self *CodeGenerator) bitFieldStorage(ptr llvm.Value, f fieldLayout) (llvm.Value, llvm.Type) {
+	storage := self.ctx.IntType(int((f.BitOffset + f.BitWidth + 7) / 8 * 8))
+	p := self.builder.CreatePointerCast(ptr, llvm.PointerType(self.ctx.Int8Type(), 0), "")
+	p = self.builder.CreateInBoundsGEP(self.ctx.Int8Type(), p, []llvm.Value{llvm.ConstInt(t_size, f.Offset, false)}, "")
+	return self.builder.CreatePointerCast(p, llvm.PointerType(storage, 0), ""), storage
+}
+
+// 读取位域
+func (self *CodeGenerator) loadBitField(ptr llvm.Value, f fieldLayout) llvm.Value {
+	p, storage := self.bitFieldStorage(ptr, f)
+	v := self.builder.CreateLoad(storage, p, "")
+	v.SetAlignment(1)
+	v = self.builder.CreateLShr(v, llvm.ConstInt(storage, f.BitOffset, false), "")
+	v = self.builder.CreateTrunc(v, self.ctx.IntType(int(f.BitWidth)), "")
+	if f.Signed {
+		return self.builder.CreateSExt(v, f.Type, "")
+	}
+	return self.builder.CreateZExt(v, f.Type, "")
+}
+
+// 写入位域
+func (self *CodeGenerator) storeBitField(ptr llvm.Value, f fieldLayout, v llvm.Value) {
+	p, storage := self.bitFieldStorage(ptr, f)
+	offset := llvm.ConstInt(storage, f.BitOffset, false)
+	mask := llvm.ConstShl(llvm.ConstZExtOrBitCast(llvm.ConstAllOnes(self.ctx.IntType(int(f.BitWidth))), storage), offset)
+
+	v = self.builder.CreateTrunc(v, self.ctx.IntType(int(f.BitWidth)), "")
+	v = self.builder.CreateShl(self.builder.CreateZExt(v, storage, ""), offset, "")
+	old := self.builder.CreateLoad(storage, p, "")
+	old.SetAlignment(1)
+	old = self.builder.CreateAnd(old, llvm.ConstNot(mask), "")
+	self.builder.CreateStore(self.builder.CreateOr(old, v, ""), p).SetAlignment(1)
+}
+
+// 自定义布局类型的常量
+func (self *CodeGenerator) constLayoutStruct(t llvm.Type, values []llvm.Value) llvm.Value {
+	layout := self.layouts[t]
+	body := t.StructElementTypes()
+	elems := make([]llvm.Value, len(body))
+	for i, e := range body {
+		elems[i] = llvm.ConstNull(e)
+	}
+
+	bytes := make([]uint64, layout.Size)
+	for i, v := range values {
+		f := layout.Fields[i]
+		if f.BitWidth == 0 {
+			elems[f.Index] = v
+			continue
+		}
+		bits, begin := v.ZExtValue(), f.Offset*8+f.BitOffset
+		for b := uint64(0); b < f.BitWidth; b++ {
+			if bits>>b&1 != 0 {
+				bytes[(begin+b)/8] |= 1 << ((begin + b) % 8)
+			}
+		}
+	}
+	for _, i := range layout.Storages {
+		begin := self.target.ElementOffset(t, i)
+		storage := make([]llvm.Value, body[i].ArrayLength())
+		for j := range storage {
+			storage[j] = llvm.ConstInt(self.ctx.Int8Type(), bytes[begin+uint64(j)], false)
+		}
+		elems[i] = llvm.ConstArray(self.ctx.Int8Type(), storage)
+	}
+	return llvm.ConstNamedStruct(t, elems)
+}
+
+// 按字节比较
+func (self *CodeGenerator) equalBytes(left, right llvm.Value, size uint64) llvm.Value {
+	if size == 0 {
+		return llvm.ConstInt(self.ctx.Int1Type(), 1, false)
+	}
+	it := self.ctx.IntType(int(size * 8))
+	load := func(v llvm.Value) llvm.Value {
+		ptr := self.createAlloca(v.Type())
+		self.builder.CreateStore(v, ptr)
+		value := self.builder.CreateLoad(it, self.builder.CreatePointerCast(ptr, llvm.PointerType(it, 0), ""), "")
+		value.SetAlignment(1)
+		return value
+	}
+	return self.builder.CreateICmp(llvm.IntEQ, load(left), load(right), "")
+}
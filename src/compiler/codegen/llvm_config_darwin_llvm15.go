@@ -0,0 +1,9 @@
+//go:build !byollvm && darwin && !llvm14
+
+package codegen
+
+// llvm-c头文件的位置与go-llvm一致
+
+// #cgo amd64 CPPFLAGS: -I/usr/local/opt/llvm@15/include
+// #cgo arm64 CPPFLAGS: -I/opt/homebrew/opt/llvm@15/include
+import "C"
@@ -0,0 +1,8 @@
+//go:build !byollvm && linux && llvm14
+
+package codegen
+
+// llvm-c头文件的位置与go-llvm一致
+
+// #cgo CPPFLAGS: -I/usr/lib/llvm-14/include
+import "C"
@@ -7,36 +7,52 @@ import (
 
 // 代码块
 func (self *CodeGenerator) codegenBlock(mean analyse.Block) bool {
+	self.enterScope()
+	defer self.exitScope()
 	for _, stmt := range mean.Stmts {
 		if !self.codegenStmt(stmt) {
 			return false
 		}
 	}
+	self.leaveScopes(len(self.scopes) - 1)
 	return true
 }
 
-// 语句
+// 语句，语句中产生的临时值在语句结束时析构
 func (self *CodeGenerator) codegenStmt(mean analyse.Stmt) bool {
+	mark := len(self.temps)
 	switch meanStmt := mean.(type) {
 	case *analyse.Return:
 		self.codegenReturn(*meanStmt)
 		return false
 	case *analyse.Variable:
 		self.codegenVariable(meanStmt)
+		if analyse.NeedDrop(meanStmt.Type) {
+			self.declareDrop(meanStmt)
+		}
+		self.dropTemporaries(mark)
+	case *analyse.Panic:
+		self.codegenPanic(meanStmt)
+		if meanStmt.Cond == nil {
+			return false
+		}
+		self.dropTemporaries(mark)
 	case analyse.Expr:
 		self.codegenExpr(meanStmt, true)
+		self.dropTemporaries(mark)
 	case *analyse.Block:
 		if !self.codegenBlock(*meanStmt) {
 			return false
 		}
 	case *analyse.IfElse:
-		self.codegenIfElse(*meanStmt)
+		self.codegenIfElse(*meanStmt, mark)
 	case *analyse.Loop:
 		self.codegenLoop(*meanStmt)
 	case *analyse.LoopControl:
 		self.codegenLoopControl(*meanStmt)
+		return false
 	case *analyse.Defer:
-		self.codegenDefer(*meanStmt)
+		self.codegenDefer(*meanStmt, mark)
 	default:
 		panic("")
 	}
@@ -46,29 +62,31 @@ func (self *CodeGenerator) codegenStmt(mean analyse.Stmt) bool {
 // 函数返回
 func (self *CodeGenerator) codegenReturn(mean analyse.Return) {
 	if mean.Value == nil {
-		self.doneBeforeFuncEnd()
+		self.leaveScopes(0)
 		self.builder.CreateRetVoid()
 	} else {
 		value := self.codegenExpr(mean.Value, true)
-		self.doneBeforeFuncEnd()
-		self.builder.CreateRet(value)
+		self.dropTemporaries(0)
+		self.leaveScopes(0)
+		self.createRet(value)
 	}
 }
 
 // 变量
 func (self *CodeGenerator) codegenVariable(mean *analyse.Variable) {
-	alloca := self.builder.CreateAlloca(self.codegenType(mean.Type), "")
+	alloca := self.createAlloca(self.codegenType(mean.Type))
 	value := self.codegenExpr(mean.Value, true)
 	self.vars[mean] = alloca
 	self.builder.CreateStore(value, alloca)
 }
 
-// 条件分支
-func (self *CodeGenerator) codegenIfElse(mean analyse.IfElse) {
+// 条件分支，条件中产生的临时值在进入分支前析构
+func (self *CodeGenerator) codegenIfElse(mean analyse.IfElse, mark int) {
 	cond := self.builder.CreateIntCast(self.codegenExpr(mean.Cond, true), self.ctx.Int1Type(), "")
-	tb := llvm.AddBasicBlock(self.function, "")
+	self.dropTemporaries(mark)
+	tb := self.ctx.AddBasicBlock(self.function, "")
 	if mean.False == nil {
-		eb := llvm.AddBasicBlock(self.function, "")
+		eb := self.ctx.AddBasicBlock(self.function, "")
 		self.builder.CreateCondBr(cond, tb, eb)
 
 		self.builder.SetInsertPointAtEnd(tb)
@@ -78,7 +96,7 @@ func (self *CodeGenerator) codegenIfElse(mean analyse.IfElse) {
 
 		self.builder.SetInsertPointAtEnd(eb)
 	} else {
-		fb, eb := llvm.AddBasicBlock(self.function, ""), llvm.AddBasicBlock(self.function, "")
+		fb, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
 		self.builder.CreateCondBr(cond, tb, fb)
 
 		self.builder.SetInsertPointAtEnd(tb)
@@ -97,27 +115,31 @@ func (self *CodeGenerator) codegenIfElse(mean analyse.IfElse) {
 
 // 循环
 func (self *CodeGenerator) codegenLoop(mean analyse.Loop) {
-	cb := llvm.AddBasicBlock(self.function, "")
+	cb := self.ctx.AddBasicBlock(self.function, "")
 	self.builder.CreateBr(cb)
 
 	self.builder.SetInsertPointAtEnd(cb)
-	lb, eb := llvm.AddBasicBlock(self.function, ""), llvm.AddBasicBlock(self.function, "")
-	self.builder.CreateCondBr(self.builder.CreateIntCast(self.codegenExpr(mean.Cond, true), self.ctx.Int1Type(), ""), lb, eb)
+	lb, eb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
+	mark := len(self.temps)
+	cond := self.builder.CreateIntCast(self.codegenExpr(mean.Cond, true), self.ctx.Int1Type(), "")
+	self.dropTemporaries(mark)
+	self.builder.CreateCondBr(cond, lb, eb)
 
-	cbBk, ebBk := self.cb, self.eb
-	self.cb, self.eb = cb, eb
+	cbBk, ebBk, loopScopeBk := self.cb, self.eb, self.loopScope
+	self.cb, self.eb, self.loopScope = cb, eb, len(self.scopes)
 	self.builder.SetInsertPointAtEnd(lb)
 	if self.codegenBlock(*mean.Body) {
 		self.builder.CreateBr(cb)
 	}
 
-	self.cb, self.eb = cbBk, ebBk
+	self.cb, self.eb, self.loopScope = cbBk, ebBk, loopScopeBk
 
 	self.builder.SetInsertPointAtEnd(eb)
 }
 
 // 循环控制
 func (self *CodeGenerator) codegenLoopControl(mean analyse.LoopControl) {
+	self.leaveScopes(self.loopScope)
 	if mean.Type == "break" {
 		self.builder.CreateBr(self.eb)
 	} else {
@@ -125,27 +147,97 @@ func (self *CodeGenerator) codegenLoopControl(mean analyse.LoopControl) {
 	}
 }
 
-type deferInfo struct {
-	Func llvm.Value
-	Args []llvm.Value
+// 延迟执行，离开所在的代码块时执行；延迟调用的函数和参数立即求值，求值产生的临时值在调用后析构
+func (self *CodeGenerator) codegenDefer(mean analyse.Defer, mark int) {
+	if mean.Call == nil {
+		body := mean.Body
+		self.addCleanup(func() {
+			self.codegenBlock(*body)
+		})
+		return
+	}
+	var ft *analyse.TypeFunc
+	var f llvm.Value
+	var args []llvm.Value
+	switch call := mean.Call.(type) {
+	case *analyse.FuncCall:
+		ft = analyse.GetBaseType(call.Func.GetType()).(*analyse.TypeFunc)
+		f = self.codegenExpr(call.Func, true)
+		args = make([]llvm.Value, len(call.Args))
+		for i, a := range call.Args {
+			args[i] = self.codegenExpr(a, true)
+		}
+	case *analyse.MethodCall:
+		ft = call.Method.Func.GetType().(*analyse.TypeFunc)
+		f, args = self.codegenMethodCallArgs(call)
+	default:
+		panic("unknown defer call")
+	}
+	temps := append([]*temporary(nil), self.temps[mark:]...)
+	self.temps = self.temps[:mark]
+	self.addCleanup(func() {
+		self.createCall(ft, f, args)
+		self.createTemporariesDrop(temps)
+	})
 }
 
-// 延迟调用
-func (self *CodeGenerator) codegenDefer(mean analyse.Defer) {
-	f := self.codegenExpr(mean.Call.Func, true)
-	args := make([]llvm.Value, len(mean.Call.Args))
-	for i, a := range mean.Call.Args {
-		args[i] = self.codegenExpr(a, true)
+// 错误传播，失败时执行清理并返回，std.result中的成员按名字查找
+func (self *CodeGenerator) codegenTry(mean *analyse.Try) llvm.Value {
+	vt := mean.Value.GetType()
+	flag := "some"
+	if mean.IsResult {
+		flag = "ok"
 	}
-	self.defers = append(self.defers, deferInfo{
-		Func: f,
-		Args: args,
-	})
+	value := self.codegenExpr(mean.Value, true)
+	ptr := self.createAlloca(value.Type())
+	self.builder.CreateStore(value, ptr)
+
+	okb, fb := self.ctx.AddBasicBlock(self.function, ""), self.ctx.AddBasicBlock(self.function, "")
+	cond := self.createStructIndex(ptr, getFieldIndexByName(vt, flag), true)
+	self.builder.CreateCondBr(self.builder.CreateIntCast(cond, self.ctx.Int1Type(), ""), okb, fb)
+
+	self.builder.SetInsertPointAtEnd(fb)
+	ret := self.createAlloca(self.codegenType(mean.Ret))
+	self.builder.CreateStore(llvm.ConstNull(ret.Type().ElementType()), ret)
+	if mean.IsResult {
+		e := self.createStructIndex(ptr, getFieldIndexByName(vt, "error"), true)
+		self.builder.CreateStore(e, self.createStructIndex(ret, getFieldIndexByName(mean.Ret, "error"), false))
+	}
+	retValue := self.builder.CreateLoad(ret.Type().ElementType(), ret, "")
+	self.createTemporariesDrop(self.temps)
+	self.leaveScopes(0)
+	self.createRet(retValue)
+
+	self.builder.SetInsertPointAtEnd(okb)
+	return self.createStructIndex(ptr, getFieldIndexByName(vt, "value"), true)
 }
 
-// 函数结束前需做的事情
-func (self *CodeGenerator) doneBeforeFuncEnd() {
-	for _, d := range self.defers {
-		self.builder.CreateCall(d.Func.Type().ReturnType(), d.Func, d.Args, "")
+// 报错并终止程序，断言时只在条件为假时报错
+func (self *CodeGenerator) codegenPanic(mean *analyse.Panic) {
+	var cb llvm.BasicBlock
+	if mean.Cond != nil {
+		cond := self.builder.CreateIntCast(self.codegenExpr(mean.Cond, true), self.ctx.Int1Type(), "")
+		fb := self.ctx.AddBasicBlock(self.function, "")
+		cb = self.ctx.AddBasicBlock(self.function, "")
+		self.builder.CreateCondBr(cond, cb, fb)
+		self.builder.SetInsertPointAtEnd(fb)
+	}
+
+	i32 := self.ctx.Int32Type()
+	var msg, msgLen llvm.Value
+	switch {
+	case mean.Msg == nil:
+		msg, msgLen = self.constCString(mean.Text), llvm.ConstInt(i32, uint64(len(mean.Text)), false)
+	case mean.MsgIsString:
+		s := self.codegenExpr(mean.Msg, true)
+		msg = self.builder.CreateExtractValue(s, 0, "")
+		msgLen = self.builder.CreateTrunc(self.builder.CreateExtractValue(s, 1, ""), i32, "")
+	default:
+		msg, msgLen = self.codegenExpr(mean.Msg, true), llvm.ConstAllOnes(i32)
+	}
+	self.createPanic(msg, msgLen, mean.Pos)
+
+	if mean.Cond != nil {
+		self.builder.SetInsertPointAtEnd(cb)
 	}
 }
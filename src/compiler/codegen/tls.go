@@ -0,0 +1,23 @@
+package codegen
+
+// #include <llvm-c/Core.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/kkkunny/go-llvm"
+)
+
+// 线程局部存储模型
+var tlsModels = map[string]C.LLVMThreadLocalMode{
+	"general_dynamic": C.LLVMGeneralDynamicTLSModel,
+	"local_dynamic":   C.LLVMLocalDynamicTLSModel,
+	"initial_exec":    C.LLVMInitialExecTLSModel,
+	"local_exec":      C.LLVMLocalExecTLSModel,
+}
+
+// 设置全局变量为线程局部变量，go-llvm没有封装LLVMSetThreadLocalMode，通过Value.C直接调用llvm-c（libLLVM已由go-llvm链接）
+func setThreadLocal(v llvm.Value, model string) {
+	C.LLVMSetThreadLocalMode(C.LLVMValueRef(unsafe.Pointer(v.C)), tlsModels[model])
+}
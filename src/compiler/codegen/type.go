@@ -9,17 +9,16 @@ import (
 func (self *CodeGenerator) codegenType(mean analyse.Type) llvm.Type {
 	switch typ := mean.(type) {
 	case *analyse.TypeFunc:
-		ret := self.codegenType(typ.Ret)
-		params := make([]llvm.Type, len(typ.Params))
-		for i, p := range typ.Params {
-			params[i] = self.codegenType(p)
-		}
-		return llvm.PointerType(llvm.FunctionType(ret, params, false), 0)
+		return llvm.PointerType(self.getABIFunc(typ).Type, 0)
 	case *analyse.TypeArray:
 		elem := self.codegenType(typ.Elem)
 		return llvm.ArrayType(elem, int(typ.Size))
+	case *analyse.TypeVec:
+		return llvm.VectorType(self.codegenType(typ.Elem), int(typ.Size))
 	case *analyse.TypeTuple:
-		if len(typ.Elems) <= 3 {
+		if needLayout(typ) {
+			return self.codegenLayoutType(typ.String(), typ)
+		} else if len(typ.Elems) <= 3 {
 			elems := make([]llvm.Type, len(typ.Elems))
 			for i, e := range typ.Elems {
 				elems[i] = self.codegenType(e)
@@ -40,7 +39,9 @@ func (self *CodeGenerator) codegenType(mean analyse.Type) llvm.Type {
 			return td
 		}
 	case *analyse.TypeStruct:
-		if typ.Fields.Length() <= 3 {
+		if needLayout(typ) {
+			return self.codegenLayoutType(typ.String(), typ)
+		} else if typ.Fields.Length() <= 3 {
 			elems := make([]llvm.Type, typ.Fields.Length())
 			for iter := typ.Fields.Begin(); iter.HasValue(); iter.Next() {
 				elems[iter.Index()] = self.codegenType(iter.Value().Second)
@@ -65,6 +66,8 @@ func (self *CodeGenerator) codegenType(mean analyse.Type) llvm.Type {
 	case *analyse.Typedef:
 		if !analyse.IsTupleType(typ.Dst) && !analyse.IsStructType(typ.Dst) {
 			return self.codegenType(typ.Dst)
+		} else if needLayout(typ.Dst) {
+			return self.codegenLayoutType(typ.String(), typ.Dst)
 		}
 		key := typ.String()
 		if t, ok := self.types[key]; ok {
@@ -103,6 +106,8 @@ func (self *CodeGenerator) codegenType(mean analyse.Type) llvm.Type {
 				return self.ctx.Int32Type()
 			case analyse.I64, analyse.U64:
 				return self.ctx.Int64Type()
+			case analyse.I128, analyse.U128:
+				return self.ctx.IntType(128)
 			case analyse.Isize, analyse.Usize:
 				return t_size
 			default:
@@ -1,8 +1,10 @@
 package codegen
 
 import (
+	"github.com/kkkunny/Sim/src/compiler/analyse"
 	"github.com/kkkunny/Sim/src/compiler/utils"
 	"github.com/kkkunny/go-llvm"
+	"strings"
 )
 
 var (
@@ -21,6 +23,39 @@ func (self CodeGenerator) init() {
 	v_false = llvm.ConstInt(t_bool, 0, true)
 }
 
+// 调用约定
+var callConvs = map[string]llvm.CallConv{
+	"":     llvm.CCallConv,
+	"fast": llvm.FastCallConv,
+	"cold": llvm.ColdCallConv,
+}
+
+// 内存序
+var atomicOrderings = map[analyse.AtomicOrdering]llvm.AtomicOrdering{
+	analyse.OrderingRelaxed: llvm.AtomicOrderingMonotonic,
+	analyse.OrderingAcquire: llvm.AtomicOrderingAcquire,
+	analyse.OrderingRelease: llvm.AtomicOrderingRelease,
+	analyse.OrderingAcqRel:  llvm.AtomicOrderingAcquireRelease,
+	analyse.OrderingSeqCst:  llvm.AtomicOrderingSequentiallyConsistent,
+}
+
+// 按名字创建llvm属性，名字在不同llvm版本中不变
+func (self *CodeGenerator) createAttribute(name string) llvm.Attribute {
+	id := llvm.AttributeKindID(name)
+	if id == 0 {
+		panic("unknown llvm attribute " + name)
+	}
+	return self.ctx.CreateEnumAttribute(id, 0)
+}
+
+// 设置为linkonce_odr链接，多个目标文件中的同名定义在链接时合并为一个，mach-o不支持comdat，只设置链接类型
+func (self *CodeGenerator) setLinkOnce(v llvm.Value, name string) {
+	v.SetLinkage(llvm.LinkOnceODRLinkage)
+	if !strings.Contains(self.triple, "apple") {
+		v.SetComdat(self.module.Comdat(name))
+	}
+}
+
 func (self *CodeGenerator) createArrayIndex(v llvm.Value, i llvm.Value, getValue bool) llvm.Value {
 	if v.Type().TypeKind() == llvm.PointerTypeKind {
 		value := self.builder.CreateInBoundsGEP(v.Type().ElementType(), v, []llvm.Value{llvm.ConstInt(t_size, 0, false), i}, "")
@@ -42,6 +77,9 @@ func (self *CodeGenerator) createPointerIndex(v llvm.Value, i llvm.Value, getVal
 }
 
 func (self *CodeGenerator) createStructIndex(v llvm.Value, i uint, getValue bool) llvm.Value {
+	if layout := self.getLayout(v.Type()); layout != nil {
+		return self.createLayoutIndex(v, layout, i, getValue)
+	}
 	if v.Type().TypeKind() == llvm.PointerTypeKind {
 		value := self.builder.CreateStructGEP(v.Type().ElementType(), v, int(i), "")
 		if getValue {
@@ -52,3 +90,32 @@ func (self *CodeGenerator) createStructIndex(v llvm.Value, i uint, getValue bool
 		return self.builder.CreateExtractValue(v, int(i), "")
 	}
 }
+
+func (self *CodeGenerator) storeStructIndex(ptr llvm.Value, i uint, v llvm.Value) {
+	if layout := self.getLayout(ptr.Type()); layout != nil && layout.Fields[i].BitWidth != 0 {
+		self.storeBitField(ptr, layout.Fields[i], v)
+		return
+	}
+	self.builder.CreateStore(v, self.createStructIndex(ptr, i, false))
+}
+
+func (self *CodeGenerator) createAlloca(t llvm.Type) llvm.Value {
+	v := self.builder.CreateAlloca(t, "")
+	v.SetAlignment(int(self.typeAlign(t)))
+	return v
+}
+
+// 计算u64的哈希值，逐个按FNV-1a混合后用murmur3的fmix64打散
+func (self *CodeGenerator) createHash(values []llvm.Value) llvm.Value {
+	t := self.ctx.Int64Type()
+	h := llvm.ConstInt(t, 0xcbf29ce484222325, false)
+	for _, v := range values {
+		h = self.builder.CreateXor(h, v, "")
+		h = self.builder.CreateMul(h, llvm.ConstInt(t, 0x100000001b3, false), "")
+	}
+	for _, k := range []uint64{0xff51afd7ed558ccd, 0xc4ceb9fe1a85ec53} {
+		h = self.builder.CreateXor(h, self.builder.CreateLShr(h, llvm.ConstInt(t, 33, false), ""), "")
+		h = self.builder.CreateMul(h, llvm.ConstInt(t, k, false), "")
+	}
+	return self.builder.CreateXor(h, self.builder.CreateLShr(h, llvm.ConstInt(t, 33, false), ""), "")
+}
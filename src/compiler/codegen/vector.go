@@ -0,0 +1,134 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/kkkunny/Sim/src/compiler/analyse"
+	"github.com/kkkunny/go-llvm"
+	stlutil "github.com/kkkunny/stl/util"
+	"math"
+)
+
+// 向量字面量
+func (self *CodeGenerator) codegenVector(mean *analyse.Vector) llvm.Value {
+	elems := make([]llvm.Value, len(mean.Elems))
+	isConst := true
+	for i, e := range mean.Elems {
+		elems[i] = self.codegenExpr(e, true)
+		if !elems[i].IsConstant() {
+			isConst = false
+		}
+	}
+	if isConst {
+		return llvm.ConstVector(elems, false)
+	}
+	v := llvm.Undef(self.codegenType(mean.Type))
+	for i, e := range elems {
+		v = self.builder.CreateInsertElement(v, e, llvm.ConstInt(self.ctx.Int32Type(), uint64(i), false), "")
+	}
+	return v
+}
+
+// 洗牌
+func (self *CodeGenerator) codegenShuffle(mean *analyse.Shuffle) llvm.Value {
+	left := self.codegenExpr(mean.Left, true)
+	right := llvm.Undef(left.Type())
+	if mean.Right != nil {
+		right = self.codegenExpr(mean.Right, true)
+	}
+	mask := make([]llvm.Value, len(mean.Mask))
+	for i, m := range mean.Mask {
+		mask[i] = llvm.ConstInt(self.ctx.Int32Type(), uint64(m), false)
+	}
+	return self.builder.CreateShuffleVector(left, right, llvm.ConstVector(mask, false), "")
+}
+
+// 归约，调用llvm.vector.reduce.*
+func (self *CodeGenerator) codegenReduce(mean *analyse.Reduce) llvm.Value {
+	v := self.codegenExpr(mean.Value, true)
+	vt, elem := v.Type(), v.Type().ElementType()
+	elemMean := analyse.GetScalarType(mean.Value.GetType())
+	isFloat, signed := analyse.IsFloatType(elemMean), analyse.IsSintType(elemMean)
+
+	var name string
+	switch mean.Op {
+	case analyse.ReduceAdd:
+		name = stlutil.Ternary(isFloat, "fadd", "add")
+	case analyse.ReduceMul:
+		name = stlutil.Ternary(isFloat, "fmul", "mul")
+	case analyse.ReduceMin:
+		name = stlutil.Ternary(isFloat, "fmin", stlutil.Ternary(signed, "smin", "umin"))
+	case analyse.ReduceMax:
+		name = stlutil.Ternary(isFloat, "fmax", stlutil.Ternary(signed, "smax", "umax"))
+	case analyse.ReduceAnd:
+		name = "and"
+	case analyse.ReduceOr:
+		name = "or"
+	case analyse.ReduceXor:
+		name = "xor"
+	default:
+		panic("")
+	}
+	name = fmt.Sprintf("llvm.vector.reduce.%s.%s", name, intrinsicTypeName(vt))
+
+	// 浮点数的加法和乘法需要初始值，没有快速数学标志时按顺序计算
+	if isFloat && (mean.Op == analyse.ReduceAdd || mean.Op == analyse.ReduceMul) {
+		start := stlutil.Ternary(mean.Op == analyse.ReduceAdd, llvm.ConstFloat(elem, math.Copysign(0, -1)), llvm.ConstFloat(elem, 1))
+		ft := llvm.FunctionType(elem, []llvm.Type{elem, vt}, false)
+		return self.builder.CreateCall(ft, self.getRuntimeFunc(name, ft), []llvm.Value{start, v}, "")
+	}
+	ft := llvm.FunctionType(elem, []llvm.Type{vt}, false)
+	return self.builder.CreateCall(ft, self.getRuntimeFunc(name, ft), []llvm.Value{v}, "")
+}
+
+// 将标量广播到向量的每个元素
+func (self *CodeGenerator) createSplat(v llvm.Value, t llvm.Type) llvm.Value {
+	zero := llvm.ConstInt(self.ctx.Int32Type(), 0, false)
+	vec := self.builder.CreateInsertElement(llvm.Undef(t), v, zero, "")
+	return self.builder.CreateShuffleVector(vec, llvm.Undef(t), llvm.ConstNull(llvm.VectorType(self.ctx.Int32Type(), t.VectorSize())), "")
+}
+
+// 整数常量，向量类型时每个元素都为该值
+func (self *CodeGenerator) constInt(t llvm.Type, v uint64, signed bool) llvm.Value {
+	if t.TypeKind() != llvm.VectorTypeKind {
+		return llvm.ConstInt(t, v, signed)
+	}
+	elems := make([]llvm.Value, t.VectorSize())
+	for i := range elems {
+		elems[i] = llvm.ConstInt(t.ElementType(), v, signed)
+	}
+	return llvm.ConstVector(elems, false)
+}
+
+// 条件是否成立，布尔向量时只要有一个元素成立
+func (self *CodeGenerator) anyTrue(cond llvm.Value) llvm.Value {
+	if cond.Type().TypeKind() != llvm.VectorTypeKind {
+		return cond
+	}
+	name := "llvm.vector.reduce.or." + intrinsicTypeName(cond.Type())
+	ft := llvm.FunctionType(cond.Type().ElementType(), []llvm.Type{cond.Type()}, false)
+	return self.builder.CreateCall(ft, self.getRuntimeFunc(name, ft), []llvm.Value{cond}, "")
+}
+
+// 获取标量类型，向量类型时为元素类型
+func scalarType(t llvm.Type) llvm.Type {
+	if t.TypeKind() == llvm.VectorTypeKind {
+		return t.ElementType()
+	}
+	return t
+}
+
+// 重载的llvm内置函数名中的类型后缀，如i32、f64、v4f32
+func intrinsicTypeName(t llvm.Type) string {
+	switch t.TypeKind() {
+	case llvm.IntegerTypeKind:
+		return fmt.Sprintf("i%d", t.IntTypeWidth())
+	case llvm.FloatTypeKind:
+		return "f32"
+	case llvm.DoubleTypeKind:
+		return "f64"
+	case llvm.VectorTypeKind:
+		return fmt.Sprintf("v%d%s", t.VectorSize(), intrinsicTypeName(t.ElementType()))
+	default:
+		panic("")
+	}
+}
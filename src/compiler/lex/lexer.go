@@ -2,12 +2,15 @@ package lex
 
 import (
 	"errors"
+	"fmt"
 	"github.com/kkkunny/Sim/src/compiler/utils"
 	stlos "github.com/kkkunny/stl/os"
 	stlutil "github.com/kkkunny/stl/util"
 	"io"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Lexer 词法分析器
@@ -31,6 +34,33 @@ func NewLexer(fp stlos.Path, reader Reader) *Lexer {
 	return lexer
 }
 
+// State 词法分析器的状态，用于回溯
+type State struct {
+	offset int64
+	pos    uint
+	ch     rune
+	row    uint
+	col    uint
+}
+
+// Save 保存当前状态
+func (self *Lexer) Save() State {
+	offset := stlutil.MustValue(self.reader.Seek(0, io.SeekCurrent))
+	return State{
+		offset: offset,
+		pos:    self.pos,
+		ch:     self.ch,
+		row:    self.row,
+		col:    self.col,
+	}
+}
+
+// Restore 回到保存的状态
+func (self *Lexer) Restore(state State) {
+	stlutil.MustValue(self.reader.Seek(state.offset, io.SeekStart))
+	self.pos, self.ch, self.row, self.col = state.pos, state.ch, state.row, state.col
+}
+
 // GetFilepath 获取源文件路径
 func (self *Lexer) GetFilepath() stlos.Path {
 	return self.file
@@ -59,13 +89,13 @@ func (self *Lexer) next() rune {
 
 // 获取下一个
 func (self *Lexer) peek() rune {
-	ch, _, err := self.reader.ReadRune()
+	ch, size, err := self.reader.ReadRune()
 	if err != nil && errors.Is(err, io.EOF) {
 		return 0
 	} else if err != nil && !errors.Is(err, io.EOF) {
 		panic(err)
 	}
-	stlutil.MustValue(self.reader.Seek(-1, io.SeekCurrent))
+	stlutil.MustValue(self.reader.Seek(-int64(size), io.SeekCurrent))
 	return ch
 }
 
@@ -128,96 +158,423 @@ func (self *Lexer) scanNumber() Token {
 	pos.SetBegin(self.pos, self.row, self.col)
 
 	var buf strings.Builder
-	var point int
-	for self.ch == '.' || utils.IsNumber(self.ch) {
-		if self.ch == '.' {
-			point++
-		}
+	write := func() {
 		buf.WriteRune(self.ch)
 		pos.SetEnd(self.pos, self.row, self.col)
 		self.next()
 	}
-	s := buf.String()
+	// 非法时记录第一个错误
+	var err string
+	fail := func(f string, a ...any) {
+		if err == "" {
+			err = fmt.Sprintf(f, a...)
+		}
+	}
+	// 扫描数字序列，数字间可以用_分隔
+	scanDigits := func(isDigit func(rune) bool) {
+		var last rune
+		for self.ch == '_' || isDigit(self.ch) {
+			if self.ch == '_' && !isDigit(last) {
+				fail("invalid digit separator")
+			}
+			last = self.ch
+			write()
+		}
+		if last == '_' {
+			fail("invalid digit separator")
+		}
+	}
 
-	if point > 1 || s[len(s)-1] == '.' {
-		return Token{
-			Pos:    pos,
-			Kind:   ILLEGAL,
-			Source: s,
+	kind := INT
+	if next := self.peek(); self.ch == '0' && (next == 'x' || next == 'X' || next == 'o' || next == 'O' || next == 'b' || next == 'B') {
+		write()
+		prefix := self.ch
+		write()
+		var name string
+		var isDigit func(rune) bool
+		switch prefix {
+		case 'x', 'X':
+			name, isDigit = "hexadecimal", isHexNumber
+		case 'o', 'O':
+			name, isDigit = "octal", func(c rune) bool { return c >= '0' && c <= '7' }
+		default:
+			name, isDigit = "binary", func(c rune) bool { return c == '0' || c == '1' }
+		}
+		if self.ch == '_' {
+			write()
+		}
+		if !isDigit(self.ch) && !utils.IsNumber(self.ch) {
+			fail("missing digits in %s literal", name)
+		}
+		scanDigits(isDigit)
+		// 超出进制的十进制数字
+		if utils.IsNumber(self.ch) {
+			fail("invalid digit '%c' in %s literal", self.ch, name)
+			scanDigits(utils.IsNumber)
+		}
+	} else {
+		scanDigits(utils.IsNumber)
+		// 小数
+		if self.ch == '.' && utils.IsNumber(self.peek()) {
+			kind = FLOAT
+			write()
+			scanDigits(utils.IsNumber)
+		}
+		// 指数
+		if self.ch == 'e' || self.ch == 'E' {
+			kind = FLOAT
+			write()
+			if self.ch == '+' || self.ch == '-' {
+				write()
+			}
+			if !utils.IsNumber(self.ch) {
+				fail("missing exponent digits")
+			}
+			scanDigits(utils.IsNumber)
+		}
+	}
+
+	// 类型后缀
+	var suffix strings.Builder
+	for self.ch == '_' || unicode.IsLetter(self.ch) || utils.IsNumber(self.ch) {
+		suffix.WriteRune(self.ch)
+		write()
+	}
+	if suffix.Len() > 0 {
+		switch suffix.String() {
+		case "i8", "i16", "i32", "i64", "i128", "isize", "u8", "u16", "u32", "u64", "u128", "usize":
+			if kind == FLOAT {
+				fail("invalid suffix `%s` on float literal", suffix.String())
+			}
+		case "f32", "f64":
+			kind = FLOAT
+		default:
+			fail("invalid suffix `%s` on number literal", suffix.String())
 		}
 	}
 
 	return Token{
 		Pos:    pos,
-		Kind:   stlutil.Ternary(point == 0, INT, FLOAT),
-		Source: s,
+		Kind:   stlutil.Ternary(err == "", kind, ILLEGAL),
+		Source: buf.String(),
+		Err:    err,
 	}
 }
 
-// 扫描字符
-func (self *Lexer) scanChar() Token {
+// 是否是十六进制数字
+func isHexNumber(c rune) bool {
+	return utils.IsNumber(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// SplitNumber 将数字字面量拆分为去掉分隔符的数字部分、进制和类型后缀
+func SplitNumber(s string) (number string, base int, suffix string) {
+	base = 10
+	if len(s) > 1 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			s = s[2:]
+		}
+	}
+	// 十六进制数字包含f，因此十六进制字面量只有整型后缀
+	end := strings.IndexAny(s, stlutil.Ternary(base == 16, "iu", "iuf"))
+	if end >= 0 {
+		s, suffix = s[:end], s[end:]
+	}
+	return strings.ReplaceAll(s, "_", ""), base, suffix
+}
+
+// 源码字符
+type sourceRune struct {
+	ch            rune
+	pos, row, col uint
+}
+
+// 当前源码字符
+func (self *Lexer) curSourceRune() sourceRune {
+	return sourceRune{ch: self.ch, pos: self.pos, row: self.row, col: self.col}
+}
+
+// 非法token
+func (self *Lexer) illegal(begin, end sourceRune, f string, a ...any) Token {
 	pos := utils.NewPosition(self.file)
-	pos.SetBegin(self.pos, self.row, self.col)
+	pos.SetBegin(begin.pos, begin.row, begin.col)
+	pos.SetEnd(end.pos, end.row, end.col)
+	return Token{
+		Pos:  pos,
+		Kind: ILLEGAL,
+		Err:  fmt.Sprintf(f, a...),
+	}
+}
 
-	var buf strings.Builder
-	var lastRune rune
-	for self.ch != 0 {
-		ch := self.ch
-		buf.WriteRune(ch)
-		pos.SetEnd(self.pos, self.row, self.col)
+// 读取引号内的源码字符直到结束符end，escape为是否跳过被转义的字符，返回内容和结束符的最后一个字符
+func (self *Lexer) scanQuoted(end string, escape bool) ([]sourceRune, sourceRune, bool) {
+	var runes []sourceRune
+	endRunes := []rune(end)
+	for {
+		if self.ch == 0 {
+			return runes, self.curSourceRune(), false
+		}
+		if self.ch == endRunes[0] && self.hasPrefix(endRunes) {
+			var last sourceRune
+			for range endRunes {
+				last = self.curSourceRune()
+				self.next()
+			}
+			return runes, last, true
+		}
+		runes = append(runes, self.curSourceRune())
+		if escape && self.ch == '\\' {
+			self.next()
+			if self.ch == 0 {
+				return runes, self.curSourceRune(), false
+			}
+			runes = append(runes, self.curSourceRune())
+		}
 		self.next()
-		if buf.Len() != 1 && ch == '\'' && lastRune != '\\' {
-			break
+	}
+}
+
+// 从当前字符开始是否是s
+func (self *Lexer) hasPrefix(s []rune) bool {
+	if len(s) == 1 {
+		return true
+	}
+	offset := int64(0)
+	defer func() {
+		stlutil.MustValue(self.reader.Seek(-offset, io.SeekCurrent))
+	}()
+	for _, c := range s[1:] {
+		ch, size, err := self.reader.ReadRune()
+		offset += int64(size)
+		if err != nil || ch != c {
+			return false
 		}
-		lastRune = ch
 	}
-	s := buf.String()
-	ss := utils.ParseEscapeCharacter(s, `\'`, `'`)
-	runes := []rune(ss)
+	return true
+}
 
-	if len(runes) != 3 || runes[0] != '\'' || runes[2] != '\'' {
-		return Token{
-			Pos:    pos,
-			Kind:   ILLEGAL,
-			Source: s,
+// 解码转义字符，每个元素为一个字符或者一个字节（\xNN）
+func (self *Lexer) decodeEscape(runes []sourceRune) ([]rune, []bool, *Token) {
+	var chars []rune
+	var isBytes []bool
+	for i := 0; i < len(runes); i++ {
+		if runes[i].ch != '\\' {
+			chars, isBytes = append(chars, runes[i].ch), append(isBytes, false)
+			continue
+		}
+		begin := runes[i]
+		i++
+		if i >= len(runes) {
+			tok := self.illegal(begin, begin, "unterminated escape sequence")
+			return nil, nil, &tok
+		} else if runes[i].ch == '\n' {
+			// 续行
+			continue
+		}
+		if r, ok := utils.GetEscapeCharacter(runes[i].ch); ok {
+			chars, isBytes = append(chars, r), append(isBytes, false)
+			continue
+		}
+		switch runes[i].ch {
+		case 'x':
+			// \xNN
+			if i+2 >= len(runes) || !isHexNumber(runes[i+1].ch) || !isHexNumber(runes[i+2].ch) {
+				tok := self.illegal(begin, runeAt(runes, i+2), "expect two hex digits after `\\x`")
+				return nil, nil, &tok
+			}
+			v, _ := strconv.ParseUint(string([]rune{runes[i+1].ch, runes[i+2].ch}), 16, 8)
+			chars, isBytes = append(chars, rune(v)), append(isBytes, true)
+			i += 2
+		case 'u':
+			// \u{X...}
+			j := i + 1
+			if j >= len(runes) || runes[j].ch != '{' {
+				tok := self.illegal(begin, runes[i], "expect `{` after `\\u`")
+				return nil, nil, &tok
+			}
+			var digits []rune
+			for j++; j < len(runes) && isHexNumber(runes[j].ch); j++ {
+				digits = append(digits, runes[j].ch)
+			}
+			if j >= len(runes) || runes[j].ch != '}' {
+				tok := self.illegal(begin, runeAt(runes, j), "expect hex digits and `}` in unicode escape")
+				return nil, nil, &tok
+			}
+			v, err := strconv.ParseUint(string(digits), 16, 32)
+			if len(digits) == 0 || len(digits) > 6 || err != nil || !utf8.ValidRune(rune(v)) {
+				tok := self.illegal(begin, runes[j], "invalid unicode escape `\\u{%s}`", string(digits))
+				return nil, nil, &tok
+			}
+			chars, isBytes = append(chars, rune(v)), append(isBytes, false)
+			i = j
+		default:
+			tok := self.illegal(begin, runes[i], "unknown escape sequence `\\%c`", runes[i].ch)
+			return nil, nil, &tok
+		}
+	}
+	return chars, isBytes, nil
+}
+
+// 获取第i个源码字符，超出范围时获取最后一个
+func runeAt(runes []sourceRune, i int) sourceRune {
+	if i >= len(runes) {
+		return runes[len(runes)-1]
+	}
+	return runes[i]
+}
+
+// 将字符和字节编码为字符串
+func encodeString(chars []rune, isBytes []bool) string {
+	var buf strings.Builder
+	for i, c := range chars {
+		if isBytes[i] {
+			buf.WriteByte(byte(c))
+		} else {
+			buf.WriteRune(c)
 		}
 	}
+	return buf.String()
+}
+
+// 扫描字符
+func (self *Lexer) scanChar() Token {
+	begin := self.curSourceRune()
+	self.next()
+	runes, end, ok := self.scanQuoted("'", true)
+	if !ok {
+		return self.illegal(begin, end, "unterminated char literal")
+	}
 
+	chars, _, errTok := self.decodeEscape(runes)
+	if errTok != nil {
+		return *errTok
+	} else if len(chars) != 1 {
+		return self.illegal(begin, end, "char literal must contain exactly one character")
+	}
+
+	pos := utils.NewPosition(self.file)
+	pos.SetBegin(begin.pos, begin.row, begin.col)
+	pos.SetEnd(end.pos, end.row, end.col)
 	return Token{
 		Pos:    pos,
 		Kind:   CHAR,
-		Source: ss,
+		Source: "'" + string(chars) + "'",
 	}
 }
 
 // 扫描字符串
 func (self *Lexer) scanString() Token {
-	pos := utils.NewPosition(self.file)
-	pos.SetBegin(self.pos, self.row, self.col)
+	begin := self.curSourceRune()
+	self.next()
 
-	var buf strings.Builder
-	var lastRune rune
-	for self.ch != 0 {
-		ch := self.ch
-		buf.WriteRune(ch)
-		pos.SetEnd(self.pos, self.row, self.col)
+	var runes []sourceRune
+	var end sourceRune
+	var ok bool
+	if self.ch == '"' && self.peek() == '"' {
+		// 多行字符串
 		self.next()
-		if buf.Len() != 1 && ch == '"' && lastRune != '\\' {
-			break
+		self.next()
+		var errTok *Token
+		runes, end, errTok = self.scanMultiLineString(begin)
+		if errTok != nil {
+			return *errTok
 		}
-		lastRune = ch
+	} else if runes, end, ok = self.scanQuoted(`"`, true); !ok {
+		return self.illegal(begin, end, "unterminated string literal")
 	}
-	s := buf.String()
 
-	if s[0] != '"' || s[len(s)-1] != '"' {
-		return Token{
-			Pos:    pos,
-			Kind:   ILLEGAL,
-			Source: s,
+	chars, isBytes, errTok := self.decodeEscape(runes)
+	if errTok != nil {
+		return *errTok
+	}
+	return self.stringToken(begin, end, `"`+encodeString(chars, isBytes)+`"`)
+}
+
+// 扫描多行字符串（"""开始的下一行到"""所在的行之前），去掉每一行与结束符"""相同的缩进
+func (self *Lexer) scanMultiLineString(begin sourceRune) ([]sourceRune, sourceRune, *Token) {
+	runes, end, ok := self.scanQuoted(`"""`, true)
+	if !ok {
+		tok := self.illegal(begin, end, "unterminated string literal")
+		return nil, end, &tok
+	}
+
+	// 按行切分
+	var lines [][]sourceRune
+	var line []sourceRune
+	for _, r := range runes {
+		if r.ch == '\n' {
+			lines = append(lines, line)
+			line = nil
+		} else {
+			line = append(line, r)
+		}
+	}
+	lines = append(lines, line)
+
+	isBlank := func(line []sourceRune) bool {
+		for _, r := range line {
+			if r.ch != ' ' && r.ch != '\t' && r.ch != '\r' {
+				return false
+			}
+		}
+		return true
+	}
+	if len(lines) < 2 || !isBlank(lines[0]) {
+		tok := self.illegal(begin, begin, "multi-line string content must start on a new line")
+		return nil, end, &tok
+	}
+	indent := lines[len(lines)-1]
+	if !isBlank(indent) {
+		tok := self.illegal(indent[0], indent[len(indent)-1], "closing delimiter of multi-line string must be on its own line")
+		return nil, end, &tok
+	}
+
+	var res []sourceRune
+	for i, line := range lines[1 : len(lines)-1] {
+		if i > 0 {
+			res = append(res, sourceRune{ch: '\n'})
 		}
+		if isBlank(line) && len(line) <= len(indent) {
+			continue
+		}
+		for j, r := range indent {
+			if j >= len(line) || line[j].ch != r.ch {
+				tok := self.illegal(line[0], runeAt(line, j), "insufficient indentation of line in multi-line string")
+				return nil, end, &tok
+			}
+		}
+		res = append(res, line[len(indent):]...)
 	}
+	return res, end, nil
+}
 
-	s = utils.ParseEscapeCharacter(s, `\"`, `"`)
+// 扫描原始字符串，不处理转义
+func (self *Lexer) scanRawString() Token {
+	begin := self.curSourceRune()
+	self.next()
+	runes, end, ok := self.scanQuoted("`", false)
+	if !ok {
+		return self.illegal(begin, end, "unterminated raw string literal")
+	}
+	chars := make([]rune, len(runes))
+	for i, r := range runes {
+		chars[i] = r.ch
+	}
+	return self.stringToken(begin, end, `"`+string(chars)+`"`)
+}
+
+// 字符串token
+func (self *Lexer) stringToken(begin, end sourceRune, s string) Token {
+	pos := utils.NewPosition(self.file)
+	pos.SetBegin(begin.pos, begin.row, begin.col)
+	pos.SetEnd(end.pos, end.row, end.col)
 	return Token{
 		Pos:    pos,
 		Kind:   STRING,
@@ -239,6 +596,8 @@ func (self *Lexer) Scan() Token {
 		return self.scanChar()
 	} else if self.ch == '"' {
 		return self.scanString()
+	} else if self.ch == '`' {
+		return self.scanRawString()
 	} else {
 		pos := utils.NewPosition(self.file)
 		pos.SetBegin(self.pos, self.row, self.col)
@@ -420,6 +779,14 @@ func (self *Lexer) Scan() Token {
 		case '.':
 			kind = DOT
 			buf.WriteRune(self.ch)
+			if self.peek() == '.' {
+				buf.WriteRune(self.next())
+				kind = ILLEGAL
+				if self.peek() == '.' {
+					buf.WriteRune(self.next())
+					kind = ELL
+				}
+			}
 		default:
 			buf.WriteRune(self.ch)
 		}
@@ -69,6 +69,7 @@ const (
 	NEG // ~
 	COM // ,
 	DOT // .
+	ELL // ...
 	QUO // ?
 
 	FUNC     // func
@@ -76,6 +77,7 @@ const (
 	TRUE     // true
 	FALSE    // false
 	STRUCT   // struct
+	UNION    // union
 	IF       // if
 	ELSE     // else
 	FOR      // for
@@ -87,6 +89,7 @@ const (
 	IMPORT   // import
 	PUB      // pub
 	LET      // let
+	ASM      // asm
 )
 
 var tokenKindStr = [...]string{
@@ -150,6 +153,7 @@ var tokenKindStr = [...]string{
 	NEG: "~",
 	COM: ",",
 	DOT: ".",
+	ELL: "...",
 	QUO: "?",
 
 	FUNC:     "func",
@@ -157,6 +161,7 @@ var tokenKindStr = [...]string{
 	TRUE:     "true",
 	FALSE:    "false",
 	STRUCT:   "struct",
+	UNION:    "union",
 	IF:       "if",
 	ELSE:     "else",
 	FOR:      "for",
@@ -168,6 +173,7 @@ var tokenKindStr = [...]string{
 	IMPORT:   "import",
 	PUB:      "pub",
 	LET:      "let",
+	ASM:      "asm",
 }
 
 // LookUp 区分标识符和关键字
@@ -183,6 +189,8 @@ func LookUp(s string) TokenKind {
 		return FALSE
 	case "struct":
 		return STRUCT
+	case "union":
+		return UNION
 	case "if":
 		return IF
 	case "else":
@@ -207,6 +215,8 @@ func LookUp(s string) TokenKind {
 		return PUB
 	case "let":
 		return LET
+	case "asm":
+		return ASM
 	default:
 		return IDENT
 	}
@@ -241,6 +251,7 @@ type Token struct {
 	Pos    utils.Position // 位置
 	Kind   TokenKind      // kind
 	Source string         // 源码
+	Err    string         // 非法token的错误信息
 }
 
 func (self Token) String() string {
@@ -0,0 +1,202 @@
+// Package mangle 符号修饰
+//
+// 没有通过@extern指定外部名的函数、方法和全局变量按如下规则生成符号名：
+//
+//	symbol  := "_S" package item
+//	package := "N" ident {ident} "E"       包路径，主包为main，标准库为相对语言根目录的路径
+//	item    := "F" ident                    函数
+//	         | "V" ident                    全局变量
+//	         | "M" ident ident              方法（类型名，方法名）
+//	ident   := <十进制字节长度> <名字>       名字中字母、数字、_和.以外的字节转义为$加两位十六进制数
+//
+// 例如std.os包中的函数exit修饰为`_SN3std2osEF4exit`，还原为`std::os::exit`；
+// 主包中类型Point的方法len修饰为`_SN4mainEM5Point3len`，还原为`main::Point.len`；
+// 泛型类型的实例以实例名作为类型名，例如Vec[i32]的方法push修饰为`_SN3std9container3vecEM12Vec$5bi32$5d4push`。
+package mangle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 符号前缀
+const prefix = "_S"
+
+// Function 修饰函数名
+func Function(pkg, name string) string {
+	return mangle(pkg, "F", name)
+}
+
+// Method 修饰方法名
+func Method(pkg, typ, name string) string {
+	return mangle(pkg, "M", typ, name)
+}
+
+// Variable 修饰全局变量名
+func Variable(pkg, name string) string {
+	return mangle(pkg, "V", name)
+}
+
+// 修饰
+func mangle(pkg, kind string, names ...string) string {
+	var buf strings.Builder
+	buf.WriteString(prefix)
+	buf.WriteByte('N')
+	for _, p := range strings.Split(pkg, ".") {
+		writeIdent(&buf, p)
+	}
+	buf.WriteByte('E')
+	buf.WriteString(kind)
+	for _, n := range names {
+		writeIdent(&buf, n)
+	}
+	return buf.String()
+}
+
+// 写入标识符
+func writeIdent(buf *strings.Builder, s string) {
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '_' || c == '.' || isDigit(c) || isLetter(c) {
+			escaped.WriteByte(c)
+		} else {
+			escaped.WriteString(fmt.Sprintf("$%02x", c))
+		}
+	}
+	buf.WriteString(strconv.Itoa(escaped.Len()))
+	buf.WriteString(escaped.String())
+}
+
+// Demangle 还原符号名，不是合法的修饰名时返回false
+func Demangle(symbol string) (string, bool) {
+	s, n, ok := demangle(symbol)
+	if !ok || n != len(symbol) {
+		return symbol, false
+	}
+	return s, true
+}
+
+// DemangleText 还原文本中出现的所有修饰名
+func DemangleText(text string) string {
+	var buf strings.Builder
+	var last int
+	for i := 0; i < len(text); {
+		j := strings.Index(text[i:], prefix+"N")
+		if j < 0 {
+			break
+		}
+		i += j
+		// 修饰名需要是一个完整的单词
+		if i > 0 && isIdentByte(text[i-1]) {
+			i += len(prefix)
+			continue
+		}
+		if s, n, ok := demangle(text[i:]); ok {
+			buf.WriteString(text[last:i])
+			buf.WriteString(s)
+			i += n
+			last = i
+		} else {
+			i += len(prefix)
+		}
+	}
+	buf.WriteString(text[last:])
+	return buf.String()
+}
+
+// 还原符号名前缀，返回还原结果和消耗的字节数
+func demangle(s string) (string, int, bool) {
+	if !strings.HasPrefix(s, prefix+"N") {
+		return "", 0, false
+	}
+	i := len(prefix) + 1
+
+	var buf strings.Builder
+	for i < len(s) && s[i] != 'E' {
+		ident, n, ok := readIdent(s[i:])
+		if !ok {
+			return "", 0, false
+		}
+		buf.WriteString(ident)
+		buf.WriteString("::")
+		i += n
+	}
+	if i+1 >= len(s) || buf.Len() == 0 {
+		return "", 0, false
+	}
+	i++
+
+	var count int
+	switch s[i] {
+	case 'F', 'V':
+		count = 1
+	case 'M':
+		count = 2
+	default:
+		return "", 0, false
+	}
+	i++
+	for j := 0; j < count; j++ {
+		ident, n, ok := readIdent(s[i:])
+		if !ok {
+			return "", 0, false
+		}
+		if j > 0 {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(ident)
+		i += n
+	}
+	// 修饰名之后不能紧跟标识符字符
+	if i < len(s) && isIdentByte(s[i]) {
+		return "", 0, false
+	}
+	return buf.String(), i, true
+}
+
+// 读取标识符
+func readIdent(s string) (string, int, bool) {
+	var i int
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	if i == 0 || s[0] == '0' {
+		return "", 0, false
+	}
+	length, err := strconv.Atoi(s[:i])
+	if err != nil || i+length > len(s) {
+		return "", 0, false
+	}
+	// 还原转义的字节
+	ident := s[i : i+length]
+	var buf strings.Builder
+	for j := 0; j < len(ident); j++ {
+		if ident[j] != '$' {
+			buf.WriteByte(ident[j])
+			continue
+		}
+		if j+3 > len(ident) {
+			return "", 0, false
+		}
+		c, err := strconv.ParseUint(ident[j+1:j+3], 16, 8)
+		if err != nil {
+			return "", 0, false
+		}
+		buf.WriteByte(byte(c))
+		j += 2
+	}
+	return buf.String(), i + length, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || isLetter(c) || c >= 0x80
+}
@@ -5,131 +5,87 @@ import (
 	"github.com/kkkunny/Sim/src/compiler/utils"
 )
 
-// Attr 属性
-type Attr interface {
-	Ast
-	Attr()
-}
-
-// AttrExtern @extern
-type AttrExtern struct {
+// Attr 属性，形如`@name`或者`@name(arg, key=arg)`，具体的属性在语义分析时校验
+type Attr struct {
 	Pos  utils.Position
 	Name lex.Token
+	Args []*AttrArg
 }
 
-func NewAttrExtern(pos utils.Position, name lex.Token) *AttrExtern {
-	return &AttrExtern{
+func NewAttr(pos utils.Position, name lex.Token, args []*AttrArg) *Attr {
+	return &Attr{
 		Pos:  pos,
 		Name: name,
+		Args: args,
 	}
 }
 
-func (self AttrExtern) Position() utils.Position {
-	return self.Pos
-}
-
-func (self AttrExtern) Attr() {}
-
-// AttrLink @link
-type AttrLink struct {
-	Pos  utils.Position
-	Asms []*String
-	Libs []*String
-}
-
-func NewAttrLink(pos utils.Position, asms, libs []*String) *AttrLink {
-	return &AttrLink{
-		Pos:  pos,
-		Asms: asms,
-		Libs: libs,
-	}
-}
-
-func (self AttrLink) Position() utils.Position {
-	return self.Pos
-}
-
-func (self AttrLink) Attr() {}
-
-// AttrNoReturn @noreturn
-type AttrNoReturn struct {
-	Pos utils.Position
-}
-
-func NewAttrNoReturn(pos utils.Position) *AttrNoReturn {
-	return &AttrNoReturn{Pos: pos}
-}
-
-func (self AttrNoReturn) Position() utils.Position {
+func (self Attr) Position() utils.Position {
 	return self.Pos
 }
 
-func (self AttrNoReturn) Attr() {}
-
-// AttrInline @inline
-type AttrInline struct {
-	Pos   utils.Position
-	Value lex.Token
+// AttrArg 属性参数，值为标识符、字符串、整数或者布尔值
+type AttrArg struct {
+	Key   *lex.Token // 键，位置参数时为空
+	Value Expr
 }
 
-func NewAttrInline(pos utils.Position, v lex.Token) *AttrInline {
-	return &AttrInline{
-		Pos:   pos,
+func NewAttrArg(key *lex.Token, v Expr) *AttrArg {
+	return &AttrArg{
+		Key:   key,
 		Value: v,
 	}
 }
 
-func (self AttrInline) Position() utils.Position {
-	return self.Pos
+func (self AttrArg) Position() utils.Position {
+	if self.Key != nil {
+		return utils.MixPosition(self.Key.Pos, self.Value.Position())
+	}
+	return self.Value.Position()
 }
 
-func (self AttrInline) Attr() {}
-
 // ****************************************************************
 
-func (self *Parser) parseAttr() Attr {
-	attrName := self.expectNextIs(lex.Attr)
-	switch attrName.Source {
-	case "@extern":
-		self.expectNextIs(lex.LPA)
-		name := self.expectNextIs(lex.IDENT)
-		end := self.expectNextIs(lex.RPA).Pos
-		return NewAttrExtern(utils.MixPosition(attrName.Pos, end), name)
-	case "@link":
-		self.expectNextIs(lex.LPA)
-		var asms, libs []*String
-		for {
-			linkname := self.expectNextIs(lex.IDENT)
-			switch linkname.Source {
-			case "asm":
-				self.expectNextIs(lex.ASS)
-				asms = append(asms, self.parseStringExpr())
-			case "lib":
-				self.expectNextIs(lex.ASS)
-				libs = append(libs, self.parseStringExpr())
-			default:
-				self.throwErrorf(linkname.Pos, "unknown link")
-			}
-			if !self.skipNextIs(lex.COM) {
-				break
-			}
+// 属性
+func (self *Parser) parseAttr() *Attr {
+	name := self.expectNextIs(lex.Attr)
+	if !self.skipNextIs(lex.LPA) {
+		return NewAttr(name.Pos, name, nil)
+	}
+	var args []*AttrArg
+	for !self.nextIs(lex.RPA) {
+		args = append(args, self.parseAttrArg())
+		if !self.skipNextIs(lex.COM) {
+			break
 		}
-		end := self.expectNextIs(lex.RPA).Pos
-		return NewAttrLink(utils.MixPosition(attrName.Pos, end), asms, libs)
-	case "@noreturn":
-		return NewAttrNoReturn(attrName.Pos)
-	case "@inline":
-		self.expectNextIs(lex.LPA)
-		var v lex.Token
-		if self.skipNextIs(lex.FALSE) {
-			v = self.curTok
-		} else {
-			v = self.expectNextIs(lex.TRUE)
+	}
+	end := self.expectNextIs(lex.RPA).Pos
+	return NewAttr(utils.MixPosition(name.Pos, end), name, args)
+}
+
+// 属性参数
+func (self *Parser) parseAttrArg() *AttrArg {
+	var key *lex.Token
+	// 键也可以是关键字asm（@link(asm="...")）
+	if self.skipNextIs(lex.IDENT) || self.skipNextIs(lex.ASM) {
+		tok := self.curTok
+		if !self.skipNextIs(lex.ASS) {
+			return NewAttrArg(nil, NewIdent(nil, tok))
 		}
-		end := self.expectNextIs(lex.RPA).Pos
-		return NewAttrInline(utils.MixPosition(attrName.Pos, end), v)
+		key = &tok
+	}
+	switch self.nextTok.Kind {
+	case lex.IDENT:
+		return NewAttrArg(key, NewIdent(nil, self.expectNextIs(lex.IDENT)))
+	case lex.STRING:
+		return NewAttrArg(key, self.parseStringExpr())
+	case lex.INT:
+		return NewAttrArg(key, self.parseIntExpr())
+	case lex.TRUE, lex.FALSE:
+		self.next()
+		return NewAttrArg(key, NewBool(self.curTok, self.curTok.Kind == lex.TRUE))
 	default:
-		self.throwErrorf(attrName.Pos, "unknown attribute")
+		self.throwErrorf(self.nextTok.Pos, "expect a attribute argument")
 		return nil
 	}
 }
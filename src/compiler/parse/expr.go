@@ -1,9 +1,9 @@
 package parse
 
 import (
-	"fmt"
 	"github.com/kkkunny/Sim/src/compiler/lex"
 	"github.com/kkkunny/Sim/src/compiler/utils"
+	"math/big"
 	"strconv"
 )
 
@@ -36,16 +36,18 @@ func (self Call) Stmt() {}
 
 func (self Call) Expr() {}
 
-// Int 整数
+// Int 整数，值为字面量的绝对值，不限制位数，由语义分析按类型检查范围
 type Int struct {
-	Token lex.Token
-	Value int64
+	Token  lex.Token
+	Value  *big.Int
+	Suffix string // 类型后缀
 }
 
-func NewInt(tok lex.Token, v int64) *Int {
+func NewInt(tok lex.Token, v *big.Int, suffix string) *Int {
 	return &Int{
-		Token: tok,
-		Value: v,
+		Token:  tok,
+		Value:  v,
+		Suffix: suffix,
 	}
 }
 
@@ -59,14 +61,16 @@ func (self Int) Expr() {}
 
 // Float 浮点数
 type Float struct {
-	Token lex.Token
-	Value float64
+	Token  lex.Token
+	Value  float64
+	Suffix string // 类型后缀
 }
 
-func NewFloat(tok lex.Token, v float64) *Float {
+func NewFloat(tok lex.Token, v float64, suffix string) *Float {
 	return &Float{
-		Token: tok,
-		Value: v,
+		Token:  tok,
+		Value:  v,
+		Suffix: suffix,
 	}
 }
 
@@ -158,9 +162,10 @@ func (self Null) Stmt() {}
 
 func (self Null) Expr() {}
 
-// Ident 标识符
+// Ident 标识符，T::f中的类型名也在Pkg中，分析时与包名区分
 type Ident struct {
 	Pkg  *lex.Token
+	Type *lex.Token // pkg::T::f中的类型名
 	Name lex.Token
 }
 
@@ -353,6 +358,55 @@ func (self Ternary) Stmt() {}
 
 func (self Ternary) Expr() {}
 
+// Try 错误传播（expr?），失败时从函数返回
+type Try struct {
+	Pos   utils.Position
+	Value Expr
+}
+
+func NewTry(pos utils.Position, v Expr) *Try {
+	return &Try{
+		Pos:   pos,
+		Value: v,
+	}
+}
+
+func (self Try) Position() utils.Position {
+	return self.Pos
+}
+
+func (self Try) Stmt() {}
+
+func (self Try) Expr() {}
+
+// Asm 内联汇编，asm("模板" : 输出 : 输入 : 破坏 : 选项)，末尾的部分可以省略
+type Asm struct {
+	Begin, End utils.Position
+	Template   *String
+	Outputs    []*AsmOperand
+	Inputs     []*AsmOperand
+	Clobbers   []*String
+	Options    []lex.Token
+}
+
+func (self Asm) Position() utils.Position {
+	return utils.MixPosition(self.Begin, self.End)
+}
+
+func (self Asm) Stmt() {}
+
+func (self Asm) Expr() {}
+
+// AsmOperand 内联汇编操作数，形如`"约束"(表达式)`
+type AsmOperand struct {
+	Constraint *String
+	Value      Expr
+}
+
+func (self AsmOperand) Position() utils.Position {
+	return utils.MixPosition(self.Constraint.Position(), self.Value.Position())
+}
+
 // Binary 二元表达式
 type Binary struct {
 	Opera       lex.Token
@@ -400,11 +454,12 @@ func (self *Parser) parsePrimaryExpr() Expr {
 		return self.parseIntExpr()
 	case lex.FLOAT:
 		self.next()
-		v, err := strconv.ParseFloat(self.curTok.Source, 64)
+		number, _, suffix := lex.SplitNumber(self.curTok.Source)
+		v, err := strconv.ParseFloat(number, 64)
 		if err != nil {
 			self.throwErrorf(self.curTok.Pos, "out of float size")
 		}
-		return NewFloat(self.curTok, v)
+		return NewFloat(self.curTok, v, suffix)
 	case lex.TRUE:
 		self.next()
 		return NewBool(self.curTok, true)
@@ -419,11 +474,19 @@ func (self *Parser) parsePrimaryExpr() Expr {
 	case lex.NULL:
 		self.next()
 		return NewNull(self.curTok)
+	case lex.ASM:
+		return self.parseAsmExpr()
 	case lex.IDENT:
 		self.next()
 		pkg := self.curTok
 		if self.skipNextIs(lex.CLL) {
 			name := self.expectNextIs(lex.IDENT)
+			// 其他包中类型的关联函数
+			if self.skipNextIs(lex.CLL) {
+				ident := NewIdent(&pkg, self.expectNextIs(lex.IDENT))
+				ident.Type = &name
+				return ident
+			}
 			return NewIdent(&pkg, name)
 		}
 		return NewIdent(nil, pkg)
@@ -455,7 +518,6 @@ func (self *Parser) parsePrimaryExpr() Expr {
 		end := self.expectNextIs(lex.RBR).Pos
 		return NewStruct(utils.MixPosition(begin, end), fields...)
 	default:
-		fmt.Printf("%+v\n", self.nextTok)
 		self.throwErrorf(self.nextTok.Pos, "unknown expression")
 		return nil
 	}
@@ -464,11 +526,12 @@ func (self *Parser) parsePrimaryExpr() Expr {
 // 整数
 func (self *Parser) parseIntExpr() *Int {
 	tok := self.expectNextIs(lex.INT)
-	v, err := strconv.ParseInt(tok.Source, 10, 64)
-	if err != nil {
-		self.throwErrorf(tok.Pos, "out of integer size")
+	number, base, suffix := lex.SplitNumber(tok.Source)
+	v, ok := new(big.Int).SetString(number, base)
+	if !ok {
+		self.throwErrorf(tok.Pos, "invalid integer literal")
 	}
-	return NewInt(tok, v)
+	return NewInt(tok, v, suffix)
 }
 
 // 字符串
@@ -477,6 +540,55 @@ func (self *Parser) parseStringExpr() *String {
 	return NewString(tok, tok.Source[1:len(tok.Source)-1])
 }
 
+// 内联汇编
+func (self *Parser) parseAsmExpr() *Asm {
+	begin := self.expectNextIs(lex.ASM).Pos
+	self.expectNextIs(lex.LPA)
+	asm := &Asm{Begin: begin, Template: self.parseStringExpr()}
+	// 各部分用:分隔，::跳过一个空的部分
+	for section := 0; ; {
+		if self.skipNextIs(lex.CLL) {
+			section += 2
+		} else if self.skipNextIs(lex.COL) {
+			section++
+		} else {
+			break
+		}
+		if section > 4 {
+			self.throwErrorf(self.curTok.Pos, "too many sections in inline assembly")
+		}
+		for !self.nextIs(lex.COL) && !self.nextIs(lex.CLL) && !self.nextIs(lex.RPA) {
+			switch section {
+			case 1:
+				asm.Outputs = append(asm.Outputs, self.parseAsmOperand())
+			case 2:
+				asm.Inputs = append(asm.Inputs, self.parseAsmOperand())
+			case 3:
+				asm.Clobbers = append(asm.Clobbers, self.parseStringExpr())
+			default:
+				asm.Options = append(asm.Options, self.expectNextIs(lex.IDENT))
+			}
+			if !self.skipNextIs(lex.COM) {
+				break
+			}
+		}
+	}
+	asm.End = self.expectNextIs(lex.RPA).Pos
+	return asm
+}
+
+// 内联汇编操作数
+func (self *Parser) parseAsmOperand() *AsmOperand {
+	constraint := self.parseStringExpr()
+	self.expectNextIs(lex.LPA)
+	value := self.parseExpr()
+	self.expectNextIs(lex.RPA)
+	return &AsmOperand{
+		Constraint: constraint,
+		Value:      value,
+	}
+}
+
 // 一元表达式前缀
 func (self *Parser) parsePrefixUnaryExpr() Expr {
 	switch self.nextTok.Kind {
@@ -484,12 +596,6 @@ func (self *Parser) parsePrefixUnaryExpr() Expr {
 		self.next()
 		op := self.curTok
 		v := self.parsePrefixUnaryExpr()
-		if lit, ok := v.(*Int); ok {
-			lit.Value = -lit.Value
-			lit.Token.Pos = utils.MixPosition(op.Pos, lit.Token.Pos)
-			lit.Token.Source = "-" + lit.Token.Source
-			return lit
-		}
 		return NewUnary(op, v)
 	case lex.NEG, lex.NOT, lex.AND, lex.MUL:
 		self.next()
@@ -521,12 +627,35 @@ func (self *Parser) parseSuffixUnaryExpr(front Expr) Expr {
 		index := self.parseExpr()
 		end := self.expectNextIs(lex.RBA).Pos
 		front = NewIndex(utils.MixPosition(front.Position(), end), front, index)
+	case lex.QUO:
+		// ?之后是`一元表达式 :`时为三元表达式，否则为后缀?（如`f()? - 1`）
+		self.next()
+		quo := self.curTok
+		if self.isTernaryBranch() {
+			self.backToNextToken(quo)
+			return front
+		}
+		front = NewTry(utils.MixPosition(front.Position(), quo.Pos), front)
 	default:
 		return front
 	}
 	return self.parseSuffixUnaryExpr(front)
 }
 
+// 接下来是否是三元表达式的真分支，即一元表达式之后紧跟`:`，{视为代码块的开始
+func (self *Parser) isTernaryBranch() bool {
+	switch self.nextTok.Kind {
+	case lex.IDENT, lex.INT, lex.FLOAT, lex.CHAR, lex.STRING, lex.NULL, lex.TRUE, lex.FALSE,
+		lex.LPA, lex.LBA, lex.SUB, lex.NEG, lex.NOT, lex.AND, lex.MUL:
+	default:
+		return false
+	}
+	return self.lookahead(func() bool {
+		self.parseUnaryExpr()
+		return self.nextIs(lex.COL)
+	})
+}
+
 // 一元表达式末尾
 func (self *Parser) parseUnaryTailExpr(front Expr) Expr {
 	switch self.nextTok.Kind {
@@ -37,14 +37,17 @@ func (self Import) Global() {}
 // TypeDef 类型定义
 type TypeDef struct {
 	Pos    utils.Position
+	Attrs  []*Attr
 	Public bool
 	Name   lex.Token
+	Params []lex.Token // 泛型类型形参
 	Target Type
 }
 
-func NewTypeDef(pos utils.Position, pub bool, name lex.Token, target Type) *TypeDef {
+func NewTypeDef(pos utils.Position, attrs []*Attr, pub bool, name lex.Token, target Type) *TypeDef {
 	return &TypeDef{
 		Pos:    pos,
+		Attrs:  attrs,
 		Public: pub,
 		Name:   name,
 		Target: target,
@@ -60,14 +63,15 @@ func (self TypeDef) Global() {}
 // ExternFunction 外部函数声明
 type ExternFunction struct {
 	Pos    utils.Position
-	Attrs  []Attr
+	Attrs  []*Attr
 	Public bool
 	Ret    Type
 	Name   lex.Token
 	Params []*NameOrNilAndType
+	VarArg bool // 是否是可变参数
 }
 
-func NewExternFunction(pos utils.Position, attrs []Attr, pub bool, ret Type, name lex.Token, params []*NameOrNilAndType) *ExternFunction {
+func NewExternFunction(pos utils.Position, attrs []*Attr, pub bool, ret Type, name lex.Token, params []*NameOrNilAndType, varArg bool) *ExternFunction {
 	return &ExternFunction{
 		Pos:    pos,
 		Attrs:  attrs,
@@ -75,6 +79,7 @@ func NewExternFunction(pos utils.Position, attrs []Attr, pub bool, ret Type, nam
 		Ret:    ret,
 		Name:   name,
 		Params: params,
+		VarArg: varArg,
 	}
 }
 
@@ -87,7 +92,7 @@ func (self ExternFunction) Global() {}
 // Function 函数
 type Function struct {
 	Pos    utils.Position
-	Attrs  []Attr
+	Attrs  []*Attr
 	Public bool
 	Ret    Type
 	Name   lex.Token
@@ -95,7 +100,7 @@ type Function struct {
 	Body   *Block // 可能为空
 }
 
-func NewFunction(pos utils.Position, attrs []Attr, pub bool, ret Type, name lex.Token, params []*NameOrNilAndType, body *Block) *Function {
+func NewFunction(pos utils.Position, attrs []*Attr, pub bool, ret Type, name lex.Token, params []*NameOrNilAndType, body *Block) *Function {
 	return &Function{
 		Pos:    pos,
 		Attrs:  attrs,
@@ -113,19 +118,24 @@ func (self Function) Position() utils.Position {
 
 func (self Function) Global() {}
 
-// Method 方法
+// Method 方法，func (T)、func (self T)、func (self *T)或者关联函数func T::name()
 type Method struct {
-	Pos    utils.Position
-	Attrs  []Attr
-	Public bool
-	Self   lex.Token
-	Ret    Type
-	Name   lex.Token
-	Params []*NameOrNilAndType
-	Body   *Block
+	Pos        utils.Position
+	Attrs      []*Attr
+	Public     bool
+	Recv       *lex.Token // 接收者名，func (T)和关联函数时为空
+	RecvPtr    bool       // 接收者是否是指针（func (self *T)）
+	Static     bool       // 是否是关联函数，没有接收者
+	SelfPkg    *lex.Token // 其他包中的类型的包名
+	Self       lex.Token
+	SelfParams []lex.Token // 泛型类型形参
+	Ret        Type
+	Name       lex.Token
+	Params     []*NameOrNilAndType
+	Body       *Block
 }
 
-func NewMethod(pos utils.Position, attrs []Attr, pub bool, self lex.Token, ret Type, name lex.Token, params []*NameOrNilAndType, body *Block) *Method {
+func NewMethod(pos utils.Position, attrs []*Attr, pub bool, self lex.Token, ret Type, name lex.Token, params []*NameOrNilAndType, body *Block) *Method {
 	return &Method{
 		Pos:    pos,
 		Attrs:  attrs,
@@ -146,12 +156,12 @@ func (self Method) Global() {}
 
 // GlobalValue 全局变量
 type GlobalValue struct {
-	Attrs    []Attr
+	Attrs    []*Attr
 	Public   bool
 	Variable *Variable
 }
 
-func NewGlobalValue(pos utils.Position, attrs []Attr, pub bool, t Type, name lex.Token, v Expr) *GlobalValue {
+func NewGlobalValue(pos utils.Position, attrs []*Attr, pub bool, t Type, name lex.Token, v Expr) *GlobalValue {
 	return &GlobalValue{
 		Attrs:    attrs,
 		Public:   pub,
@@ -167,10 +177,7 @@ func (self GlobalValue) Global() {}
 
 // ****************************************************************
 
-var (
-	errStrUnknownGlobal = "unknown global"
-	errStrCanNotUseAttr = "can not use this attribute"
-)
+var errStrUnknownGlobal = "unknown global"
 
 // 全局
 func (self *Parser) parseGlobal() Global {
@@ -180,9 +187,9 @@ func (self *Parser) parseGlobal() Global {
 	}
 
 	switch self.nextTok.Kind {
-	case lex.IMPORT, lex.TYPE:
+	case lex.IMPORT:
 		return self.parseGlobalWithNoAttr(pub)
-	case lex.Attr, lex.FUNC, lex.LET:
+	case lex.Attr, lex.FUNC, lex.LET, lex.TYPE:
 		return self.parseGlobalWithAttr(pub)
 	default:
 		fmt.Println(self.nextTok.Source)
@@ -199,8 +206,6 @@ func (self *Parser) parseGlobalWithNoAttr(pub *lex.Token) Global {
 			self.throwErrorf(self.nextTok.Pos, errStrUnknownGlobal)
 		}
 		return self.parseImport()
-	case lex.TYPE:
-		return self.parseTypeDef(pub)
 	default:
 		self.throwErrorf(self.nextTok.Pos, errStrUnknownGlobal)
 		return nil
@@ -209,7 +214,7 @@ func (self *Parser) parseGlobalWithNoAttr(pub *lex.Token) Global {
 
 // 全局（带属性）
 func (self *Parser) parseGlobalWithAttr(pub *lex.Token) Global {
-	var attrs []Attr
+	var attrs []*Attr
 	if pub == nil {
 		for self.nextIs(lex.Attr) {
 			if len(attrs) == 0 && pub != nil {
@@ -229,6 +234,8 @@ func (self *Parser) parseGlobalWithAttr(pub *lex.Token) Global {
 		return self.parseFunction(pub, attrs)
 	case lex.LET:
 		return self.parseGlobalValue(pub, attrs)
+	case lex.TYPE:
+		return self.parseTypeDef(pub, attrs)
 	default:
 		self.throwErrorf(self.nextTok.Pos, errStrUnknownGlobal)
 		return nil
@@ -253,28 +260,37 @@ func (self *Parser) parseImport() *Import {
 }
 
 // 类型定义
-func (self *Parser) parseTypeDef(pub *lex.Token) *TypeDef {
+func (self *Parser) parseTypeDef(pub *lex.Token, attrs []*Attr) *TypeDef {
 	begin := self.expectNextIs(lex.TYPE).Pos
+	if len(attrs) > 0 {
+		begin = attrs[0].Position()
+	} else if pub != nil {
+		begin = pub.Pos
+	}
 	name := self.expectNextIs(lex.IDENT)
-	target := self.parseType()
-	if pub == nil {
-		return NewTypeDef(utils.MixPosition(begin, target.Position()), false, name, target)
-	} else {
-		return NewTypeDef(utils.MixPosition(pub.Pos, target.Position()), true, name, target)
+	// 泛型类型形参，[后是整数时为数组类型
+	var params []lex.Token
+	if self.skipNextIs(lex.LBA) {
+		if self.nextIs(lex.IDENT) {
+			params = self.parseTokenListAtLeastOne(lex.COM)
+			self.expectNextIs(lex.RBA)
+		} else {
+			self.backToNextToken(self.curTok)
+		}
 	}
+	target := self.parseType()
+	typedef := NewTypeDef(utils.MixPosition(begin, target.Position()), attrs, pub != nil, name, target)
+	typedef.Params = params
+	return typedef
 }
 
 // 函数
-func (self *Parser) parseFunction(pub *lex.Token, attrs []Attr) Global {
+func (self *Parser) parseFunction(pub *lex.Token, attrs []*Attr) Global {
+	// 带有@extern且没有函数体的是外部函数声明
 	var isExtern bool
 	for _, attr := range attrs {
-		switch attr.(type) {
-		case *AttrExtern:
+		if attr.Name.Source == "@extern" {
 			isExtern = true
-		case *AttrLink, *AttrNoReturn, *AttrInline:
-		default:
-			self.throwErrorf(attr.Position(), errStrCanNotUseAttr)
-			return nil
 		}
 	}
 
@@ -293,56 +309,76 @@ func (self *Parser) parseFunction(pub *lex.Token, attrs []Attr) Global {
 	}
 
 	name := self.expectNextIs(lex.IDENT)
+	if self.nextIs(lex.CLL) {
+		return self.parseAssocFunction(begin, pub != nil, attrs, name)
+	}
 	self.expectNextIs(lex.LPA)
-	mid := lex.COL
-	params := self.parseNameOrNilAndTypeList(&mid, lex.COM, false)
+	params, varArg := self.parseParamList()
 	self.expectNextIs(lex.RPA)
 	ret := self.parseTypeOrNil()
 	var body *Block
 	if !isExtern || self.nextIs(lex.LBR) {
 		body = self.parseBlock()
 	}
+	if varArg != nil && body != nil {
+		self.throwErrorf(varArg.Pos, "variadic parameters are only allowed in extern function declarations")
+	}
 
 	pos := utils.MixPosition(begin, self.curTok.Pos)
 	if isExtern && body == nil {
-		for _, attr := range attrs {
-			switch attr.(type) {
-			case *AttrExtern, *AttrLink, *AttrNoReturn:
-			default:
-				self.throwErrorf(attr.Position(), errStrCanNotUseAttr)
-				return nil
-			}
-		}
-		return NewExternFunction(pos, attrs, pub != nil, ret, name, params)
-	} else {
-		for _, attr := range attrs {
-			switch attr.(type) {
-			case *AttrExtern, *AttrNoReturn, *AttrInline:
-			default:
-				self.throwErrorf(attr.Position(), errStrCanNotUseAttr)
-				return nil
-			}
-		}
-		return NewFunction(pos, attrs, pub != nil, ret, name, params, body)
+		return NewExternFunction(pos, attrs, pub != nil, ret, name, params, varArg != nil)
 	}
+	return NewFunction(pos, attrs, pub != nil, ret, name, params, body)
 }
 
-// 方法
-func (self *Parser) parseMethod(begin utils.Position, pub bool, attrs []Attr) *Method {
-	for _, attr := range attrs {
-		switch attr.(type) {
-		case *AttrNoReturn, *AttrInline:
-		default:
-			self.throwErrorf(attr.Position(), errStrCanNotUseAttr)
-			return nil
-		}
-	}
-
+// 方法，接收者为(T)、(self T)或者(self *T)，T可以是其他包中的类型pkg::T
+func (self *Parser) parseMethod(begin utils.Position, pub bool, attrs []*Attr) *Method {
 	self.expectNextIs(lex.LPA)
 	selfTok := self.expectNextIs(lex.IDENT)
+	var recv, selfPkg *lex.Token
+	var recvPtr bool
+	if !self.nextIs(lex.RPA) && !self.nextIs(lex.LBA) {
+		name := selfTok
+		recv = &name
+		recvPtr = self.skipNextIs(lex.MUL)
+		selfTok = self.expectNextIs(lex.IDENT)
+		if self.skipNextIs(lex.CLL) {
+			pkg := selfTok
+			selfPkg = &pkg
+			selfTok = self.expectNextIs(lex.IDENT)
+		}
+	}
+	var selfParams []lex.Token
+	if self.skipNextIs(lex.LBA) {
+		selfParams = self.parseTokenListAtLeastOne(lex.COM)
+		self.expectNextIs(lex.RBA)
+	}
 	self.expectNextIs(lex.RPA)
 
 	name := self.expectNextIs(lex.IDENT)
+	method := self.parseMethodRest(begin, pub, attrs, selfTok, name)
+	method.Recv, method.RecvPtr, method.SelfPkg = recv, recvPtr, selfPkg
+	method.SelfParams = selfParams
+	return method
+}
+
+// 关联函数func T::name()或者func pkg::T::name()，已读取第一个标识符
+func (self *Parser) parseAssocFunction(begin utils.Position, pub bool, attrs []*Attr, selfTok lex.Token) *Method {
+	self.expectNextIs(lex.CLL)
+	var selfPkg *lex.Token
+	name := self.expectNextIs(lex.IDENT)
+	if self.skipNextIs(lex.CLL) {
+		pkg := selfTok
+		selfPkg, selfTok = &pkg, name
+		name = self.expectNextIs(lex.IDENT)
+	}
+	method := self.parseMethodRest(begin, pub, attrs, selfTok, name)
+	method.Static, method.SelfPkg = true, selfPkg
+	return method
+}
+
+// 方法的参数、返回值和函数体
+func (self *Parser) parseMethodRest(begin utils.Position, pub bool, attrs []*Attr, selfTok, name lex.Token) *Method {
 	self.expectNextIs(lex.LPA)
 	mid := lex.COL
 	params := self.parseNameOrNilAndTypeList(&mid, lex.COM, false)
@@ -356,15 +392,7 @@ func (self *Parser) parseMethod(begin utils.Position, pub bool, attrs []Attr) *M
 }
 
 // 全局变量
-func (self *Parser) parseGlobalValue(pub *lex.Token, attrs []Attr) *GlobalValue {
-	for _, attr := range attrs {
-		switch attr.(type) {
-		case *AttrExtern, *AttrLink:
-		default:
-			self.throwErrorf(attr.Position(), errStrCanNotUseAttr)
-			return nil
-		}
-	}
+func (self *Parser) parseGlobalValue(pub *lex.Token, attrs []*Attr) *GlobalValue {
 	v := self.parseVariable()
 	var begin utils.Position
 	if len(attrs) > 0 {
@@ -113,6 +113,9 @@ func (self *Parser) next() {
 	for token.Kind == lex.COMMENT {
 		token = self.scanToken()
 	}
+	if token.Kind == lex.ILLEGAL && token.Err != "" {
+		self.throwErrorf(token.Pos, "%s", token.Err)
+	}
 	self.nextTok = token
 }
 
@@ -162,6 +165,23 @@ func (self *Parser) backToNextToken(tok lex.Token) {
 	self.nextTok = tok
 }
 
+// 试探性分析，f返回true且没有报错时成功，无论成功与否都会回退到分析之前的位置
+func (self *Parser) lookahead(f func() bool) (ok bool) {
+	state := self.lexer.Save()
+	curTok, nextTok, tokenPool := self.curTok, self.nextTok, self.tokenPool.Clone()
+	defer func() {
+		if ea := recover(); ea != nil {
+			if _, isErr := ea.(utils.Error); !isErr {
+				panic(ea)
+			}
+			ok = false
+		}
+		self.lexer.Restore(state)
+		self.curTok, self.nextTok, self.tokenPool = curTok, nextTok, tokenPool
+	}()
+	return f()
+}
+
 // Parse 语法分析
 func (self *Parser) Parse() (file *File, err utils.Error) {
 	defer func() {
@@ -237,7 +257,7 @@ func (self *Parser) parseNameAndType(mid *lex.TokenKind) *NameAndType {
 func (self *Parser) parseNameOrNilAndType(mid *lex.TokenKind) *NameOrNilAndType {
 	typ := self.parseType()
 	var name *lex.Token
-	if ident, ok := typ.(*TypeIdent); ok && ident.Pkg == nil {
+	if ident, ok := typ.(*TypeIdent); ok && ident.Pkg == nil && ident.Args == nil {
 		name = &ident.Name
 		if mid != nil {
 			self.expectNextIs(*mid)
@@ -263,3 +283,22 @@ func (self *Parser) parseNameOrNilAndTypeList(mid *lex.TokenKind, sep lex.TokenK
 	}
 	return toks
 }
+
+// 函数参数列表，可以以`...`结尾
+func (self *Parser) parseParamList() (params []*NameOrNilAndType, varArg *lex.Token) {
+	mid := lex.COL
+	for {
+		if self.skipNextIs(lex.ELL) {
+			tok := self.curTok
+			return params, &tok
+		}
+		if len(params) == 0 && !self.nextIs(lex.IDENT) {
+			break
+		}
+		params = append(params, self.parseNameOrNilAndType(&mid))
+		if !self.skipNextIs(lex.COM) {
+			break
+		}
+	}
+	return params, nil
+}
@@ -134,16 +134,16 @@ func (self Loop) Position() utils.Position {
 
 func (self Loop) Stmt() {}
 
-// Defer 延迟调用
+// Defer 延迟执行，Body为表达式或者代码块
 type Defer struct {
 	Pos  utils.Position
-	Call *Call
+	Body Stmt
 }
 
-func NewDefer(pos utils.Position, call *Call) *Defer {
+func NewDefer(pos utils.Position, body Stmt) *Defer {
 	return &Defer{
 		Pos:  pos,
-		Call: call,
+		Body: body,
 	}
 }
 
@@ -246,13 +246,14 @@ func (self *Parser) parseFor() *Loop {
 	return NewLoop(utils.MixPosition(begin, body.Pos), cond, body)
 }
 
-// 延迟调用
+// 延迟执行
 func (self *Parser) parseDefer() *Defer {
 	begin := self.expectNextIs(lex.DEFER).Pos
-	expr := self.parseExpr()
-	call, ok := expr.(*Call)
-	if !ok {
-		self.throwErrorf(expr.Position(), "expect a function call")
+	var stmt Stmt
+	if self.nextIs(lex.LBR) {
+		stmt = self.parseBlock()
+	} else {
+		stmt = self.parseExpr()
 	}
-	return NewDefer(utils.MixPosition(begin, call.Pos), call)
+	return NewDefer(utils.MixPosition(begin, stmt.Position()), stmt)
 }
@@ -16,6 +16,7 @@ type Type interface {
 type TypeIdent struct {
 	Pkg  *lex.Token
 	Name lex.Token
+	Args []Type // 泛型类型实参
 }
 
 func NewTypeIdent(pkg *lex.Token, name lex.Token) *TypeIdent {
@@ -59,13 +60,15 @@ type TypeFunc struct {
 	Pos    utils.Position
 	Ret    Type // 可能为空
 	Params []Type
+	VarArg bool // 是否是可变参数
 }
 
-func NewTypeFunc(pos utils.Position, ret Type, p ...Type) *TypeFunc {
+func NewTypeFunc(pos utils.Position, ret Type, varArg bool, p ...Type) *TypeFunc {
 	return &TypeFunc{
 		Pos:    pos,
 		Ret:    ret,
 		Params: p,
+		VarArg: varArg,
 	}
 }
 
@@ -96,6 +99,27 @@ func (self TypeArray) Position() utils.Position {
 
 func (self TypeArray) Type() {}
 
+// TypeVec 向量类型
+type TypeVec struct {
+	Pos  utils.Position
+	Size *Int
+	Elem Type
+}
+
+func NewTypeVec(pos utils.Position, size *Int, elem Type) *TypeVec {
+	return &TypeVec{
+		Pos:  pos,
+		Size: size,
+		Elem: elem,
+	}
+}
+
+func (self TypeVec) Position() utils.Position {
+	return self.Pos
+}
+
+func (self TypeVec) Type() {}
+
 // TypeTuple 元组类型
 type TypeTuple struct {
 	Pos   utils.Position
@@ -115,16 +139,21 @@ func (self TypeTuple) Position() utils.Position {
 
 func (self TypeTuple) Type() {}
 
-// TypeStruct 元组类型
+// TypeStruct 结构体类型（或联合体类型）
 type TypeStruct struct {
 	Pos    utils.Position
+	Union  bool // 是否是联合体
 	Fields []types.Pair[bool, *NameAndType]
+	Bits   []*Int    // 位域宽度，与Fields一一对应，不是位域时为空
+	Attrs  [][]*Attr // 字段属性，与Fields一一对应
 }
 
-func NewTypeStruct(pos utils.Position, field ...types.Pair[bool, *NameAndType]) *TypeStruct {
+func NewTypeStruct(pos utils.Position, union bool, bits []*Int, field ...types.Pair[bool, *NameAndType]) *TypeStruct {
 	return &TypeStruct{
 		Pos:    pos,
+		Union:  union,
 		Fields: field,
+		Bits:   bits,
 	}
 }
 
@@ -149,7 +178,7 @@ func (self *Parser) parseTypeOrNil() Type {
 		return self.parseTypeArray()
 	case lex.LPA:
 		return self.parseTypeTuple()
-	case lex.STRUCT:
+	case lex.STRUCT, lex.UNION:
 		return self.parseTypeStruct()
 	default:
 		return nil
@@ -186,12 +215,30 @@ func (self *Parser) parseTypeList() (toks []Type) {
 
 // 标识符类型
 func (self *Parser) parseTypeIdent() Type {
+	var typ *TypeIdent
 	pkg := self.expectNextIs(lex.IDENT)
 	if self.skipNextIs(lex.CLL) {
 		name := self.expectNextIs(lex.IDENT)
-		return NewTypeIdent(&pkg, name)
+		typ = NewTypeIdent(&pkg, name)
+	} else {
+		typ = NewTypeIdent(nil, pkg)
+	}
+	// 泛型类型实参
+	if self.skipNextIs(lex.LBA) {
+		// 向量类型vec[N]T，与类型实参以方括号后是否是整数区分
+		if typ.Pkg == nil && typ.Name.Source == "vec" && self.nextIs(lex.INT) {
+			size := self.parseIntExpr()
+			self.expectNextIs(lex.RBA)
+			elem := self.parseType()
+			return NewTypeVec(utils.MixPosition(typ.Name.Pos, elem.Position()), size, elem)
+		}
+		typ.Args = append(typ.Args, self.parseType())
+		for self.skipNextIs(lex.COM) {
+			typ.Args = append(typ.Args, self.parseType())
+		}
+		self.expectNextIs(lex.RBA)
 	}
-	return NewTypeIdent(nil, pkg)
+	return typ
 }
 
 // 指针类型
@@ -205,10 +252,29 @@ func (self *Parser) parseTypePtr() Type {
 func (self *Parser) parseTypeFunc() Type {
 	begin := self.expectNextIs(lex.FUNC).Pos
 	self.expectNextIs(lex.LPA)
-	params := self.parseTypeList()
+	var params []Type
+	var varArg bool
+	for {
+		if self.skipNextIs(lex.ELL) {
+			varArg = true
+			break
+		}
+		if len(params) == 0 {
+			typ := self.parseTypeOrNil()
+			if typ == nil {
+				break
+			}
+			params = append(params, typ)
+		} else {
+			params = append(params, self.parseType())
+		}
+		if !self.skipNextIs(lex.COM) {
+			break
+		}
+	}
 	self.expectNextIs(lex.RPA)
 	ret := self.parseTypeOrNil()
-	return NewTypeFunc(utils.MixPosition(begin, self.curTok.Pos), ret, params...)
+	return NewTypeFunc(utils.MixPosition(begin, self.curTok.Pos), ret, varArg, params...)
 }
 
 // 数组类型
@@ -228,17 +294,39 @@ func (self *Parser) parseTypeTuple() Type {
 	return NewTypeTuple(utils.MixPosition(begin, end), elems...)
 }
 
-// 结构体类型
+// 结构体类型（或联合体类型）
 func (self *Parser) parseTypeStruct() Type {
-	begin := self.expectNextIs(lex.STRUCT).Pos
+	var begin utils.Position
+	union := self.skipNextIs(lex.UNION)
+	if union {
+		begin = self.curTok.Pos
+	} else {
+		begin = self.expectNextIs(lex.STRUCT).Pos
+	}
 	self.expectNextIs(lex.LBR)
 	mid := lex.COL
 	var fields []types.Pair[bool, *NameAndType]
+	var bits []*Int
+	var attrs [][]*Attr
 	for self.skipSem(); !self.nextIs(lex.RBR); self.skipSem() {
+		var fieldAttrs []*Attr
+		for self.nextIs(lex.Attr) {
+			fieldAttrs = append(fieldAttrs, self.parseAttr())
+			self.expectNextIs(lex.SEM)
+		}
+		attrs = append(attrs, fieldAttrs)
 		pub := self.skipNextIs(lex.PUB)
 		fields = append(fields, types.NewPair(pub, self.parseNameAndType(&mid)))
+		// 位域
+		if self.skipNextIs(lex.COL) {
+			bits = append(bits, self.parseIntExpr())
+		} else {
+			bits = append(bits, nil)
+		}
 		self.expectNextIs(lex.SEM)
 	}
 	end := self.expectNextIs(lex.RBR).Pos
-	return NewTypeStruct(utils.MixPosition(begin, end), fields...)
+	st := NewTypeStruct(utils.MixPosition(begin, end), union, bits, fields...)
+	st.Attrs = attrs
+	return st
 }
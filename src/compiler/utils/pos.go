@@ -2,6 +2,8 @@ package utils
 
 import (
 	stlos "github.com/kkkunny/stl/os"
+	"os"
+	"unicode/utf8"
 )
 
 // Position 位置
@@ -17,6 +19,17 @@ func NewPosition(fp stlos.Path) Position {
 	return Position{File: fp}
 }
 
+// Text 读取位置对应的源码，读取失败时返回false
+func (self Position) Text() (string, bool) {
+	data, err := os.ReadFile(self.File.String())
+	if err != nil || self.Begin == 0 || self.Begin > self.End || int(self.End) > len(data) {
+		return "", false
+	}
+	// Begin和End都是字符结束处的偏移
+	_, size := utf8.DecodeLastRune(data[:self.Begin])
+	return string(data[self.Begin-uint(size) : self.End]), true
+}
+
 // MixPosition 混合Position
 func MixPosition(p1, p2 Position) Position {
 	if p1.File != p2.File {
@@ -0,0 +1,32 @@
+// 用于测试结构体按值传递的C函数
+
+typedef struct { int a; int b; } Pair;
+typedef struct { double d; int i; } Mixed;
+typedef struct { float x; float y; float z; } Vec3;
+typedef struct { long a; long b; long c; } Big;
+typedef struct { char a; char b; char c; } Bytes;
+
+Pair pair_make(int a, int b) { Pair p = {a, b}; return p; }
+int pair_sum(Pair p) { return p.a + p.b; }
+
+Mixed mixed_make(double d, int i) { Mixed m = {d, i}; return m; }
+double mixed_sum(Mixed m) { return m.d + m.i; }
+
+Vec3 vec3_scale(Vec3 v, float k) { Vec3 r = {v.x * k, v.y * k, v.z * k}; return r; }
+float vec3_sum(Vec3 v) { return v.x + v.y + v.z; }
+
+Big big_make(long a, long b, long c) { Big r = {a, b, c}; return r; }
+long big_sum(Big v) { return v.a + v.b + v.c; }
+
+Bytes bytes_make(char a, char b, char c) { Bytes r = {a, b, c}; return r; }
+int bytes_sum(Bytes v) { return v.a + v.b + v.c; }
+
+// 六个整数寄存器用完后结构体整体通过栈传递
+long pair_sum_many(long a, long b, long c, long d, long e, long f, Pair p) { return a + b + c + d + e + f + p.a * 100 + p.b * 1000; }
+
+// 剩余寄存器放不下整个结构体时结构体通过栈传递，后面的整数参数仍然使用剩余的寄存器
+typedef struct { long x; long y; } Wide;
+long wide_spill(long a, long b, long c, long d, long e, Wide w, long f) { return a + b + c + d + e + w.x * 100 + w.y * 1000 + f * 10000; }
+
+int pair_apply(Pair (*f)(Pair), Pair p) { Pair r = f(p); return r.a * 10 + r.b; }
+long big_apply(Big (*f)(Big), Big v) { Big r = f(v); return r.a * 100 + r.b * 10 + r.c; }
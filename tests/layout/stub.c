@@ -0,0 +1,73 @@
+#include <stddef.h>
+
+union Num {
+    int i;
+    float f;
+    double d;
+};
+
+struct __attribute__((packed)) Packed {
+    char c;
+    int i;
+    short s;
+};
+
+struct __attribute__((aligned(16))) Aligned {
+    int a;
+};
+
+struct Bits {
+    unsigned char tag;
+    unsigned a : 3;
+    int b : 7;
+    unsigned c : 30;
+};
+
+struct Outer {
+    char c;
+    struct Aligned inner;
+};
+
+// System V要求__int128按16字节对齐
+struct Wide {
+    long a;
+    __int128 b;
+};
+
+struct WideOuter {
+    char c;
+    struct Wide w;
+};
+
+size_t num_size(void) { return sizeof(union Num); }
+size_t packed_size(void) { return sizeof(struct Packed); }
+size_t aligned_size(void) { return sizeof(struct Aligned); }
+size_t bits_size(void) { return sizeof(struct Bits); }
+size_t outer_size(void) { return sizeof(struct Outer); }
+size_t outer_inner_offset(void) { return offsetof(struct Outer, inner); }
+size_t wide_size(void) { return sizeof(struct Wide); }
+size_t wide_align(void) { return _Alignof(struct Wide); }
+size_t wide_b_offset(void) { return offsetof(struct Wide, b); }
+size_t wide_outer_size(void) { return sizeof(struct WideOuter); }
+size_t wide_outer_w_offset(void) { return offsetof(struct WideOuter, w); }
+
+long wide_check(struct Wide *w) { return w->a == 3 && w->b == ((__int128)1 << 100); }
+
+union Num num_make_double(double d) {
+    union Num n;
+    n.d = d;
+    return n;
+}
+
+float num_get_float(union Num n) { return n.f; }
+
+int packed_sum(struct Packed *p) { return p->c + p->i + p->s; }
+
+struct Bits bits_make(void) {
+    struct Bits b = {7, 5, -3, 123456789};
+    return b;
+}
+
+int bits_check(struct Bits b) {
+    return b.tag == 9 && b.a == 2 && b.b == -60 && b.c == 1000000000;
+}
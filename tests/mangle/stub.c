@@ -0,0 +1,22 @@
+#include <stddef.h>
+
+struct Point {
+    int x, y;
+};
+
+extern int _SN4main6mangleEF3add(int, int);
+extern int _SN4main6mangleEV7counter;
+extern int _SN4main6mangleEM5Point3sum(struct Point *);
+extern int _SN4main6mangleEF6hidden(void) __attribute__((weak));
+extern int _SN4main6mangleEV14hidden_counter __attribute__((weak));
+
+int check_symbols(void) {
+    struct Point p = {1, 2};
+    if (_SN4main6mangleEF3add(1, 2) != 3) return 1;
+    if (_SN4main6mangleEV7counter != 7) return 2;
+    if (_SN4main6mangleEM5Point3sum(&p) != 12) return 3;
+    // 非pub符号为内部链接，外部不可见
+    if (&_SN4main6mangleEF6hidden != NULL) return 4;
+    if (&_SN4main6mangleEV14hidden_counter != NULL) return 5;
+    return 0;
+}
@@ -0,0 +1,56 @@
+#include <dirent.h>
+#include <pthread.h>
+#include <stddef.h>
+#include <string.h>
+#include <signal.h>
+#include <sys/select.h>
+#include <sys/stat.h>
+#include <sys/time.h>
+#include <termios.h>
+#include <time.h>
+
+size_t termios_size(void) { return sizeof(struct termios); }
+size_t timeval_size(void) { return sizeof(struct timeval); }
+size_t timespec_size(void) { return sizeof(struct timespec); }
+size_t fd_set_size(void) { return sizeof(fd_set); }
+size_t stat_size(void) { return sizeof(struct stat); }
+size_t sigset_size(void) { return sizeof(sigset_t); }
+size_t siginfo_size(void) { return sizeof(siginfo_t); }
+size_t sigaction_size(void) { return sizeof(struct sigaction); }
+size_t dirent_size(void) { return sizeof(struct dirent); }
+size_t pthread_attr_size(void) { return sizeof(pthread_attr_t); }
+size_t pthread_mutex_size(void) { return sizeof(pthread_mutex_t); }
+size_t pthread_cond_size(void) { return sizeof(pthread_cond_t); }
+size_t pthread_once_size(void) { return sizeof(pthread_once_t); }
+
+// 按c的布局填充，检查各字段的偏移
+void termios_fill(struct termios *t) {
+    t->c_lflag = 1;
+    t->c_line = 2;
+    t->c_cc[VMIN] = 3;
+    t->c_ispeed = 4;
+    t->c_ospeed = 5;
+}
+
+void stat_fill(struct stat *s) {
+    s->st_mode = 1;
+    s->st_uid = 2;
+    s->st_gid = 3;
+    s->st_rdev = 4;
+    s->st_size = 5;
+    s->st_mtim.tv_nsec = 6;
+    s->st_ctim.tv_sec = 7;
+}
+
+void sigaction_fill(struct sigaction *a) {
+    sigemptyset(&a->sa_mask);
+    sigaddset(&a->sa_mask, SIGUSR1);
+    a->sa_flags = SA_RESTART;
+    a->sa_restorer = (void (*)(void))8;
+}
+
+void dirent_fill(struct dirent *d) {
+    d->d_reclen = 1;
+    d->d_type = DT_DIR;
+    strcpy(d->d_name, "sim");
+}